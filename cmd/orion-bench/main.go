@@ -3,42 +3,148 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
 
 	"orion-bench/pkg/config"
+
+	"github.com/pkg/errors"
 )
 
 func main() {
 	ops := config.NewCmd().Add(
-		"clear", "clear all the material and data", func(c *config.OrionBenchConfig) {
-			c.Check(os.RemoveAll(c.Config.Path.Material))
-			c.Check(os.RemoveAll(c.Config.Path.Data))
-			c.Check(os.RemoveAll(c.Config.Path.Metrics))
+		"check-config", "checks the configuration and lists its errors and warnings", func(c *config.OrionBenchConfig) error {
+			check := config.CheckConfig(&c.Config, c.Cmd)
+			fmt.Print(check.Text())
+			return check.Err()
+		}).Add(
+		"clear", "clear all the material and data", func(c *config.OrionBenchConfig) error {
+			for _, p := range []string{c.Config.Path.Material, c.Config.Path.Data, c.Config.Path.Metrics} {
+				if err := os.RemoveAll(p); err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Add(
+		"material", "generate all crypto material and configurations", func(c *config.OrionBenchConfig) error {
+			return c.Material().Generate()
+		}).Add(
+		"update-material", "generate only the missing crypto material and update the configurations", func(c *config.OrionBenchConfig) error {
+			return c.Material().Update()
+		}).Add(
+		"list", "list all the available material and its status", func(c *config.OrionBenchConfig) error {
+			text, err := c.Material().InventoryText()
+			if err != nil {
+				return err
+			}
+			fmt.Print(text)
+			return nil
+		}).Add(
+		"validate", "validate all the material against the configuration", func(c *config.OrionBenchConfig) error {
+			v := c.Material().Validate()
+			fmt.Print(v.Text())
+			if !v.Passed() {
+				return errors.New("material validation failed")
+			}
+			return nil
+		}).Add(
+		"node", "runs an orion node", func(c *config.OrionBenchConfig) error {
+			node, err := c.Node()
+			if err != nil {
+				return err
+			}
+			return node.RunAndWait(c.Context())
+		}).Add(
+		"describe-workload", "describes the parameters and operations of a workload: -describe-workload [<name>]", func(c *config.OrionBenchConfig) error {
+			name := c.Config.Workload.Name
+			switch len(c.Cmd.Args) {
+			case 0:
+			case 1:
+				name = c.Cmd.Args[0]
+			default:
+				return errors.New("usage: -describe-workload [<name>]")
+			}
+			text, err := config.DescribeWorkload(name)
+			if err != nil {
+				return err
+			}
+			fmt.Print(text)
+			return nil
+		}).Add(
+		"init", "initialize the data for the benchmark", func(c *config.OrionBenchConfig) error {
+			w, err := c.Workload()
+			if err != nil {
+				return err
+			}
+			return w.Init()
+		}).Add(
+		"warmup", "runs a workload generator (client) for warmup", func(c *config.OrionBenchConfig) error {
+			w, err := c.Workload()
+			if err != nil {
+				return err
+			}
+			return w.RunWarmup(c.Context())
 		}).Add(
-		"material", "generate all crypto material and configurations", func(c *config.OrionBenchConfig) {
-			c.Material().Generate()
+		"benchmark", "runs a workload generator (client) for benchmark", func(c *config.OrionBenchConfig) error {
+			w, err := c.Workload()
+			if err != nil {
+				return err
+			}
+			return w.RunBenchmark(c.Context())
 		}).Add(
-		"list", "list all the available material", func(c *config.OrionBenchConfig) {
-			log.Println(c.Material().List())
+		"saturate", "runs a workload generator (client) with increasing rate to find the max throughput", func(c *config.OrionBenchConfig) error {
+			w, err := c.Workload()
+			if err != nil {
+				return err
+			}
+			return w.RunSaturation(c.Context())
 		}).Add(
-		"node", "runs an orion node", func(c *config.OrionBenchConfig) {
-			c.Node().RunAndWait()
+		"report", "merges the workers' reports into a cluster-wide report", func(c *config.OrionBenchConfig) error {
+			w, err := c.Workload()
+			if err != nil {
+				return err
+			}
+			return w.MergeReports()
 		}).Add(
-		"init", "initialize the data for the benchmark", func(c *config.OrionBenchConfig) {
-			c.Workload().Init()
+		"compare", "compares two reports: -compare <baseline> <candidate>", func(c *config.OrionBenchConfig) error {
+			if len(c.Cmd.Args) != 2 {
+				return errors.New("usage: -compare <baseline> <candidate>")
+			}
+			w, err := c.Workload()
+			if err != nil {
+				return err
+			}
+			return w.CompareReports(c.Cmd.Args[0], c.Cmd.Args[1])
 		}).Add(
-		"warmup", "runs a workload generator (client) for warmup", func(c *config.OrionBenchConfig) {
-			c.Workload().RunWarmup()
+		"coordinator", "runs a coordination service that synchronizes the workers' start time", func(c *config.OrionBenchConfig) error {
+			return c.Coordinator().Run(c.Context())
 		}).Add(
-		"benchmark", "runs a workload generator (client) for benchmark", func(c *config.OrionBenchConfig) {
-			c.Workload().RunBenchmark()
+		"local", "runs the entire experiment (nodes, init, warmup and benchmark) on this host", func(c *config.OrionBenchConfig) error {
+			l, err := c.Launcher()
+			if err != nil {
+				return err
+			}
+			return l.Run(c.Context())
 		}).Add(
-		"prometheus", "runs a prometheus server to collect the data", func(c *config.OrionBenchConfig) {
-			c.Material().Prometheus().Run()
+		"prometheus", "runs a prometheus server to collect the data", func(c *config.OrionBenchConfig) error {
+			return c.Material().Prometheus().Run()
 		})
-	cmd := config.ParseCommandLine(ops)
-	conf := config.ReadConfig(cmd)
-	conf.Print()
-	ops.ApplyAll(conf)
+	cmd, err := config.ParseCommandLine(ops)
+	if err != nil {
+		log.Fatalf("Invalid command line: %s", err)
+	}
+	conf, err := config.ReadConfig(cmd)
+	if err != nil {
+		log.Fatalf("Invalid config: %s", err)
+	}
+	if err = conf.Print(); err != nil {
+		log.Fatalf("Failed to print the config: %s", err)
+	}
+	if err = conf.Check(); err != nil {
+		log.Fatalf("Invalid config: %s", err)
+	}
+	if err = ops.ApplyAll(conf); err != nil {
+		log.Fatalf("Failed: %s", err)
+	}
 }
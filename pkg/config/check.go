@@ -0,0 +1,500 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"orion-bench/pkg/material"
+	"orion-bench/pkg/types"
+
+	"github.com/pkg/errors"
+)
+
+const maxPort = 65535
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// ConfigIssue is a problem in the configuration, located by its YAML path.
+type ConfigIssue struct {
+	Severity Severity
+	Path     string
+	Message  string
+}
+
+func (i *ConfigIssue) String() string {
+	return fmt.Sprintf("%s: %s", i.Path, i.Message)
+}
+
+// ConfigCheck is the result of checking the configuration before running any action.
+// Errors are setups that fail (or misbehave) later on, and warnings are setups that are likely to be a mistake.
+type ConfigCheck struct {
+	Issues []*ConfigIssue
+}
+
+func (c *ConfigCheck) add(severity Severity, path string, format string, args ...interface{}) {
+	c.Issues = append(c.Issues, &ConfigIssue{Severity: severity, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *ConfigCheck) errorf(path string, format string, args ...interface{}) {
+	c.add(SeverityError, path, format, args...)
+}
+
+func (c *ConfigCheck) warnf(path string, format string, args ...interface{}) {
+	c.add(SeverityWarning, path, format, args...)
+}
+
+// Filter returns the issues of the given severity.
+func (c *ConfigCheck) Filter(severity Severity) []*ConfigIssue {
+	var issues []*ConfigIssue
+	for _, i := range c.Issues {
+		if i.Severity == severity {
+			issues = append(issues, i)
+		}
+	}
+	return issues
+}
+
+// Passed returns true if the configuration has no errors.
+func (c *ConfigCheck) Passed() bool {
+	return len(c.Filter(SeverityError)) == 0
+}
+
+// Err returns an error that lists the configuration errors, or nil if there are none.
+func (c *ConfigCheck) Err() error {
+	errs := c.Filter(SeverityError)
+	if len(errs) == 0 {
+		return nil
+	}
+	lines := make([]string, len(errs))
+	for i, issue := range errs {
+		lines[i] = "  " + issue.String()
+	}
+	return errors.Errorf("%d configuration errors (see -check-config):\n%s", len(errs), strings.Join(lines, "\n"))
+}
+
+// Text returns the issues as a human-readable table with a summary.
+func (c *ConfigCheck) Text() string {
+	buf := &bytes.Buffer{}
+	tw := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0)
+	for _, i := range c.Issues {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", strings.ToUpper(string(i.Severity)), i.Path, i.Message)
+	}
+	_ = tw.Flush()
+	errs, warnings := len(c.Filter(SeverityError)), len(c.Filter(SeverityWarning))
+	if errs == 0 {
+		_, _ = fmt.Fprintf(buf, "PASSED: no errors, %d warnings.\n", warnings)
+	} else {
+		_, _ = fmt.Fprintf(buf, "FAILED: %d errors, %d warnings.\n", errs, warnings)
+	}
+	return buf.String()
+}
+
+// CheckConfig checks the configuration, and the rank of the selected actions.
+func CheckConfig(conf *types.BenchmarkConf, cmd *CommandLineArgs) *ConfigCheck {
+	c := &ConfigCheck{}
+	c.checkPaths(&conf.Path)
+	c.checkCluster(&conf.Cluster)
+	c.checkMaterial(&conf.Material)
+	c.checkWorkload(&conf.Workload)
+	c.checkPorts(conf)
+	if cmd != nil {
+		c.checkRank(conf, cmd)
+		c.checkSaturationScope(&conf.Workload, cmd)
+	}
+	return c
+}
+
+func (c *ConfigCheck) checkPaths(conf *types.PathConf) {
+	for _, p := range []struct {
+		path  string
+		value string
+	}{
+		{"path.material", conf.Material},
+		{"path.data", conf.Data},
+		{"path.metrics", conf.Metrics},
+	} {
+		if p.value == "" {
+			c.errorf(p.path, "must be set")
+		}
+	}
+	for _, f := range []struct {
+		path     string
+		value    string
+		severity Severity
+	}{
+		{"path.default-local-conf", conf.DefaultLocalConf, SeverityError},
+		{"path.default-shared-conf", conf.DefaultSharedConf, SeverityError},
+		// It is only used by the prometheus server
+		{"path.default-prometheus-conf", conf.DefaultPrometheusConf, SeverityWarning},
+	} {
+		if f.value == "" {
+			c.add(f.severity, f.path, "must be set")
+		} else if _, err := os.Stat(f.value); err != nil {
+			c.add(f.severity, f.path, "file is not accessible: %s", err)
+		}
+	}
+}
+
+func (c *ConfigCheck) checkCluster(conf *types.ClusterConf) {
+	if len(conf.Nodes) == 0 {
+		c.errorf("cluster.nodes", "must have at least one node")
+	}
+	if conf.DataSizeCollectionInterval <= 0 {
+		c.errorf("cluster.data-size-collection-interval", "must be positive")
+	}
+	switch conf.TLS.Mode {
+	case types.TLSOff, types.ServerTLS, types.MutualTLS:
+	default:
+		c.errorf("cluster.tls.mode", "unknown TLS mode '%s' (supported modes: %s, %s, %s)",
+			conf.TLS.Mode, types.TLSOff, types.ServerTLS, types.MutualTLS)
+	}
+}
+
+func (c *ConfigCheck) checkMaterial(conf *types.MaterialConf) {
+	crypto := &conf.Crypto
+	// An unknown key type is reported by checkKey
+	if crypto.Identity.Type == types.RSAKey || crypto.Identity.Type == types.Ed25519Key {
+		c.errorf("material.crypto.identity.key-type", "unsupported identity key type '%s' "+
+			"(Orion only supports ECDSA signatures)", crypto.Identity.Type)
+	}
+	c.checkKey("material.crypto.identity", &crypto.Identity)
+	c.checkKey("material.crypto.tls", &crypto.TLS)
+	c.positive("material.crypto.validity", crypto.Validity)
+
+	switch conf.CA.Issue {
+	case types.IssueUsers:
+	case types.IssueAll, types.IssueNodes:
+		if conf.CA.Intermediates > 0 {
+			c.errorf("material.ca.issue", "the nodes cannot be issued by the intermediate CAs, since the Orion SDK "+
+				"client only trusts nodes that are issued by the root CA (use: %s)", types.IssueUsers)
+		}
+	default:
+		c.errorf("material.ca.issue", "unknown selection '%s' (supported selections: %s, %s, %s)",
+			conf.CA.Issue, types.IssueAll, types.IssueUsers, types.IssueNodes)
+	}
+}
+
+// checkKey checks the key algorithm. The curve and the bits are only checked for the key types that use them.
+func (c *ConfigCheck) checkKey(path string, conf *types.KeyConf) {
+	switch conf.Type {
+	case types.ECDSAKey:
+		if !material.IsCurve(conf.Curve) {
+			c.errorf(path+".curve", "unsupported ECDSA curve '%s' (supported curves: %s)",
+				conf.Curve, strings.Join(material.Curves(), ", "))
+		}
+	case types.RSAKey:
+		if conf.RSABits < material.MinRSABits {
+			c.errorf(path+".rsa-bits", "RSA keys must have at least %d bits, got: %d", material.MinRSABits, conf.RSABits)
+		}
+	case types.Ed25519Key:
+	default:
+		c.errorf(path+".key-type", "unknown key type '%s' (supported types: %s, %s, %s)",
+			conf.Type, types.ECDSAKey, types.RSAKey, types.Ed25519Key)
+	}
+}
+
+func (c *ConfigCheck) positive(path string, d time.Duration) {
+	if d <= 0 {
+		c.errorf(path, "must be positive")
+	}
+}
+
+func (c *ConfigCheck) fraction(path string, f float64) {
+	if f < 0 || f > 1 {
+		c.errorf(path, "must be between 0 and 1, got: %g", f)
+	}
+}
+
+// checkPhases checks the work type's phases, or its single flat phase and rate if no phases are set.
+func (c *ConfigCheck) checkPhases(
+	phasesPath string, phases []types.PhaseConf,
+	durationPath string, d time.Duration,
+	ratePath string, rate *types.RateConf,
+) {
+	if len(phases) == 0 {
+		c.positive(durationPath, d)
+		c.checkRate(ratePath, rate)
+		return
+	}
+	for i := range phases {
+		p := &phases[i]
+		path := fmt.Sprintf("%s[%d]", phasesPath, i)
+		c.positive(path+".duration", p.Duration)
+		c.fraction(path+".users", p.Users)
+		c.checkRate(path+".rate", &p.Rate)
+	}
+}
+
+// checkRate checks the scope and the arrival of a rate. A zero target means no rate, so nothing else is checked.
+func (c *ConfigCheck) checkRate(path string, conf *types.RateConf) {
+	if conf.Target < 0 {
+		c.errorf(path+".target", "must not be negative, got: %g", conf.Target)
+	}
+	if conf.Target <= 0 {
+		return
+	}
+	c.checkScope(path+".scope", conf.Scope)
+	c.checkArrival(path+".arrival", conf.Arrival)
+}
+
+func (c *ConfigCheck) checkScope(path string, scope types.RateScope) {
+	switch scope {
+	case types.WorkerRate, types.ClusterRate:
+	default:
+		c.errorf(path, "unknown rate scope '%s' (supported scopes: %s, %s)", scope, types.WorkerRate, types.ClusterRate)
+	}
+}
+
+func (c *ConfigCheck) checkArrival(path string, arrival types.ArrivalType) {
+	switch arrival {
+	case types.ConstantArrival, types.PoissonArrival:
+	default:
+		c.errorf(path, "unknown arrival type '%s' (supported types: %s, %s)",
+			arrival, types.ConstantArrival, types.PoissonArrival)
+	}
+}
+
+func (c *ConfigCheck) checkSaturation(conf *types.SaturationConf) {
+	if conf.InitialRate <= 0 {
+		c.errorf("workload.saturation.initial-rate", "must be positive, got: %g", conf.InitialRate)
+	} else if conf.RateFactor*conf.InitialRate+conf.RateIncrement <= conf.InitialRate {
+		c.errorf("workload.saturation.rate-increment", "the rate must increase with each step: "+
+			"%g * rate-factor (%g) + rate-increment (%g) <= %g",
+			conf.InitialRate, conf.RateFactor, conf.RateIncrement, conf.InitialRate)
+	}
+	if conf.MaxSteps == 0 {
+		c.errorf("workload.saturation.max-steps", "must be positive")
+	}
+	c.positive("workload.saturation.step-duration", conf.StepDuration)
+	c.checkScope("workload.saturation.scope", conf.Scope)
+	c.checkArrival("workload.saturation.arrival", conf.Arrival)
+	c.positive("workload.saturation.latency-slo", conf.LatencySLO)
+	if conf.SLOPercentile <= 0 || conf.SLOPercentile > 1 {
+		c.errorf("workload.saturation.slo-percentile", "must be in (0, 1], got: %g", conf.SLOPercentile)
+	}
+	c.fraction("workload.saturation.max-error-rate", conf.MaxErrorRate)
+	c.fraction("workload.saturation.max-drop-rate", conf.MaxDropRate)
+}
+
+func (c *ConfigCheck) checkWorkload(conf *types.WorkloadConf) {
+	if w, ok := workloads[conf.Name]; !ok {
+		c.errorf("workload.name", "unknown workload '%s' (registered workloads: %s)",
+			conf.Name, strings.Join(WorkloadNames(), ", "))
+	} else {
+		for _, e := range w.schema.Validate(conf.Parameters) {
+			c.errorf("workload.parameters."+e.Name, "%s (see -describe-workload %s)", e.Err, conf.Name)
+		}
+	}
+
+	workers := uint64(len(conf.Workers))
+	switch {
+	case workers == 0:
+		c.errorf("workload.workers", "must have at least one worker")
+	case conf.UserCount == 0:
+		c.errorf("workload.user-count", "must be positive")
+	case conf.UserCount < workers:
+		c.errorf("workload.user-count", "%d users are fewer than the %d workers, so some workers have no users",
+			conf.UserCount, workers)
+	}
+
+	c.checkPhases("workload.warmup-phases", conf.WarmupPhases,
+		"workload.warmup-duration", conf.WarmupDuration, "workload.warmup-rate", &conf.WarmupRate)
+	c.checkPhases("workload.phases", conf.Phases, "workload.duration", conf.Duration, "workload.rate", &conf.Rate)
+	c.checkSaturation(&conf.Saturation)
+	if conf.Session.TxTimeout <= 0 {
+		c.warnf("workload.session.tx-timeout", "zero timeout")
+	}
+	if conf.Session.QueryTimeout <= 0 {
+		c.warnf("workload.session.query-timeout", "zero timeout")
+	}
+	if conf.Session.Receipts.PollInterval > 0 {
+		c.positive("workload.session.receipts.timeout", conf.Session.Receipts.Timeout)
+	}
+	if conf.Blocks.Enabled {
+		c.positive("workload.blocks.retry-interval", conf.Blocks.RetryInterval)
+		if conf.Blocks.Capacity <= 0 {
+			c.errorf("workload.blocks.capacity", "must be positive, got: %d", conf.Blocks.Capacity)
+		}
+	}
+	if conf.Coordinator.Address != "" {
+		if conf.Coordinator.Port == 0 {
+			c.errorf("workload.coordinator.port", "must be set when the coordinator's address is set")
+		}
+		c.positive("workload.coordinator.register-timeout", conf.Coordinator.RegisterTimeout)
+	}
+}
+
+// portOwner is a service that listens on a port.
+type portOwner struct {
+	name string
+	path string
+}
+
+// localHost is the key of the hosts that resolve to this machine.
+const localHost = "localhost"
+
+// hostKeys resolves the hosts, so the same machine has the same key regardless of how its hosts are written.
+// The services bind all the interfaces (0.0.0.0), so the loopback and the local addresses are the same machine.
+// A host that cannot be resolved is kept as is.
+type hostKeys struct {
+	keys  map[string]string
+	local map[string]bool
+}
+
+func newHostKeys() *hostKeys {
+	k := &hostKeys{keys: map[string]string{}, local: map[string]bool{}}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return k
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok {
+			k.local[ipNet.IP.String()] = true
+		}
+	}
+	return k
+}
+
+func (k *hostKeys) key(host string) string {
+	if key, ok := k.keys[host]; ok {
+		return key
+	}
+	key := host
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		ips, _ = net.LookupIP(host)
+	}
+	for _, ip := range ips {
+		if ip.IsLoopback() || ip.IsUnspecified() || k.local[ip.String()] {
+			key = localHost
+			break
+		}
+	}
+	if key == host && len(ips) > 0 {
+		key = ips[0].String()
+	}
+	k.keys[host] = key
+	return key
+}
+
+// checkPorts checks that the ports of the services on the same host do not overlap.
+// The node and worker ports are assigned by their rank (base port + rank), regardless of their host.
+func (c *ConfigCheck) checkPorts(conf *types.BenchmarkConf) {
+	keys := newHostKeys()
+	hosts := map[string]map[types.Port]*portOwner{}
+	// Only the first overlap between each two port settings is reported
+	reported := map[string]bool{}
+	use := func(host string, base types.Port, rank int, owner *portOwner) {
+		if base == 0 {
+			// Reported separately
+			return
+		}
+		port := base + types.Port(rank)
+		if port > maxPort {
+			key := owner.path + "|max"
+			if !reported[key] {
+				reported[key] = true
+				c.errorf(owner.path, "port %d of %s exceeds %d", port, owner.name, maxPort)
+			}
+			return
+		}
+		ports, ok := hosts[keys.key(host)]
+		if !ok {
+			ports = map[types.Port]*portOwner{}
+			hosts[keys.key(host)] = ports
+		}
+		prev, ok := ports[port]
+		if !ok {
+			ports[port] = owner
+			return
+		}
+		key := prev.path + "|" + owner.path
+		if !reported[key] {
+			reported[key] = true
+			c.errorf(owner.path, "port %d of %s overlaps with %s on host %s", port, owner.name, prev.name, host)
+		}
+	}
+
+	cluster := &conf.Cluster
+	for _, base := range []struct {
+		path string
+		port types.Port
+	}{
+		{"cluster.node-base-port", cluster.NodeBasePort},
+		{"cluster.peer-base-port", cluster.PeerBasePort},
+		{"cluster.prometheus-base-port", cluster.PrometheusBasePort},
+		{"workload.prometheus-base-port", conf.Workload.PrometheusBasePort},
+	} {
+		if base.port == 0 {
+			c.errorf(base.path, "must be set")
+		}
+	}
+	for i, host := range cluster.Nodes {
+		use(host, cluster.NodeBasePort, i, &portOwner{fmt.Sprintf("node %d", i), "cluster.node-base-port"})
+		use(host, cluster.PeerBasePort, i, &portOwner{fmt.Sprintf("node %d peer", i), "cluster.peer-base-port"})
+		use(host, cluster.PrometheusBasePort, i,
+			&portOwner{fmt.Sprintf("node %d prometheus", i), "cluster.prometheus-base-port"})
+	}
+	for i, host := range conf.Workload.Workers {
+		use(host, conf.Workload.PrometheusBasePort, i,
+			&portOwner{fmt.Sprintf("worker %d prometheus", i), "workload.prometheus-base-port"})
+	}
+	if coordinator := &conf.Workload.Coordinator; coordinator.Address != "" {
+		use(coordinator.Address, coordinator.Port, 0, &portOwner{"coordinator", "workload.coordinator.port"})
+	}
+}
+
+// rankActions are the actions that run a node or a worker rank.
+var rankActions = map[string]string{
+	"node":      "cluster.nodes",
+	"warmup":    "workload.workers",
+	"benchmark": "workload.workers",
+	"saturate":  "workload.workers",
+}
+
+// checkSaturationScope checks that a saturation search with a cluster scope has a single worker.
+// Each worker stops the search on its own evaluation of its steps, so with multiple workers, the rate of the
+// cluster drops once the first worker stops, and the other workers' steps do not run at the target rate.
+func (c *ConfigCheck) checkSaturationScope(conf *types.WorkloadConf, cmd *CommandLineArgs) {
+	for _, op := range cmd.Op.OpList {
+		if op.Name != "saturate" || !op.Selected {
+			continue
+		}
+		if conf.Saturation.Scope == types.ClusterRate && len(conf.Workers) > 1 {
+			c.errorf("workload.saturation.scope", "a cluster scope requires a single worker, got: %d workers "+
+				"(use a worker scope and multiply by the number of workers)", len(conf.Workers))
+		}
+	}
+}
+
+func (c *ConfigCheck) checkRank(conf *types.BenchmarkConf, cmd *CommandLineArgs) {
+	counts := map[string]int{
+		"cluster.nodes":    len(conf.Cluster.Nodes),
+		"workload.workers": len(conf.Workload.Workers),
+	}
+	for _, op := range cmd.Op.OpList {
+		listPath, ok := rankActions[op.Name]
+		if !ok || !op.Selected {
+			continue
+		}
+		switch {
+		case cmd.Rank.IsMainRank():
+			c.errorf("command-line.rank", "-%s requires a rank", op.Name)
+		case cmd.Rank.Number() >= uint64(counts[listPath]):
+			c.errorf("command-line.rank", "rank %s of -%s is out of range: %s has %d entries",
+				cmd.Rank, op.Name, listPath, counts[listPath])
+		}
+	}
+}
@@ -0,0 +1,389 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"orion-bench/pkg/types"
+
+	"github.com/creasty/defaults"
+	"github.com/hyperledger-labs/orion-server/pkg/logger"
+	"github.com/stretchr/testify/require"
+)
+
+// validConfig returns a configuration with no errors and no warnings: three nodes on one host, and two workers on
+// other hosts.
+func validConfig(t *testing.T) *types.BenchmarkConf {
+	conf := &types.BenchmarkConf{}
+	require.NoError(t, defaults.Set(conf))
+	dir := t.TempDir()
+	conf.Path.Material = filepath.Join(dir, "material")
+	conf.Path.Data = filepath.Join(dir, "data")
+	conf.Path.Metrics = filepath.Join(dir, "metrics")
+	for name, p := range map[string]*string{
+		"local-config.yaml":  &conf.Path.DefaultLocalConf,
+		"shared-config.yaml": &conf.Path.DefaultSharedConf,
+		"prometheus.yaml":    &conf.Path.DefaultPrometheusConf,
+	} {
+		*p = filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(*p, []byte{}, 0644))
+	}
+
+	conf.Cluster.Nodes = []string{"10.0.0.1", "10.0.0.1", "10.0.0.1"}
+	conf.Cluster.NodeBasePort = 6000
+	conf.Cluster.PeerBasePort = 7000
+	conf.Cluster.PrometheusBasePort = 2000
+	conf.Cluster.DataSizeCollectionInterval = time.Minute
+
+	w := &conf.Workload
+	w.Name = "independent"
+	w.Workers = []string{"10.0.0.2", "10.0.0.3"}
+	w.UserCount = 4
+	w.PrometheusBasePort = 2000
+	w.WarmupDuration = time.Minute
+	w.Duration = time.Minute
+	w.Session.TxTimeout = time.Second
+	w.Session.QueryTimeout = time.Second
+	return conf
+}
+
+// testCmd returns the command line of the rank with the given actions selected.
+func testCmd(rank uint64, selected ...string) *CommandLineArgs {
+	ops := NewCmd()
+	for _, name := range []string{"check-config", "node", "describe-workload", "benchmark", "saturate", "report"} {
+		ops.Add(name, "", nil)
+	}
+	for _, op := range ops.OpList {
+		for _, name := range selected {
+			op.Selected = op.Selected || op.Name == name
+		}
+	}
+	return &CommandLineArgs{Op: ops, Rank: &Rank{rank}}
+}
+
+func TestCheckConfig(t *testing.T) {
+	type issue struct {
+		path    string
+		message string
+	}
+	for _, tc := range []struct {
+		name   string
+		mutate func(conf *types.BenchmarkConf)
+		cmd    *CommandLineArgs
+		errors []issue
+	}{
+		{
+			name: "valid",
+			cmd:  testCmd(0, "node", "benchmark"),
+		},
+		{
+			name: "overlapping ports",
+			mutate: func(conf *types.BenchmarkConf) {
+				// Node 1's port is node 0's peer port. The overlaps of the following ranks are not reported again.
+				conf.Cluster.PeerBasePort = 6001
+			},
+			errors: []issue{
+				{"cluster.node-base-port", "port 6001 of node 1 overlaps with node 0 peer on host 10.0.0.1"},
+			},
+		},
+		{
+			name: "duplicate ports",
+			mutate: func(conf *types.BenchmarkConf) {
+				conf.Cluster.PrometheusBasePort = 7000
+			},
+			errors: []issue{
+				{"cluster.prometheus-base-port",
+					"port 7000 of node 0 prometheus overlaps with node 0 peer on host 10.0.0.1"},
+			},
+		},
+		{
+			name: "duplicate ports of a worker on a node's host",
+			mutate: func(conf *types.BenchmarkConf) {
+				conf.Workload.Workers = []string{"10.0.0.1"}
+			},
+			errors: []issue{
+				{"workload.prometheus-base-port",
+					"port 2000 of worker 0 prometheus overlaps with node 0 prometheus on host 10.0.0.1"},
+			},
+		},
+		{
+			name: "duplicate ports of a worker on a node's host by another name",
+			mutate: func(conf *types.BenchmarkConf) {
+				// The nodes bind all the interfaces, so the loopback addresses are the same host
+				conf.Cluster.Nodes = []string{"127.0.0.1", "127.0.0.2", "127.0.0.3"}
+				conf.Workload.Workers = []string{"localhost"}
+			},
+			errors: []issue{
+				{"workload.prometheus-base-port",
+					"port 2000 of worker 0 prometheus overlaps with node 0 prometheus on host localhost"},
+			},
+		},
+		{
+			name: "port out of range",
+			mutate: func(conf *types.BenchmarkConf) {
+				conf.Cluster.NodeBasePort = 65534
+			},
+			errors: []issue{
+				{"cluster.node-base-port", "port 65536 of node 2 exceeds 65535"},
+			},
+		},
+		{
+			name: "node rank out of range",
+			cmd:  testCmd(3, "node"),
+			errors: []issue{
+				{"command-line.rank", "rank 3 of -node is out of range: cluster.nodes has 3 entries"},
+			},
+		},
+		{
+			name: "worker rank out of range",
+			cmd:  testCmd(2, "node", "benchmark"),
+			errors: []issue{
+				{"command-line.rank", "rank 2 of -benchmark is out of range: workload.workers has 2 entries"},
+			},
+		},
+		{
+			name: "missing rank",
+			cmd:  testCmd(MainRank, "benchmark", "report"),
+			errors: []issue{
+				{"command-line.rank", "-benchmark requires a rank"},
+			},
+		},
+		{
+			name: "saturation with a cluster scope and multiple workers",
+			cmd:  testCmd(0, "saturate"),
+			errors: []issue{
+				{"workload.saturation.scope", "a cluster scope requires a single worker, got: 2 workers " +
+					"(use a worker scope and multiply by the number of workers)"},
+			},
+		},
+		{
+			name: "saturation with a worker scope and multiple workers",
+			mutate: func(conf *types.BenchmarkConf) {
+				conf.Workload.Saturation.Scope = types.WorkerRate
+			},
+			cmd: testCmd(0, "saturate"),
+		},
+		{
+			name: "saturation with a cluster scope and a single worker",
+			mutate: func(conf *types.BenchmarkConf) {
+				conf.Workload.Workers = conf.Workload.Workers[:1]
+				conf.Workload.UserCount = 1
+			},
+			cmd: testCmd(0, "saturate"),
+		},
+		{
+			name: "fewer users than workers",
+			mutate: func(conf *types.BenchmarkConf) {
+				conf.Workload.UserCount = 1
+			},
+			errors: []issue{
+				{"workload.user-count", "1 users are fewer than the 2 workers, so some workers have no users"},
+			},
+		},
+		{
+			name: "invalid phases",
+			mutate: func(conf *types.BenchmarkConf) {
+				conf.Workload.Phases = []types.PhaseConf{
+					{Duration: time.Minute, Users: 1.5},
+					{Duration: time.Minute, Users: 1, Rate: types.RateConf{Target: 10, Scope: "rank", Arrival: "burst"}},
+					{Duration: time.Minute, Users: 1, Rate: types.RateConf{Target: -1}},
+					// A zero target means no rate, so the scope and the arrival are not used
+					{Duration: time.Minute, Users: 0, Rate: types.RateConf{Scope: "rank"}},
+				}
+			},
+			errors: []issue{
+				{"workload.phases[0].users", "must be between 0 and 1, got: 1.5"},
+				{"workload.phases[1].rate.scope", "unknown rate scope 'rank' (supported scopes: worker, cluster)"},
+				{"workload.phases[1].rate.arrival", "unknown arrival type 'burst' (supported types: constant, poisson)"},
+				{"workload.phases[2].rate.target", "must not be negative, got: -1"},
+			},
+		},
+		{
+			name: "invalid flat rate",
+			mutate: func(conf *types.BenchmarkConf) {
+				conf.Workload.WarmupRate = types.RateConf{Target: 10, Scope: types.WorkerRate, Arrival: "burst"}
+			},
+			errors: []issue{
+				{"workload.warmup-rate.arrival", "unknown arrival type 'burst' (supported types: constant, poisson)"},
+			},
+		},
+		{
+			name: "invalid saturation",
+			mutate: func(conf *types.BenchmarkConf) {
+				s := &conf.Workload.Saturation
+				s.RateIncrement = 0
+				s.MaxSteps = 0
+				s.StepDuration = 0
+				s.SLOPercentile = 0
+				s.MaxDropRate = 2
+			},
+			errors: []issue{
+				{"workload.saturation.rate-increment",
+					"the rate must increase with each step: 100 * rate-factor (1) + rate-increment (0) <= 100"},
+				{"workload.saturation.max-steps", "must be positive"},
+				{"workload.saturation.step-duration", "must be positive"},
+				{"workload.saturation.slo-percentile", "must be in (0, 1], got: 0"},
+				{"workload.saturation.max-drop-rate", "must be between 0 and 1, got: 2"},
+			},
+		},
+		{
+			name: "saturation with a non-positive initial rate",
+			mutate: func(conf *types.BenchmarkConf) {
+				conf.Workload.Saturation.InitialRate = 0
+				conf.Workload.Saturation.SLOPercentile = 1.5
+			},
+			errors: []issue{
+				{"workload.saturation.initial-rate", "must be positive, got: 0"},
+				{"workload.saturation.slo-percentile", "must be in (0, 1], got: 1.5"},
+			},
+		},
+		{
+			name: "invalid block listener",
+			mutate: func(conf *types.BenchmarkConf) {
+				conf.Workload.Blocks = types.BlockListenerConf{Enabled: true}
+			},
+			errors: []issue{
+				{"workload.blocks.retry-interval", "must be positive"},
+				{"workload.blocks.capacity", "must be positive, got: 0"},
+			},
+		},
+		{
+			name: "disabled block listener is not checked",
+			mutate: func(conf *types.BenchmarkConf) {
+				conf.Workload.Blocks = types.BlockListenerConf{}
+			},
+		},
+		{
+			name: "unknown TLS mode",
+			mutate: func(conf *types.BenchmarkConf) {
+				conf.Cluster.TLS.Mode = "always"
+			},
+			errors: []issue{
+				{"cluster.tls.mode", "unknown TLS mode 'always' (supported modes: off, server-only, mutual)"},
+			},
+		},
+		{
+			name: "non-ECDSA identity",
+			mutate: func(conf *types.BenchmarkConf) {
+				conf.Material.Crypto.Identity.Type = types.Ed25519Key
+			},
+			errors: []issue{
+				{"material.crypto.identity.key-type",
+					"unsupported identity key type 'ed25519' (Orion only supports ECDSA signatures)"},
+			},
+		},
+		{
+			name: "invalid keys",
+			mutate: func(conf *types.BenchmarkConf) {
+				conf.Material.Crypto.Identity.Curve = "P-1"
+				conf.Material.Crypto.TLS.Type = types.RSAKey
+				conf.Material.Crypto.TLS.RSABits = 512
+			},
+			errors: []issue{
+				{"material.crypto.identity.curve", "unsupported ECDSA curve 'P-1' (supported curves: P-256, P-384, P-521)"},
+				{"material.crypto.tls.rsa-bits", "RSA keys must have at least 1024 bits, got: 512"},
+			},
+		},
+		{
+			name: "unknown key type",
+			mutate: func(conf *types.BenchmarkConf) {
+				conf.Material.Crypto.TLS.Type = "dsa"
+			},
+			errors: []issue{
+				{"material.crypto.tls.key-type", "unknown key type 'dsa' (supported types: ecdsa, rsa, ed25519)"},
+			},
+		},
+		{
+			name: "non-positive validity",
+			mutate: func(conf *types.BenchmarkConf) {
+				conf.Material.Crypto.Validity = 0
+			},
+			errors: []issue{
+				{"material.crypto.validity", "must be positive"},
+			},
+		},
+		{
+			name: "nodes issued by the intermediate CAs",
+			mutate: func(conf *types.BenchmarkConf) {
+				conf.Material.CA = types.CAConf{Intermediates: 2, Issue: types.IssueAll}
+			},
+			errors: []issue{
+				{"material.ca.issue", "the nodes cannot be issued by the intermediate CAs, since the Orion SDK " +
+					"client only trusts nodes that are issued by the root CA (use: users)"},
+			},
+		},
+		{
+			name: "nodes issued by the root CA",
+			mutate: func(conf *types.BenchmarkConf) {
+				conf.Material.CA = types.CAConf{Intermediates: 0, Issue: types.IssueNodes}
+			},
+		},
+		{
+			name: "unknown CA issue selection",
+			mutate: func(conf *types.BenchmarkConf) {
+				conf.Material.CA.Issue = "clients"
+			},
+			errors: []issue{
+				{"material.ca.issue", "unknown selection 'clients' (supported selections: all, users, nodes)"},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := validConfig(t)
+			if tc.mutate != nil {
+				tc.mutate(conf)
+			}
+			check := CheckConfig(conf, tc.cmd)
+			require.Empty(t, check.Filter(SeverityWarning))
+
+			var errs []issue
+			for _, i := range check.Filter(SeverityError) {
+				errs = append(errs, issue{i.Path, i.Message})
+			}
+			require.Equal(t, tc.errors, errs)
+			require.Equal(t, len(tc.errors) == 0, check.Passed())
+		})
+	}
+}
+
+func TestCheckReportActions(t *testing.T) {
+	lg, err := logger.New(&logger.Config{
+		Level:         "info",
+		OutputPath:    []string{"stdout"},
+		ErrOutputPath: []string{"stderr"},
+		Encoding:      "console",
+		Name:          "orion-bench-test",
+	})
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		selected []string
+		fail     bool
+	}{
+		{[]string{"check-config"}, false},
+		{[]string{"describe-workload"}, false},
+		{[]string{"check-config", "describe-workload"}, false},
+		{[]string{"check-config", "benchmark"}, true},
+		{[]string{"report"}, true},
+	} {
+		c := &OrionBenchConfig{lg: lg, Cmd: testCmd(0, tc.selected...), Config: *validConfig(t)}
+		require.NoError(t, c.Check(), "valid config with %v", tc.selected)
+
+		// The errors are only reported by the report actions
+		c.Config.Workload.UserCount = 1
+		c.Config.Workload.Parameters = map[string]string{"no-such-parameter": "1"}
+		err = c.Check()
+		if !tc.fail {
+			require.NoError(t, err, "invalid config with %v", tc.selected)
+			continue
+		}
+		require.EqualError(t, err, "2 configuration errors (see -check-config):\n"+
+			"  workload.parameters.no-such-parameter: unknown parameter (see -describe-workload independent)\n"+
+			"  workload.user-count: 1 users are fewer than the 2 workers, so some workers have no users",
+			"invalid config with %v", tc.selected)
+	}
+}
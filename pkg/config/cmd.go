@@ -5,7 +5,6 @@ package config
 import (
 	"flag"
 	"fmt"
-	"log"
 	"math"
 	"strconv"
 	"strings"
@@ -13,7 +12,7 @@ import (
 	"github.com/pkg/errors"
 )
 
-type OpFunction func(args *OrionBenchConfig)
+type OpFunction func(args *OrionBenchConfig) error
 type NamedOpFunction struct {
 	Name        string
 	Description string
@@ -39,13 +38,17 @@ func (o *CmdOperations) Add(name string, description string, f OpFunction) *CmdO
 	return o
 }
 
-func (o *CmdOperations) ApplyAll(conf *OrionBenchConfig) {
+// ApplyAll runs the selected operations by their order. It stops at the first operation that fails.
+func (o *CmdOperations) ApplyAll(conf *OrionBenchConfig) error {
 	for _, op := range o.OpList {
 		if op.Selected {
 			conf.lg.Infof("Running operation: %s", op.Name)
-			op.function(conf)
+			if err := op.function(conf); err != nil {
+				return errors.WithMessagef(err, "operation %s failed", op.Name)
+			}
 		}
 	}
+	return nil
 }
 
 func (o *CmdOperations) MarshalYAML() (interface{}, error) {
@@ -109,9 +112,10 @@ type CommandLineArgs struct {
 	ConfigPath string         `yaml:"config-path"`
 	Op         *CmdOperations `yaml:"op,flow"`
 	Rank       *Rank          `yaml:"rank"`
+	Args       []string       `yaml:"args,flow"`
 }
 
-func ParseCommandLine(ops *CmdOperations) *CommandLineArgs {
+func ParseCommandLine(ops *CmdOperations) (*CommandLineArgs, error) {
 	args := &CommandLineArgs{Op: ops, Rank: &Rank{MainRank}}
 	flag.StringVar(&args.Cwd, "cwd", "",
 		"benchmark configuration working directory")
@@ -124,9 +128,10 @@ func ParseCommandLine(ops *CmdOperations) *CommandLineArgs {
 	flag.Var(args.Rank, "rank",
 		"worker/node rank (starting from 0)")
 	flag.Parse()
+	args.Args = flag.Args()
 
 	if args.ConfigPath == "" {
-		log.Fatalf("Empty config path")
+		return nil, errors.New("empty config path")
 	}
-	return args
+	return args, nil
 }
@@ -3,16 +3,25 @@
 package config
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
 
+	"orion-bench/pkg/coordinator"
+	"orion-bench/pkg/launcher"
 	"orion-bench/pkg/material"
 	"orion-bench/pkg/types"
-	"orion-bench/pkg/utils"
 	"orion-bench/pkg/workload"
 	"orion-bench/pkg/workload/loads/independent"
+	"orion-bench/pkg/workload/loads/smallbank"
+	"orion-bench/pkg/workload/loads/ycsb"
 
 	"github.com/hyperledger-labs/orion-server/pkg/logger"
+	"github.com/pkg/errors"
 	"gopkg.in/yaml.v3"
 )
 
@@ -22,19 +31,26 @@ type OrionBenchConfig struct {
 	Config types.BenchmarkConf `yaml:"config"`
 
 	// Evaluated lazily
+	ctx      context.Context
 	material *material.BenchMaterial
 	workload *workload.Workload
 }
 
-func ReadConfig(cmd *CommandLineArgs) *OrionBenchConfig {
+func ReadConfig(cmd *CommandLineArgs) (*OrionBenchConfig, error) {
 	if cmd.Cwd != "" {
-		utils.CheckDefault(os.Chdir(cmd.Cwd))
+		if err := os.Chdir(cmd.Cwd); err != nil {
+			return nil, err
+		}
 	}
 	binConfig, err := os.ReadFile(cmd.ConfigPath)
-	utils.CheckDefault(err)
+	if err != nil {
+		return nil, err
+	}
 
 	c := &OrionBenchConfig{Cmd: cmd}
-	utils.CheckDefault(yaml.Unmarshal(binConfig, &c.Config))
+	if err = yaml.Unmarshal(binConfig, &c.Config); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse the config file: %s", cmd.ConfigPath)
+	}
 
 	loggerConf := &logger.Config{
 		Level:         c.Config.LogLevel,
@@ -43,49 +59,150 @@ func ReadConfig(cmd *CommandLineArgs) *OrionBenchConfig {
 		Encoding:      "console",
 		Name:          "orion-bench",
 	}
-	c.lg, err = logger.New(loggerConf)
-	utils.CheckDefault(err)
+	if c.lg, err = logger.New(loggerConf); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
 
-	return c
+// reportActions only report on the configuration, so they run regardless of its errors.
+var reportActions = map[string]bool{
+	"check-config":      true,
+	"describe-workload": true,
 }
 
-func (c *OrionBenchConfig) Print() {
+// Check checks the configuration before running the actions. The warnings are logged, and the errors fail
+// the run, unless only actions that report on the configuration are selected.
+func (c *OrionBenchConfig) Check() error {
+	check := CheckConfig(&c.Config, c.Cmd)
+	for _, issue := range check.Filter(SeverityWarning) {
+		c.lg.Warnf("Config warning: %s", issue)
+	}
+	if check.Passed() {
+		return nil
+	}
+	for _, op := range c.Cmd.Op.OpList {
+		if op.Selected && !reportActions[op.Name] {
+			return check.Err()
+		}
+	}
+	for _, issue := range check.Filter(SeverityError) {
+		c.lg.Errorf("Config error: %s", issue)
+	}
+	return nil
+}
+
+func (c *OrionBenchConfig) Print() error {
 	s, err := yaml.Marshal(c)
-	c.Check(err)
+	if err != nil {
+		return err
+	}
 	fmt.Println(string(s))
+	return nil
 }
 
-func (c *OrionBenchConfig) Check(err error) {
-	utils.Check(c.lg, err)
+// Context is cancelled when the process receives SIGINT or SIGTERM.
+// A second signal terminates the process immediately.
+func (c *OrionBenchConfig) Context() context.Context {
+	if c.ctx != nil {
+		return c.ctx
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+		c.lg.Infof("Received a stop signal. Shutting down gracefully (signal again to force).")
+	}()
+	c.ctx = ctx
+	return c.ctx
 }
 
+// Material returns the benchmark's material. It should only be used after the configuration passed Check.
 func (c *OrionBenchConfig) Material() *material.BenchMaterial {
-	if c.material != nil {
-		return c.material
+	if c.material == nil {
+		c.material = material.New(&c.Config, c.lg)
 	}
-
-	c.material = material.New(&c.Config, c.lg)
 	return c.material
 }
 
-var workloads = map[string]func(m *workload.Workload) workload.Worker{
-	"independent": independent.New,
+// registeredWorkload is a workload implementation and the schema of its parameters.
+type registeredWorkload struct {
+	builder func(m *workload.Workload) workload.Worker
+	schema  *workload.Schema
+}
+
+var workloads = map[string]*registeredWorkload{
+	"independent": {builder: independent.New, schema: independent.Schema},
+	"ycsb":        {builder: ycsb.New, schema: ycsb.Schema},
+	"smallbank":   {builder: smallbank.New, schema: smallbank.Schema},
+}
+
+func getWorkload(name string) (*registeredWorkload, error) {
+	w, ok := workloads[name]
+	if !ok {
+		return nil, errors.Errorf("invalid workload: %s (registered workloads: %s)",
+			name, strings.Join(WorkloadNames(), ", "))
+	}
+	return w, nil
+}
+
+// DescribeWorkload returns a human-readable description of a workload's parameters and operations.
+func DescribeWorkload(name string) (string, error) {
+	w, err := getWorkload(name)
+	if err != nil {
+		return "", err
+	}
+	return w.schema.Text(name), nil
+}
+
+// WorkloadNames returns the names of the registered workloads, sorted.
+func WorkloadNames() []string {
+	var names []string
+	for name := range workloads {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
-func (c *OrionBenchConfig) Workload() *workload.Workload {
+// Workload returns the workload of the worker rank.
+// The main rank can only initialize the experiment and process the reports.
+func (c *OrionBenchConfig) Workload() (*workload.Workload, error) {
 	if c.workload != nil {
-		return c.workload
+		return c.workload, nil
 	}
 
-	builder, ok := workloads[c.Config.Workload.Name]
-	if !ok {
-		c.lg.Fatalf("Invalid workload: %s", c.Config.Workload.Name)
+	w, err := getWorkload(c.Config.Workload.Name)
+	if err != nil {
+		return nil, err
+	}
+	rank := c.Cmd.Rank
+	if !rank.IsMainRank() && rank.Number() >= uint64(len(c.Config.Workload.Workers)) {
+		return nil, errors.Errorf("invalid worker rank: %s (%d workers)", rank, len(c.Config.Workload.Workers))
+	}
+	c.workload = workload.New(rank.Number(), &c.Config, c.Material(), c.lg)
+	c.workload.Worker = w.builder(c.workload)
+	return c.workload, nil
+}
+
+func (c *OrionBenchConfig) Coordinator() *coordinator.Coordinator {
+	return coordinator.New(&c.Config.Workload.Coordinator, uint64(len(c.Config.Workload.Workers)), c.lg)
+}
+
+func (c *OrionBenchConfig) Node() (*material.NodeMaterial, error) {
+	rank := c.Cmd.Rank
+	if rank.IsMainRank() || rank.Number() >= uint64(len(c.Config.Cluster.Nodes)) {
+		return nil, errors.Errorf("invalid node rank: %s (%d nodes)", rank, len(c.Config.Cluster.Nodes))
 	}
-	c.workload = workload.New(c.Cmd.Rank.Number(), &c.Config, c.Material(), c.lg)
-	c.workload.Worker = builder(c.workload)
-	return c.workload
+	return c.Material().Node(rank.Number()), nil
 }
 
-func (c *OrionBenchConfig) Node() *material.NodeMaterial {
-	return c.Material().Node(c.Cmd.Rank.Number())
+// Launcher returns a launcher that runs the entire experiment on this host.
+func (c *OrionBenchConfig) Launcher() (*launcher.Launcher, error) {
+	w, err := c.Workload()
+	if err != nil {
+		return nil, err
+	}
+	return launcher.New(&c.Config, c.Material(), c.Cmd.ConfigPath, w.CheckReady, c.lg), nil
 }
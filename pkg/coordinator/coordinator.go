@@ -0,0 +1,250 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package coordinator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"orion-bench/pkg/types"
+
+	"github.com/hyperledger-labs/orion-server/pkg/logger"
+	"github.com/pkg/errors"
+)
+
+const barrierPath = "/barrier"
+
+// Registration is sent by a worker rank when it finished its initialization.
+type Registration struct {
+	Rank     uint64        `json:"rank"`
+	WorkType string        `json:"work-type"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Release is returned to a registered worker with the common start and end time.
+type Release struct {
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Late    bool      `json:"late"`
+	Missing []uint64  `json:"missing"`
+}
+
+// barrier synchronizes all the workers of a single work type.
+type barrier struct {
+	registered map[uint64]bool
+	duration   time.Duration
+	timer      *time.Timer
+	released   chan struct{}
+	release    Release
+}
+
+// Coordinator serves a barrier for each work type.
+// All the workers are released with a common start time when all of them have registered,
+// or when the registration timeout expires. Workers that register after the release are reported as late.
+type Coordinator struct {
+	lg       *logger.SugarLogger
+	conf     *types.CoordinatorConf
+	expected uint64
+	lock     sync.Mutex
+	barriers map[string]*barrier
+}
+
+func New(conf *types.CoordinatorConf, expectedWorkers uint64, lg *logger.SugarLogger) *Coordinator {
+	return &Coordinator{
+		lg:       lg,
+		conf:     conf,
+		expected: expectedWorkers,
+		barriers: map[string]*barrier{},
+	}
+}
+
+// ServeAddress returns the address the coordinator listens on.
+func ServeAddress(conf *types.CoordinatorConf) string {
+	return fmt.Sprintf("0.0.0.0:%d", conf.Port)
+}
+
+// TargetAddress returns the address the workers connect to.
+func TargetAddress(conf *types.CoordinatorConf) string {
+	return fmt.Sprintf("%s:%d", conf.Address, conf.Port)
+}
+
+func (c *Coordinator) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(barrierPath, c.handleBarrier)
+	return mux
+}
+
+// Serve serves the coordinator on the listener until the context is cancelled, and then shuts down the server.
+// The requests' context is derived from the context, so the pending registrations do not delay the shutdown.
+func (c *Coordinator) Serve(ctx context.Context, listener net.Listener) error {
+	c.lg.Infof("Starting coordinator on: %s (expected workers: %d)", listener.Addr(), c.expected)
+	server := &http.Server{
+		Handler: c.Handler(),
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
+	}
+
+	served := make(chan struct{})
+	shutdown := make(chan error, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.lg.Infof("Shutting down the coordinator.")
+			shutdown <- server.Shutdown(context.Background())
+		case <-served:
+			shutdown <- nil
+		}
+	}()
+
+	err := server.Serve(listener)
+	close(served)
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return <-shutdown
+}
+
+// Run serves the coordinator on its configured port until the context is cancelled.
+func (c *Coordinator) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", ServeAddress(c.conf))
+	if err != nil {
+		return err
+	}
+	return c.Serve(ctx, listener)
+}
+
+// getBarrier returns the barrier of the work type. A new barrier is created if the previous one already ended.
+func (c *Coordinator) getBarrier(workType string) *barrier {
+	b, ok := c.barriers[workType]
+	if ok && (!b.isReleased() || time.Now().Before(b.release.End)) {
+		return b
+	}
+	b = &barrier{
+		registered: map[uint64]bool{},
+		released:   make(chan struct{}),
+	}
+	b.timer = time.AfterFunc(c.conf.RegisterTimeout, func() {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		if !b.isReleased() {
+			c.lg.Warnf("Registration timeout (%s) for %s.", c.conf.RegisterTimeout, workType)
+			c.releaseBarrier(workType, b)
+		}
+	})
+	c.barriers[workType] = b
+	return b
+}
+
+func (b *barrier) isReleased() bool {
+	select {
+	case <-b.released:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *Coordinator) releaseBarrier(workType string, b *barrier) {
+	b.timer.Stop()
+	start := time.Now().Add(c.conf.StartDelay)
+	b.release = Release{Start: start, End: start.Add(b.duration)}
+	for r := uint64(0); r < c.expected; r++ {
+		if !b.registered[r] {
+			b.release.Missing = append(b.release.Missing, r)
+		}
+	}
+	if len(b.release.Missing) > 0 {
+		c.lg.Warnf("Releasing %s with missing workers: %v", workType, b.release.Missing)
+	}
+	c.lg.Infof("Releasing %s (%d workers): start: %s, end: %s.",
+		workType, len(b.registered), b.release.Start.Format(time.RFC3339Nano), b.release.End.Format(time.RFC3339Nano))
+	close(b.released)
+}
+
+// register registers the worker and returns its barrier.
+func (c *Coordinator) register(reg *Registration) *barrier {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	b := c.getBarrier(reg.WorkType)
+	if b.isReleased() {
+		c.lg.Warnf("Worker %d registered late for %s.", reg.Rank, reg.WorkType)
+		return b
+	}
+
+	c.lg.Infof("Worker %d registered for %s.", reg.Rank, reg.WorkType)
+	b.registered[reg.Rank] = true
+	if reg.Duration > b.duration {
+		b.duration = reg.Duration
+	}
+	if uint64(len(b.registered)) >= c.expected {
+		c.releaseBarrier(reg.WorkType, b)
+	}
+	return b
+}
+
+func (c *Coordinator) handleBarrier(rw http.ResponseWriter, req *http.Request) {
+	reg := &Registration{}
+	if err := json.NewDecoder(req.Body).Decode(reg); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	b := c.register(reg)
+	select {
+	case <-b.released:
+	case <-req.Context().Done():
+		// The worker disconnected, or the coordinator is shutting down
+		http.Error(rw, "the registration was cancelled", http.StatusServiceUnavailable)
+		return
+	}
+
+	release := b.release
+	release.Late = !b.registered[reg.Rank]
+	rw.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(rw).Encode(&release); err != nil {
+		c.lg.Errorf("Failed to respond to worker %d: %s", reg.Rank, err)
+	}
+}
+
+// Wait registers at the coordinator and blocks until the barrier is released, or until the context is cancelled.
+func Wait(ctx context.Context, address string, reg *Registration) (*Release, error) {
+	body, err := json.Marshal(reg)
+	if err != nil {
+		return nil, err
+	}
+	//goland:noinspection HttpUrlsUsage
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, fmt.Sprintf("http://%s%s", address, barrierPath), bytes.NewReader(body),
+	)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, errors.Wrapf(err, "failed to register at the coordinator (%s)", address)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("coordinator (%s) responded with: %s", address, resp.Status)
+	}
+
+	release := &Release{}
+	if err = json.NewDecoder(resp.Body).Decode(release); err != nil {
+		return nil, err
+	}
+	return release, nil
+}
@@ -0,0 +1,154 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package coordinator
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"orion-bench/pkg/types"
+
+	"github.com/hyperledger-labs/orion-server/pkg/logger"
+	"github.com/stretchr/testify/require"
+)
+
+const workType = "benchmark"
+
+// serve serves a coordinator of the expected workers on a free local port until the test ends,
+// and returns its address.
+func serve(t *testing.T, expected uint64, registerTimeout time.Duration) string {
+	address, stop := serveUntilStopped(t, expected, registerTimeout)
+	t.Cleanup(func() {
+		require.NoError(t, stop())
+	})
+	return address
+}
+
+// serveUntilStopped serves a coordinator of the expected workers on a free local port, and returns its address and
+// a function that stops it and returns the error of the server.
+func serveUntilStopped(t *testing.T, expected uint64, registerTimeout time.Duration) (string, func() error) {
+	lg, err := logger.New(&logger.Config{
+		Level:         "info",
+		OutputPath:    []string{"stdout"},
+		ErrOutputPath: []string{"stderr"},
+		Encoding:      "console",
+		Name:          "orion-bench-coordinator",
+	})
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	c := New(&types.CoordinatorConf{RegisterTimeout: registerTimeout, StartDelay: 100 * time.Millisecond}, expected, lg)
+	served := make(chan error, 1)
+	go func() {
+		served <- c.Serve(ctx, listener)
+	}()
+	return listener.Addr().String(), func() error {
+		cancel()
+		return <-served
+	}
+}
+
+type waitResult struct {
+	rank    uint64
+	release *Release
+	err     error
+}
+
+// waitAll registers the ranks concurrently, and returns their releases by rank.
+func waitAll(t *testing.T, address string, ranks []uint64, duration func(rank uint64) time.Duration) map[uint64]*Release {
+	results := make(chan *waitResult, len(ranks))
+	for _, rank := range ranks {
+		go func(rank uint64) {
+			release, err := Wait(context.Background(), address, &Registration{Rank: rank, WorkType: workType, Duration: duration(rank)})
+			results <- &waitResult{rank: rank, release: release, err: err}
+		}(rank)
+	}
+
+	releases := map[uint64]*Release{}
+	for range ranks {
+		r := <-results
+		require.NoError(t, r.err, "rank %d", r.rank)
+		releases[r.rank] = r.release
+	}
+	return releases
+}
+
+func TestReleaseAllRegistered(t *testing.T) {
+	address := serve(t, 3, time.Minute)
+	registered := time.Now()
+	releases := waitAll(t, address, []uint64{0, 1, 2}, func(rank uint64) time.Duration {
+		return time.Duration(rank+1) * time.Second
+	})
+
+	// All the ranks are released together, without waiting for the timeout, until the longest duration
+	require.Less(t, time.Since(registered), time.Minute)
+	first := releases[0]
+	require.True(t, first.Start.After(registered))
+	require.Equal(t, 3*time.Second, first.End.Sub(first.Start))
+	for rank, release := range releases {
+		require.False(t, release.Late, "rank %d", rank)
+		require.Empty(t, release.Missing, "rank %d", rank)
+		require.True(t, first.Start.Equal(release.Start), "rank %d", rank)
+		require.True(t, first.End.Equal(release.End), "rank %d", rank)
+	}
+}
+
+func TestReleaseOnRegisterTimeout(t *testing.T) {
+	registerTimeout := 500 * time.Millisecond
+	address := serve(t, 4, registerTimeout)
+	registered := time.Now()
+	releases := waitAll(t, address, []uint64{0, 2}, func(uint64) time.Duration {
+		return time.Minute
+	})
+
+	require.GreaterOrEqual(t, time.Since(registered), registerTimeout)
+	for rank, release := range releases {
+		require.False(t, release.Late, "rank %d", rank)
+		require.Equal(t, []uint64{1, 3}, release.Missing, "rank %d", rank)
+	}
+	require.True(t, releases[0].Start.Equal(releases[2].Start))
+}
+
+func TestLateRegistration(t *testing.T) {
+	address := serve(t, 2, 500*time.Millisecond)
+	releases := waitAll(t, address, []uint64{0}, func(uint64) time.Duration {
+		return time.Minute
+	})
+	onTime := releases[0]
+	require.False(t, onTime.Late)
+	require.Equal(t, []uint64{1}, onTime.Missing)
+
+	// The barrier is still running, so the late rank gets its times to join the run
+	late, err := Wait(context.Background(), address, &Registration{Rank: 1, WorkType: workType, Duration: time.Minute})
+	require.NoError(t, err)
+	require.True(t, late.Late)
+	require.Equal(t, []uint64{1}, late.Missing)
+	require.True(t, onTime.Start.Equal(late.Start))
+	require.True(t, onTime.End.Equal(late.End))
+}
+
+func TestWaitCancelled(t *testing.T) {
+	address := serve(t, 2, time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := Wait(ctx, address, &Registration{Rank: 0, WorkType: workType, Duration: time.Minute})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestShutdownWithPendingRegistration(t *testing.T) {
+	address, stop := serveUntilStopped(t, 2, time.Minute)
+	waited := make(chan error, 1)
+	go func() {
+		_, err := Wait(context.Background(), address, &Registration{Rank: 0, WorkType: workType, Duration: time.Minute})
+		waited <- err
+	}()
+
+	// The pending registration neither delays the shutdown nor is released
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, stop())
+	require.Error(t, <-waited)
+}
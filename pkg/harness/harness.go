@@ -0,0 +1,305 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+// Package harness runs workloads end-to-end against an in-process Orion cluster.
+// Each run generates its material into a temporary directory, starts the nodes in-process (the same way as the
+// -node action), and runs the workload's init, warmup and benchmark as worker rank 0.
+// The ports are allocated dynamically, so multiple runs (and processes) can run in parallel on the same host.
+// A run whose nodes fail to bind their ports, since another process took them meanwhile, retries with new ports.
+package harness
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"orion-bench/pkg/config"
+	"orion-bench/pkg/material"
+	"orion-bench/pkg/types"
+	"orion-bench/pkg/workload"
+	"orion-bench/pkg/workload/common"
+
+	"github.com/hyperledger-labs/orion-server/pkg/logger"
+	"github.com/hyperledger-labs/orion-server/pkg/server"
+	"github.com/pkg/errors"
+)
+
+const (
+	localHost = "127.0.0.1"
+	// defaultDB is Orion's default DB, which exists in every cluster.
+	defaultDB = "bdb"
+	// maxStartAttempts is the number of times a run's nodes are started with new ports.
+	maxStartAttempts = 5
+	// readyPoll is the interval between two checks of the cluster's readiness.
+	readyPoll = time.Second
+	// probeKey is written to the default DB to check that the cluster commits TXs.
+	probeKey = "orion-bench-harness-probe"
+)
+
+// Case is a workload that is run by the harness.
+// The operations and parameters replace the base configuration's, unless they are empty.
+type Case struct {
+	Workload         string
+	Builder          func(w *workload.Workload) workload.Worker
+	Parameters       map[string]string
+	WarmupOperations []types.WorkloadOperation
+	Operations       []types.WorkloadOperation
+}
+
+// Conf defines the runs of the harness: each case runs against a fresh in-process cluster of the given number
+// of nodes. Each run must have at least one successful operation in the warmup and the benchmark, and at most the
+// max error rate of failed operations. A run's temporary directory is removed unless keep is set.
+type Conf struct {
+	Nodes          int
+	UserCount      uint64
+	WarmupDuration time.Duration
+	Duration       time.Duration
+	ReadyTimeout   time.Duration
+	MaxErrorRate   float64
+	Keep           bool
+}
+
+// Result holds the client counters of a case's run.
+type Result struct {
+	Workload  string
+	Warmup    *common.PhaseSummary
+	Benchmark *common.PhaseSummary
+	Blocks    *common.BlockReport
+	Err       error
+}
+
+// Harness runs cases according to a base configuration.
+// Only the paths, the cluster's nodes and ports, and the workload's work and workers are overridden
+// (see Conf). The rest, e.g., the default node configuration files and the TLS mode, are taken as is.
+type Harness struct {
+	lg   *logger.SugarLogger
+	base *types.BenchmarkConf
+	conf *Conf
+}
+
+func New(base *types.BenchmarkConf, conf *Conf, lg *logger.SugarLogger) *Harness {
+	return &Harness{
+		lg:   lg,
+		base: base,
+		conf: conf,
+	}
+}
+
+// config returns a configuration of a case's run.
+func (h *Harness) config(c *Case, dir string) (*types.BenchmarkConf, error) {
+	nodes := h.conf.Nodes
+	if nodes <= 0 {
+		return nil, errors.Errorf("the number of nodes must be positive: %d", nodes)
+	}
+	ports, err := allocatePorts(nodes, nodes, nodes, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	conf := *h.base
+	conf.Path.Material = filepath.Join(dir, "material")
+	conf.Path.Data = filepath.Join(dir, "data")
+	conf.Path.Metrics = filepath.Join(dir, "metrics")
+
+	conf.Cluster.Nodes = make([]string, nodes)
+	for i := range conf.Cluster.Nodes {
+		conf.Cluster.Nodes[i] = localHost
+	}
+	conf.Cluster.NodeBasePort = ports[0]
+	conf.Cluster.PeerBasePort = ports[1]
+	conf.Cluster.PrometheusBasePort = ports[2]
+
+	w := &conf.Workload
+	w.Name = c.Workload
+	w.UserCount = h.conf.UserCount
+	w.Workers = []string{localHost}
+	w.PrometheusBasePort = ports[3]
+	w.Coordinator.Address = ""
+	w.Blocks.Enabled = true
+	w.WarmupDuration = h.conf.WarmupDuration
+	w.Duration = h.conf.Duration
+	w.WarmupRate = types.RateConf{}
+	w.Rate = types.RateConf{}
+	w.WarmupPhases = nil
+	w.Phases = nil
+	if c.Parameters != nil {
+		w.Parameters = c.Parameters
+	}
+	if len(c.WarmupOperations) > 0 {
+		w.WarmupOperations = c.WarmupOperations
+	}
+	if len(c.Operations) > 0 {
+		w.Operations = c.Operations
+	}
+	return &conf, nil
+}
+
+// Run runs a case on a fresh cluster, and returns its counters.
+// It fails if the run failed, or if the counters do not pass Check.
+func (h *Harness) Run(ctx context.Context, c *Case) (*Result, error) {
+	dir, err := os.MkdirTemp("", fmt.Sprintf("orion-bench-e2e-%s-", c.Workload))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create the harness directory")
+	}
+	if h.conf.Keep {
+		h.lg.Infof("Workload %s runs in: %s", c.Workload, dir)
+	} else {
+		defer func() {
+			if err := os.RemoveAll(dir); err != nil {
+				h.lg.Warnf("Failed to remove the harness directory %s: %s", dir, err)
+			}
+		}()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	conf, benchMaterial, servers, err := h.start(ctx, c, dir)
+	if err != nil {
+		return nil, err
+	}
+	defer h.stopNodes(servers)
+
+	w := workload.New(0, conf, benchMaterial, h.lg)
+	w.Worker = c.Builder(w)
+	if err = h.waitReady(ctx, w); err != nil {
+		return nil, err
+	}
+	if err = w.Init(); err != nil {
+		return nil, errors.WithMessage(err, "init failed")
+	}
+	if err = w.RunWarmup(ctx); err != nil {
+		return nil, errors.WithMessage(err, "warmup failed")
+	}
+	if err = w.RunBenchmark(ctx); err != nil {
+		return nil, errors.WithMessage(err, "benchmark failed")
+	}
+
+	report, err := common.ReadReport(w.ReportPath(workload.Benchmark, 0) + ".json")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the benchmark report")
+	}
+	r := &Result{Workload: c.Workload, Blocks: report.Blocks}
+	if r.Warmup, err = w.Stats.SummarizePhase(string(workload.Warmup), ""); err != nil {
+		return nil, err
+	}
+	if r.Benchmark, err = w.Stats.SummarizePhase(string(workload.Benchmark), ""); err != nil {
+		return nil, err
+	}
+	return r, r.Check(h.conf.MaxErrorRate)
+}
+
+// start generates the material of a case's run into a sub-directory of dir, and starts its nodes.
+// The ports are only reserved until the nodes bind them. If a node fails to bind a port that was taken meanwhile,
+// the started nodes are stopped, and the run is regenerated with new ports into a new sub-directory.
+func (h *Harness) start(ctx context.Context, c *Case, dir string) (
+	*types.BenchmarkConf, *material.BenchMaterial, []*server.BCDBHTTPServer, error,
+) {
+	for attempt := 1; ; attempt++ {
+		conf, err := h.config(c, filepath.Join(dir, fmt.Sprintf("attempt-%d", attempt)))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if err = config.CheckConfig(conf, nil).Err(); err != nil {
+			return nil, nil, nil, err
+		}
+		benchMaterial := material.New(conf, h.lg)
+		if err = benchMaterial.Generate(); err != nil {
+			return nil, nil, nil, errors.Wrap(err, "failed to generate the material")
+		}
+
+		servers, err := h.startNodes(ctx, benchMaterial)
+		if err == nil {
+			return conf, benchMaterial, servers, nil
+		}
+		h.stopNodes(servers)
+		if !isAddrInUse(err) || attempt >= maxStartAttempts {
+			return nil, nil, nil, err
+		}
+		h.lg.Warnf("Failed to start the nodes (attempt %d), retrying with new ports: %s", attempt, err)
+	}
+}
+
+// isAddrInUse returns true if the error is due to a port that is already in use.
+// The server may not wrap the listener's error, so its message is also checked.
+func isAddrInUse(err error) bool {
+	return errors.Is(err, syscall.EADDRINUSE) || strings.Contains(err.Error(), syscall.EADDRINUSE.Error())
+}
+
+// startNodes starts all the nodes in-process. On failure, it returns the nodes that were started.
+func (h *Harness) startNodes(ctx context.Context, benchMaterial *material.BenchMaterial) ([]*server.BCDBHTTPServer, error) {
+	var servers []*server.BCDBHTTPServer
+	for _, node := range benchMaterial.AllNodes() {
+		srv, err := node.Run(ctx)
+		if err != nil {
+			return servers, err
+		}
+		servers = append(servers, srv)
+	}
+	return servers, nil
+}
+
+// stopNodes stops the nodes in the reverse order of their start.
+func (h *Harness) stopNodes(servers []*server.BCDBHTTPServer) {
+	for i := len(servers) - 1; i >= 0; i-- {
+		if err := servers[i].Stop(); err != nil {
+			h.lg.Warnf("Failed to stop node %d: %s", i, err)
+		}
+	}
+}
+
+// waitReady waits until the cluster commits the admin's TXs, i.e., until it elected a leader.
+func (h *Harness) waitReady(ctx context.Context, w *workload.Workload) error {
+	deadline := time.Now().Add(h.conf.ReadyTimeout)
+	for {
+		err := probe(w)
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return errors.Wrapf(err, "cluster is not ready after %s", h.conf.ReadyTimeout)
+		}
+		h.lg.Debugf("Cluster is not ready: %s", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(readyPoll):
+		}
+	}
+}
+
+func probe(w *workload.Workload) error {
+	session, err := w.AdminSession()
+	if err != nil {
+		return err
+	}
+	tx, err := session.DataTx()
+	if err != nil {
+		return err
+	}
+	defer w.AbortTx(tx)
+	if err = tx.Put(defaultDB, probeKey, []byte{}, nil); err != nil {
+		return err
+	}
+	return w.CommitSync(tx, true)
+}
+
+// Check returns an error if the warmup or the benchmark had no successful operations, or more failed operations
+// than the max error rate, or if no blocks were observed during the benchmark.
+func (r *Result) Check(maxErrorRate float64) error {
+	for _, s := range []*common.PhaseSummary{r.Warmup, r.Benchmark} {
+		if s.Successful == 0 {
+			return errors.Errorf("%s: no successful operations (%d failed)", s.Phase, s.Failed)
+		}
+		if s.ErrorRate() > maxErrorRate {
+			return errors.Errorf("%s: error rate %.4f exceeds %.4f (%d failed, %d successful)",
+				s.Phase, s.ErrorRate(), maxErrorRate, s.Failed, s.Successful)
+		}
+	}
+	if r.Blocks == nil || r.Blocks.Count == 0 {
+		return errors.Errorf("%s: no blocks were observed", workload.Benchmark)
+	}
+	return nil
+}
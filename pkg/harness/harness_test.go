@@ -0,0 +1,108 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package harness
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"orion-bench/pkg/types"
+	"orion-bench/pkg/workload"
+	"orion-bench/pkg/workload/loads/independent"
+	"orion-bench/pkg/workload/loads/smallbank"
+	"orion-bench/pkg/workload/loads/ycsb"
+
+	"github.com/hyperledger-labs/orion-server/pkg/logger"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+// examplesPath holds the example config, whose default node configuration files are used by the runs.
+const examplesPath = "../../examples"
+
+// testConf keeps the runs short.
+var testConf = Conf{
+	Nodes:     1,
+	UserCount: 4,
+	// The warmup ends earlier once the workload's users are done
+	WarmupDuration: 30 * time.Second,
+	Duration:       10 * time.Second,
+	ReadyTimeout:   time.Minute,
+	MaxErrorRate:   0.01,
+}
+
+// testCases keep the conflicts rare.
+var testCases = []struct {
+	schema *workload.Schema
+	Case
+}{
+	{independent.Schema, Case{
+		Workload:   "independent",
+		Builder:    independent.New,
+		Parameters: map[string]string{"lines-per-user": "10", "commits-per-sync": "1"},
+		WarmupOperations: []types.WorkloadOperation{
+			{Operation: "-write 5 -acl 0 -size 8", Weight: 1},
+		},
+		Operations: []types.WorkloadOperation{
+			{Operation: "-read 1 -write 1 -acl 0 -size 8", Weight: 1},
+		},
+	}},
+	{ycsb.Schema, Case{
+		Workload:   "ycsb",
+		Builder:    ycsb.New,
+		Parameters: map[string]string{"record-count": "1000", "request-distribution": "uniform"},
+	}},
+	{smallbank.Schema, Case{
+		Workload:   "smallbank",
+		Builder:    smallbank.New,
+		Parameters: map[string]string{"account-count": "10000", "hotspot-probability": "0"},
+	}},
+}
+
+// baseConfig returns the example config, with its default node configuration files' paths relative to the test.
+func baseConfig(t *testing.T) *types.BenchmarkConf {
+	raw, err := os.ReadFile(filepath.Join(examplesPath, "config.yaml"))
+	require.NoError(t, err)
+	conf := &types.BenchmarkConf{}
+	require.NoError(t, yaml.Unmarshal(raw, conf))
+
+	for _, p := range []*string{
+		&conf.Path.DefaultLocalConf, &conf.Path.DefaultSharedConf, &conf.Path.DefaultPrometheusConf,
+	} {
+		*p, err = filepath.Abs(filepath.Join(examplesPath, *p))
+		require.NoError(t, err)
+	}
+	return conf
+}
+
+func TestHarness(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs in-process clusters")
+	}
+	base := baseConfig(t)
+	lg, err := logger.New(&logger.Config{
+		Level:         base.LogLevel,
+		OutputPath:    []string{"stdout"},
+		ErrOutputPath: []string{"stderr"},
+		Encoding:      "console",
+		Name:          "orion-bench-harness",
+	})
+	require.NoError(t, err)
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Workload, func(t *testing.T) {
+			t.Parallel()
+			require.Empty(t, tc.schema.Validate(tc.Parameters))
+
+			conf := testConf
+			r, err := New(base, &conf, lg).Run(context.Background(), &tc.Case)
+			require.NoError(t, err)
+			t.Logf("warmup: %d successful, %d failed; benchmark: %d successful, %d failed; %d blocks",
+				r.Warmup.Successful, r.Warmup.Failed, r.Benchmark.Successful, r.Benchmark.Failed, r.Blocks.Count)
+		})
+	}
+}
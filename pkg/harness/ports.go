@@ -0,0 +1,72 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package harness
+
+import (
+	"net"
+	"strconv"
+
+	"orion-bench/pkg/types"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	maxPort         = 65535
+	maxPortAttempts = 100
+)
+
+// allocatePorts finds a range of contiguous free ports for each of the given sizes, and returns their base ports.
+// All the ports are held until all the ranges are found, so the ranges do not overlap.
+// They are released before returning, so they must be used shortly after, and may be taken by another process
+// meanwhile (see Harness.start).
+func allocatePorts(sizes ...int) ([]types.Port, error) {
+	var listeners []net.Listener
+	defer func() {
+		for _, l := range listeners {
+			_ = l.Close()
+		}
+	}()
+
+	bases := make([]types.Port, len(sizes))
+	for i, size := range sizes {
+		found := false
+		for attempt := 0; attempt < maxPortAttempts && !found; attempt++ {
+			// A failed base port is held until the end, so it is not attempted again
+			l, err := net.Listen("tcp", ":0")
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to allocate a port")
+			}
+			listeners = append(listeners, l)
+			base := l.Addr().(*net.TCPAddr).Port
+			if held, ok := listenRange(base+1, size-1); ok {
+				listeners = append(listeners, held...)
+				bases[i] = types.Port(base)
+				found = true
+			}
+		}
+		if !found {
+			return nil, errors.Errorf("failed to find %d contiguous free ports", size)
+		}
+	}
+	return bases, nil
+}
+
+// listenRange listens on count ports from the first port. If any of them is not free, it releases the rest.
+func listenRange(first int, count int) ([]net.Listener, bool) {
+	if first+count-1 > maxPort {
+		return nil, false
+	}
+	var listeners []net.Listener
+	for port := first; port < first+count; port++ {
+		l, err := net.Listen("tcp", net.JoinHostPort("", strconv.Itoa(port)))
+		if err != nil {
+			for _, held := range listeners {
+				_ = held.Close()
+			}
+			return nil, false
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, true
+}
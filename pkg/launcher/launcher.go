@@ -0,0 +1,330 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package launcher
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"orion-bench/pkg/material"
+	"orion-bench/pkg/types"
+
+	"github.com/hyperledger-labs/orion-server/pkg/logger"
+	"github.com/pkg/errors"
+)
+
+const perm = 0766
+
+// readyPoll is the interval between two checks of the cluster's readiness.
+const readyPoll = time.Second
+
+// ReadyCheck returns nil once the cluster serves requests.
+type ReadyCheck func() error
+
+// Launcher runs an entire experiment on a single host.
+// It generates the material, starts all the node ranks (and the coordinator and prometheus, if configured) as
+// supervised child processes, waits for the cluster to be ready, and then runs the init, warmup and benchmark
+// of all the worker ranks in order. The output of each child is written to its own log file.
+// Everything is torn down at the end, or when the context is cancelled.
+type Launcher struct {
+	lg         *logger.SugarLogger
+	config     *types.BenchmarkConf
+	material   *material.BenchMaterial
+	configPath string
+	ready      ReadyCheck
+
+	lock     sync.Mutex
+	failure  error
+	services []*process
+}
+
+func New(
+	config *types.BenchmarkConf, benchMaterial *material.BenchMaterial, configPath string, ready ReadyCheck,
+	lg *logger.SugarLogger,
+) *Launcher {
+	return &Launcher{
+		lg:         lg,
+		config:     config,
+		material:   benchMaterial,
+		configPath: configPath,
+		ready:      ready,
+	}
+}
+
+// LogPath returns the directory of the child processes' logs.
+func (l *Launcher) LogPath() string {
+	return filepath.Join(l.config.Path.Metrics, "logs")
+}
+
+// CheckLocal returns an error if any of the nodes, workers or the coordinator is not an address of this host.
+func (l *Launcher) CheckLocal() error {
+	localAddresses, err := net.InterfaceAddrs()
+	if err != nil {
+		return errors.Wrap(err, "failed to list the host's addresses")
+	}
+	check := func(kind string, index int, address string) error {
+		local, err := isLocal(address, localAddresses)
+		if err != nil {
+			return errors.Wrapf(err, "failed to resolve %s %d address: %s", kind, index, address)
+		}
+		if !local {
+			return errors.Errorf("%s %d address is not local: %s", kind, index, address)
+		}
+		return nil
+	}
+
+	for i, address := range l.config.Cluster.Nodes {
+		if err = check("node", i, address); err != nil {
+			return err
+		}
+	}
+	for i, address := range l.config.Workload.Workers {
+		if err = check("worker", i, address); err != nil {
+			return err
+		}
+	}
+	if address := l.config.Workload.Coordinator.Address; address != "" {
+		return check("coordinator", 0, address)
+	}
+	return nil
+}
+
+func isLocal(address string, localAddresses []net.Addr) (bool, error) {
+	ips := []net.IP{net.ParseIP(address)}
+	if ips[0] == nil {
+		var err error
+		if ips, err = net.LookupIP(address); err != nil {
+			return false, err
+		}
+	}
+	for _, ip := range ips {
+		if ip.IsLoopback() || ip.IsUnspecified() {
+			continue
+		}
+		found := false
+		for _, a := range localAddresses {
+			if ipNet, ok := a.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Run executes the experiment until it ends or until the context is cancelled.
+// Once the context is cancelled, the running workers are stopped gracefully, so they save their reports.
+func (l *Launcher) Run(ctx context.Context) error {
+	if err := l.CheckLocal(); err != nil {
+		return err
+	}
+	if err := l.material.Generate(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(l.LogPath(), perm); err != nil {
+		return err
+	}
+
+	// The context is cancelled before the services are stopped, so their exit is not reported as a failure
+	defer l.stopServices()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for rank := range l.config.Cluster.Nodes {
+		if err := l.startService(ctx, cancel, fmt.Sprintf("node-%d", rank), "-rank", strconv.Itoa(rank), "-node"); err != nil {
+			return err
+		}
+	}
+	if l.config.Workload.Coordinator.Address != "" {
+		if err := l.startService(ctx, cancel, "coordinator", "-coordinator"); err != nil {
+			return err
+		}
+	}
+	if l.config.Local.Prometheus {
+		if err := l.startService(ctx, cancel, "prometheus", "-prometheus"); err != nil {
+			return err
+		}
+	}
+
+	if err := l.waitReady(ctx); err != nil {
+		return err
+	}
+	if err := l.runStep(ctx, "init", false); err != nil {
+		return err
+	}
+	if err := l.runStep(ctx, "warmup", true); err != nil {
+		return err
+	}
+	if err := l.runStep(ctx, "benchmark", true); err != nil {
+		return err
+	}
+	if err := l.runStep(ctx, "report", false); err != nil {
+		return err
+	}
+	l.lg.Infof("Experiment ended. Logs saved to: %s", l.LogPath())
+	return nil
+}
+
+func (l *Launcher) args(args ...string) []string {
+	return append([]string{"-config", l.configPath}, args...)
+}
+
+func (l *Launcher) start(name string, args ...string) (*process, error) {
+	bin, err := os.Executable()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find the executable")
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	logPath := filepath.Join(l.LogPath(), name+".log")
+	return startProcess(l.lg, name, logPath, dir, bin, l.args(args...)...)
+}
+
+// startService starts a process that should run until the end of the experiment.
+// If it exits before that, the experiment is cancelled.
+func (l *Launcher) startService(ctx context.Context, cancel context.CancelFunc, name string, args ...string) error {
+	p, err := l.start(name, args...)
+	if err != nil {
+		return err
+	}
+	l.lock.Lock()
+	l.services = append(l.services, p)
+	l.lock.Unlock()
+
+	go func() {
+		select {
+		case <-p.Done():
+			if ctx.Err() != nil {
+				return
+			}
+			if err := p.Wait(); err != nil {
+				l.fail(err)
+			} else {
+				l.fail(errors.Errorf("%s exited unexpectedly (see %s)", name, p.logPath))
+			}
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return nil
+}
+
+// stopServices stops the services in the reverse order of their start.
+func (l *Launcher) stopServices() {
+	l.lock.Lock()
+	services := l.services
+	l.services = nil
+	l.lock.Unlock()
+	for i := len(services) - 1; i >= 0; i-- {
+		services[i].Stop(l.config.Local.StopTimeout)
+	}
+}
+
+func (l *Launcher) fail(err error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.failure == nil {
+		l.lg.Errorf("Experiment failed: %s", err)
+		l.failure = err
+	}
+}
+
+// cancelled returns the reason the experiment was cancelled.
+func (l *Launcher) cancelled(ctx context.Context) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.failure != nil {
+		return l.failure
+	}
+	return errors.Wrap(ctx.Err(), "experiment stopped")
+}
+
+// waitReady waits until the cluster serves requests, or until the ready timeout.
+func (l *Launcher) waitReady(ctx context.Context) error {
+	l.lg.Infof("Waiting for the cluster to be ready.")
+	deadline := time.Now().Add(l.config.Local.ReadyTimeout)
+	for {
+		err := l.ready()
+		if err == nil {
+			l.lg.Infof("Cluster is ready.")
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return errors.Wrapf(err, "cluster is not ready after %s", l.config.Local.ReadyTimeout)
+		}
+		l.lg.Debugf("Cluster is not ready: %s", err)
+		select {
+		case <-ctx.Done():
+			return l.cancelled(ctx)
+		case <-time.After(readyPoll):
+		}
+	}
+}
+
+// runStep runs an action and waits for it to end. If perWorker is set, it runs the action of all the worker ranks
+// in parallel. If the context is cancelled, the step's processes are stopped gracefully.
+func (l *Launcher) runStep(ctx context.Context, action string, perWorker bool) error {
+	if ctx.Err() != nil {
+		return l.cancelled(ctx)
+	}
+	l.lg.Infof("Running step: %s", action)
+
+	var processes []*process
+	stopAll := func() {
+		for _, p := range processes {
+			p.Signal(syscall.SIGTERM)
+		}
+	}
+	if !perWorker {
+		p, err := l.start(action, "-"+action)
+		if err != nil {
+			return err
+		}
+		processes = append(processes, p)
+	} else {
+		for rank := range l.config.Workload.Workers {
+			p, err := l.start(fmt.Sprintf("%s-%d", action, rank), "-rank", strconv.Itoa(rank), "-"+action)
+			if err != nil {
+				for _, started := range processes {
+					started.Stop(l.config.Local.StopTimeout)
+				}
+				return err
+			}
+			processes = append(processes, p)
+		}
+	}
+
+	stepDone := make(chan struct{})
+	defer close(stepDone)
+	go func() {
+		select {
+		case <-ctx.Done():
+			l.lg.Infof("Stopping step: %s", action)
+			stopAll()
+		case <-stepDone:
+		}
+	}()
+
+	var firstErr error
+	for _, p := range processes {
+		if err := p.Wait(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if ctx.Err() != nil {
+		return l.cancelled(ctx)
+	}
+	return errors.WithMessagef(firstErr, "step %s failed", action)
+}
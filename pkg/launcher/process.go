@@ -0,0 +1,96 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package launcher
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/hyperledger-labs/orion-server/pkg/logger"
+	"github.com/pkg/errors"
+)
+
+// process is a supervised child process whose output is written to a log file.
+// The child runs in its own process group, so a terminal's Ctrl-C only reaches the launcher,
+// which stops its children in order.
+type process struct {
+	lg      *logger.SugarLogger
+	name    string
+	logPath string
+	cmd     *exec.Cmd
+	done    chan struct{}
+	err     error
+}
+
+func startProcess(lg *logger.SugarLogger, name string, logPath string, dir string, bin string, args ...string) (*process, error) {
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create the log of %s", name)
+	}
+
+	cmd := exec.Command(bin, args...)
+	cmd.Dir = dir
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err = cmd.Start(); err != nil {
+		_ = logFile.Close()
+		return nil, errors.Wrapf(err, "failed to start %s", name)
+	}
+	lg.Infof("Started %s (PID %d), log: %s", name, cmd.Process.Pid, logPath)
+
+	p := &process{
+		lg:      lg,
+		name:    name,
+		logPath: logPath,
+		cmd:     cmd,
+		done:    make(chan struct{}),
+	}
+	go func() {
+		err := cmd.Wait()
+		_ = logFile.Close()
+		if err != nil {
+			p.err = errors.Wrapf(err, "%s failed (see %s)", name, logPath)
+		}
+		close(p.done)
+	}()
+	return p, nil
+}
+
+// Done is closed when the process exits.
+func (p *process) Done() <-chan struct{} {
+	return p.done
+}
+
+// Wait waits for the process to exit, and returns an error if it did not exit successfully.
+func (p *process) Wait() error {
+	<-p.done
+	return p.err
+}
+
+// Signal sends a signal to the process group. It is ignored if the process already exited.
+func (p *process) Signal(sig syscall.Signal) {
+	select {
+	case <-p.done:
+		return
+	default:
+	}
+	if err := syscall.Kill(-p.cmd.Process.Pid, sig); err != nil && err != syscall.ESRCH {
+		p.lg.Warnf("Failed to signal %s: %s", p.name, err)
+	}
+}
+
+// Stop terminates the process gracefully, and kills it if it did not exit after the timeout.
+func (p *process) Stop(timeout time.Duration) {
+	p.Signal(syscall.SIGTERM)
+	select {
+	case <-p.done:
+	case <-time.After(timeout):
+		p.lg.Warnf("%s did not stop after %s. Killing it.", p.name, timeout)
+		p.Signal(syscall.SIGKILL)
+		<-p.done
+	}
+	p.lg.Infof("Stopped %s.", p.name)
+}
@@ -3,20 +3,34 @@
 package material
 
 import (
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
 	"encoding/pem"
 	"fmt"
+	"math/big"
+	"net"
 	"os"
+	"path/filepath"
+	"sort"
 	"sync/atomic"
+	"time"
 	"unsafe"
 
-	"orion-bench/pkg/utils"
+	"orion-bench/pkg/types"
 
 	"github.com/hyperledger-labs/orion-sdk-go/pkg/config"
 	"github.com/hyperledger-labs/orion-server/pkg/crypto"
 	"github.com/hyperledger-labs/orion-server/pkg/logger"
-	"github.com/hyperledger-labs/orion-server/pkg/server/testutils"
+	"github.com/pkg/errors"
 )
 
 const (
@@ -24,9 +38,12 @@ const (
 	Admin        = "admin"
 	prefixUser   = "user-"
 	prefixNode   = "node-"
+	prefixCA     = "ca-"
 	fmtUserIndex = "U%05d"
 	fmtNodeIndex = "N%05d"
+	fmtCAIndex   = "I%05d"
 	fmtSubject   = "Orion %s CA"
+	suffixTLS    = ".tls"
 	perm         = 0766
 	userHost     = "127.0.0.1"
 )
@@ -37,41 +54,217 @@ type CryptoMaterial struct {
 	path string
 
 	// Evaluated lazily
-	cert    *x509.Certificate
 	signer  unsafe.Pointer
 	keyPair *tls.Certificate
 }
 
-func (u *CryptoMaterial) Check(err error) {
-	utils.Check(u.lg, err)
-}
-
 func (u *CryptoMaterial) subject() string {
 	return fmt.Sprintf(fmtSubject, u.name)
 }
 
-func (u *CryptoMaterial) write(cert []byte, key []byte) {
+func (u *CryptoMaterial) write(cert []byte, key []byte) error {
 	for filePath, data := range map[string][]byte{u.CertPath(): cert, u.KeyPath(): key} {
-		u.Check(os.WriteFile(filePath, data, perm))
+		if err := os.WriteFile(filePath, data, perm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MinRSABits is the minimal size of the generated RSA keys.
+const MinRSABits = 1024
+
+var curves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+// Curves returns the names of the supported ECDSA curves, sorted.
+func Curves() []string {
+	var names []string
+	for name := range curves {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	return names
 }
 
-func (u *CryptoMaterial) generateRoot() {
+// IsCurve returns true if the ECDSA curve is supported.
+func IsCurve(name string) bool {
+	_, ok := curves[name]
+	return ok
+}
+
+func checkKeyConf(conf *types.KeyConf) error {
+	switch conf.Type {
+	case types.ECDSAKey:
+		if _, ok := curves[conf.Curve]; !ok {
+			return errors.Errorf("unsupported ECDSA curve: %s", conf.Curve)
+		}
+	case types.RSAKey:
+		if conf.RSABits < MinRSABits {
+			return errors.Errorf("RSA keys must have at least %d bits, got: %d", MinRSABits, conf.RSABits)
+		}
+	case types.Ed25519Key:
+	default:
+		return errors.Errorf("unsupported key type: %s", conf.Type)
+	}
+	return nil
+}
+
+// generateKey generates a private key with the configured algorithm.
+func generateKey(conf *types.KeyConf) (gocrypto.Signer, error) {
+	if err := checkKeyConf(conf); err != nil {
+		return nil, err
+	}
+	switch conf.Type {
+	case types.RSAKey:
+		return rsa.GenerateKey(rand.Reader, conf.RSABits)
+	case types.Ed25519Key:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	default:
+		return ecdsa.GenerateKey(curves[conf.Curve], rand.Reader)
+	}
+}
+
+// KeyAlgorithm describes the key algorithm of a certificate in the same format as types.KeyConf.
+func KeyAlgorithm(cert *x509.Certificate) string {
+	switch pub := cert.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		return fmt.Sprintf("%s %s", types.ECDSAKey, pub.Curve.Params().Name)
+	case *rsa.PublicKey:
+		return fmt.Sprintf("%s %d", types.RSAKey, pub.N.BitLen())
+	case ed25519.PublicKey:
+		return string(types.Ed25519Key)
+	default:
+		return fmt.Sprintf("unknown (%T)", pub)
+	}
+}
+
+func certTemplate(subject string, host string, validity time.Duration) (*x509.Certificate, error) {
+	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
+	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: subject},
+		SerialNumber:          serialNumber,
+		NotBefore:             time.Now().Add(-5 * time.Minute),
+		NotAfter:              time.Now().Add(validity),
+		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+	return template, nil
+}
+
+// issue generates a key and a certificate that is signed by the parent.
+// If parent is nil, the certificate is self-signed.
+func (u *CryptoMaterial) issue(template *x509.Certificate, parent *CryptoMaterial, keyConf *types.KeyConf) error {
+	privKey, err := generateKey(keyConf)
+	if err != nil {
+		return err
+	}
+
+	parentCert, parentKey := template, gocrypto.PrivateKey(privKey)
+	if parent != nil {
+		parentKeyPair, err := parent.KeyPair()
+		if err != nil {
+			return errors.Wrapf(err, "failed to load the issuer %s", parent.PathName())
+		}
+		if parentCert, err = x509.ParseCertificate(parentKeyPair.Certificate[0]); err != nil {
+			return err
+		}
+		parentKey = parentKeyPair.PrivateKey
+	}
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, parentCert, privKey.Public(), parentKey)
+	if err != nil {
+		return err
+	}
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(privKey)
+	if err != nil {
+		return err
+	}
+
+	return u.write(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes}),
+	)
+}
+
+// identityTemplate returns a certificate template for an identity (root CA, user or node).
+// Orion's signer always signs a SHA-256 digest, and its verifier uses the certificate's signature algorithm.
+// So the identities' certificates must be signed with ECDSA-SHA256, regardless of the curve.
+func (u *CryptoMaterial) identityTemplate(host string, conf *types.CryptoConf) (*x509.Certificate, error) {
+	template, err := certTemplate(u.subject(), host, conf.Validity)
+	if err != nil {
+		return nil, err
+	}
+	template.SignatureAlgorithm = x509.ECDSAWithSHA256
+	return template, nil
+}
+
+// caTemplate returns a certificate template for a root or an intermediate CA.
+func (u *CryptoMaterial) caTemplate(conf *types.CryptoConf) (*x509.Certificate, error) {
+	template, err := u.identityTemplate(userHost, conf)
+	if err != nil {
+		return nil, err
+	}
+	template.IsCA = true
+	template.KeyUsage |= x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	return template, nil
+}
+
+func (u *CryptoMaterial) generateRoot(conf *types.CryptoConf) error {
 	if u.name != Root {
-		u.lg.Fatalf("Attempt to generate root certificate with non root user (%s).", u.name)
+		return errors.Errorf("attempt to generate root certificate with non root user (%s)", u.name)
 	}
-	pemCert, privKey, err := testutils.GenerateRootCA(u.subject(), userHost)
-	u.Check(err)
-	u.write(pemCert, privKey)
+	template, err := u.caTemplate(conf)
+	if err != nil {
+		return err
+	}
+	return u.issue(template, nil, &conf.Identity)
 }
 
-func (u *CryptoMaterial) generate(root *CryptoMaterial, host string) {
+// generateIntermediate generates an intermediate CA that can only issue end-entity certificates.
+func (u *CryptoMaterial) generateIntermediate(root *CryptoMaterial, conf *types.CryptoConf) error {
 	if u.name == Root {
-		u.lg.Fatalf("Attempt to generate non-root certificate with root user.")
+		return errors.New("attempt to generate intermediate certificate with root user")
+	}
+	template, err := u.caTemplate(conf)
+	if err != nil {
+		return err
+	}
+	template.MaxPathLenZero = true
+	return u.issue(template, root, &conf.Identity)
+}
+
+func (u *CryptoMaterial) generate(issuer *CryptoMaterial, host string, conf *types.CryptoConf) error {
+	if u.name == Root {
+		return errors.New("attempt to generate non-root certificate with root user")
+	}
+	template, err := u.identityTemplate(host, conf)
+	if err != nil {
+		return err
 	}
-	pemCert, privKey, err := testutils.IssueCertificate(u.subject(), host, *root.KeyPair())
-	u.Check(err)
-	u.write(pemCert, privKey)
+	return u.issue(template, issuer, &conf.Identity)
+}
+
+// generateTLS issues a TLS certificate that is valid for the host, whether it is an IP address or a DNS name.
+func (u *CryptoMaterial) generateTLS(issuer *CryptoMaterial, host string, conf *types.CryptoConf) error {
+	template, err := certTemplate(u.subject(), host, conf.Validity)
+	if err != nil {
+		return err
+	}
+	return u.issue(template, issuer, &conf.TLS)
 }
 
 func (u *CryptoMaterial) Name() string {
@@ -94,52 +287,84 @@ func (u *CryptoMaterial) Config() *config.UserConfig {
 	}
 }
 
+// TLSCrypto returns the TLS certificate and key of this entity.
+func (u *CryptoMaterial) TLSCrypto() *CryptoMaterial {
+	return &CryptoMaterial{
+		lg:   u.lg,
+		name: u.name,
+		path: u.path + suffixTLS,
+	}
+}
+
 func (u *CryptoMaterial) TLS() config.ClientTLSConfig {
+	tlsCrypto := u.TLSCrypto()
 	return config.ClientTLSConfig{
-		//ClientCertificatePath: u.CertPath(),
-		//ClientKeyPath:         u.KeyPath(),
+		ClientCertificatePath: tlsCrypto.CertPath(),
+		ClientKeyPath:         tlsCrypto.KeyPath(),
 	}
 }
 
-func (u *CryptoMaterial) Cert() *x509.Certificate {
+// PathName is the name of the material files, without the directory and extension.
+func (u *CryptoMaterial) PathName() string {
+	return filepath.Base(u.path)
+}
+
+// Exists returns true if both the certificate and the key files exist.
+func (u *CryptoMaterial) Exists() bool {
+	for _, filePath := range []string{u.CertPath(), u.KeyPath()} {
+		if _, err := os.Stat(filePath); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (u *CryptoMaterial) Cert() (*x509.Certificate, error) {
 	b, err := os.ReadFile(u.CertPath())
-	u.Check(err)
+	if err != nil {
+		return nil, err
+	}
 	bl, _ := pem.Decode(b)
 	if bl == nil {
-		u.lg.Fatalf("No certificate found in file: %s", u.CertPath())
+		return nil, errors.Errorf("No certificate found in file: %s", u.CertPath())
 	}
-	certRaw := bl.Bytes
-	cert, err := x509.ParseCertificate(certRaw)
-	u.Check(err)
+	return x509.ParseCertificate(bl.Bytes)
+}
 
-	u.cert = cert
-	return cert
+// Fingerprint returns the SHA-256 digest of the certificate.
+func Fingerprint(cert *x509.Certificate) string {
+	digest := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(digest[:])
 }
 
-func (u *CryptoMaterial) Signer() crypto.Signer {
+func (u *CryptoMaterial) Signer() (crypto.Signer, error) {
 	signerPtr := atomic.LoadPointer(&u.signer)
 	if signerPtr != nil {
-		return *(*crypto.Signer)(signerPtr)
+		return *(*crypto.Signer)(signerPtr), nil
 	}
 	signer, err := crypto.NewSigner(&crypto.SignerOptions{
 		Identity:    u.name,
 		KeyFilePath: u.KeyPath(),
 	})
-	u.Check(err)
+	if err != nil {
+		return nil, err
+	}
 	swapped := atomic.CompareAndSwapPointer(&u.signer, nil, unsafe.Pointer(&signer))
 	if swapped {
-		return signer
+		return signer, nil
 	}
-	return *(*crypto.Signer)(atomic.LoadPointer(&u.signer))
+	return *(*crypto.Signer)(atomic.LoadPointer(&u.signer)), nil
 }
 
-func (u *CryptoMaterial) KeyPair() *tls.Certificate {
+func (u *CryptoMaterial) KeyPair() (*tls.Certificate, error) {
 	if u.keyPair != nil {
-		return u.keyPair
+		return u.keyPair, nil
 	}
 	keyPair, err := tls.LoadX509KeyPair(u.CertPath(), u.KeyPath())
-	u.Check(err)
+	if err != nil {
+		return nil, err
+	}
 
 	u.keyPair = &keyPair
-	return u.keyPair
+	return u.keyPair, nil
 }
@@ -0,0 +1,123 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package material
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"orion-bench/pkg/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCurves(t *testing.T) {
+	require.Equal(t, []string{"P-256", "P-384", "P-521"}, Curves())
+	require.True(t, IsCurve("P-384"))
+	require.False(t, IsCurve("P-224"))
+}
+
+func TestGenerateKey(t *testing.T) {
+	for _, tc := range []struct {
+		conf types.KeyConf
+		err  string
+	}{
+		{conf: types.KeyConf{Type: types.ECDSAKey, Curve: "P-256"}},
+		{conf: types.KeyConf{Type: types.ECDSAKey, Curve: "P-384"}},
+		{conf: types.KeyConf{Type: types.ECDSAKey, Curve: "P-521"}},
+		{conf: types.KeyConf{Type: types.RSAKey, RSABits: MinRSABits}},
+		{conf: types.KeyConf{Type: types.RSAKey, RSABits: 2048}},
+		{conf: types.KeyConf{Type: types.Ed25519Key}},
+		{conf: types.KeyConf{Type: types.ECDSAKey, Curve: "P-224"}, err: "unsupported ECDSA curve: P-224"},
+		{conf: types.KeyConf{Type: types.RSAKey, RSABits: 512}, err: "RSA keys must have at least 1024 bits, got: 512"},
+		{conf: types.KeyConf{Type: "dsa"}, err: "unsupported key type: dsa"},
+	} {
+		t.Run(tc.conf.String(), func(t *testing.T) {
+			key, err := generateKey(&tc.conf)
+			if tc.err != "" {
+				require.EqualError(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+
+			// The algorithm of a certificate with the generated key is described the same as its configuration
+			template, err := certTemplate("test", userHost, time.Hour)
+			require.NoError(t, err)
+			der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+			require.NoError(t, err)
+			cert, err := x509.ParseCertificate(der)
+			require.NoError(t, err)
+			require.Equal(t, tc.conf.String(), KeyAlgorithm(cert))
+		})
+	}
+
+	require.Equal(t, "unknown (<nil>)", KeyAlgorithm(&x509.Certificate{}))
+}
+
+func TestGenerateKeyAlgorithms(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		identity types.KeyConf
+		tls      types.KeyConf
+		err      string
+	}{
+		{
+			name:     "ecdsa",
+			identity: types.KeyConf{Type: types.ECDSAKey, Curve: "P-384"},
+			tls:      types.KeyConf{Type: types.ECDSAKey, Curve: "P-521"},
+		},
+		{
+			name:     "rsa TLS",
+			identity: types.KeyConf{Type: types.ECDSAKey, Curve: "P-256"},
+			tls:      types.KeyConf{Type: types.RSAKey, RSABits: 2048},
+		},
+		{
+			name:     "ed25519 TLS",
+			identity: types.KeyConf{Type: types.ECDSAKey, Curve: "P-256"},
+			tls:      types.KeyConf{Type: types.Ed25519Key},
+		},
+		{
+			// Orion's verifier requires the identities to be signed with ECDSA-SHA256
+			name:     "rsa identity",
+			identity: types.KeyConf{Type: types.RSAKey, RSABits: 2048},
+			tls:      types.KeyConf{Type: types.ECDSAKey, Curve: "P-256"},
+			err:      "requested SignatureAlgorithm does not match private key type",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := testConfig(t)
+			conf.Material.Crypto.Identity = tc.identity
+			conf.Material.Crypto.TLS = tc.tls
+			conf.Material.CA.Intermediates = 1
+			m := newTestMaterial(t, conf)
+			err := m.Generate()
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.True(t, m.Validate().Passed(), m.Validate().Text())
+
+			for _, c := range []*CryptoMaterial{m.RootUser(), m.Intermediate(0), m.AdminUser(), m.Node(0).Crypto} {
+				cert := mustCert(t, c)
+				require.Equal(t, tc.identity.String(), KeyAlgorithm(cert), c.PathName())
+				require.Equal(t, x509.ECDSAWithSHA256, cert.SignatureAlgorithm, c.PathName())
+			}
+			for _, c := range []*CryptoMaterial{m.AdminUser().TLSCrypto(), m.Node(0).Crypto.TLSCrypto()} {
+				cert := mustCert(t, c)
+				require.Equal(t, tc.tls.String(), KeyAlgorithm(cert), c.PathName())
+				// The TLS certificates are signed by the root CA with the identity algorithm
+				require.NoError(t, cert.CheckSignatureFrom(mustCert(t, m.RootUser())), c.PathName())
+			}
+		})
+	}
+}
+
+// mustCert returns the certificate of the material.
+func mustCert(t *testing.T, c *CryptoMaterial) *x509.Certificate {
+	cert, err := c.Cert()
+	require.NoError(t, err)
+	return cert
+}
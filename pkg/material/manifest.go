@@ -0,0 +1,421 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package material
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"orion-bench/pkg/types"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const manifestFile = "manifest.yaml"
+
+// ManifestEntry records a generated certificate.
+type ManifestEntry struct {
+	Host        string `yaml:"host"`
+	Algorithm   string `yaml:"algorithm"`
+	Fingerprint string `yaml:"fingerprint"`
+}
+
+// Manifest records the generated material, so it can be updated incrementally.
+type Manifest struct {
+	TLSMode  types.TLSMode             `yaml:"tls-mode"`
+	Crypto   types.CryptoConf          `yaml:"crypto"`
+	CA       types.CAConf              `yaml:"ca"`
+	Nodes    []string                  `yaml:"nodes"`
+	Workers  []string                  `yaml:"workers"`
+	Material map[string]*ManifestEntry `yaml:"material"`
+}
+
+type Status string
+
+const (
+	// StatusOK is a material that matches the manifest and was issued by the current root CA
+	StatusOK Status = "ok"
+	// StatusMissing is a material that is required by the configuration, but does not exist
+	StatusMissing Status = "missing"
+	// StatusStale is a material that does not match the manifest, its issuer CA, the host, or the key algorithm
+	StatusStale Status = "stale"
+	// StatusOrphaned is a material that exists, but is not required by the configuration
+	StatusOrphaned Status = "orphaned"
+)
+
+// InventoryEntry is the status of a single material.
+type InventoryEntry struct {
+	Name   string
+	Status Status
+}
+
+// item is a material that is required by the configuration.
+type item struct {
+	crypto *CryptoMaterial
+	issuer *CryptoMaterial
+	host   string
+	isTLS  bool
+	isCA   bool
+}
+
+func (i *item) keyConf(conf *types.CryptoConf) *types.KeyConf {
+	if i.isTLS {
+		return &conf.TLS
+	}
+	return &conf.Identity
+}
+
+func (i *item) generate(conf *types.CryptoConf) error {
+	var err error
+	switch {
+	case i.isCA:
+		err = i.crypto.generateIntermediate(i.issuer, conf)
+	case i.isTLS:
+		err = i.crypto.generateTLS(i.issuer, i.host, conf)
+	default:
+		err = i.crypto.generate(i.issuer, i.host, conf)
+	}
+	return errors.Wrapf(err, "failed to generate %s", i.crypto.PathName())
+}
+
+// stages splits the items to the intermediate CAs and the rest, so the CAs are generated before the identities.
+func stages(items []*item) [][]*item {
+	var cas, rest []*item
+	for _, i := range items {
+		if i.isCA {
+			cas = append(cas, i)
+		} else {
+			rest = append(rest, i)
+		}
+	}
+	return [][]*item{cas, rest}
+}
+
+func (m *BenchMaterial) ManifestPath() string {
+	return filepath.Join(m.config.Path.Material, manifestFile)
+}
+
+// ReadManifest returns nil if the manifest does not exist.
+func (m *BenchMaterial) ReadManifest() (*Manifest, error) {
+	b, err := os.ReadFile(m.ManifestPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	manifest := &Manifest{}
+	if err = yaml.Unmarshal(b, manifest); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse the manifest: %s", m.ManifestPath())
+	}
+	if manifest.Material == nil {
+		manifest.Material = map[string]*ManifestEntry{}
+	}
+	return manifest, nil
+}
+
+// items returns all the material that is required by the configuration, except for the root CA.
+func (m *BenchMaterial) items() []*item {
+	root := m.RootUser()
+	var items []*item
+	for _, intermediate := range m.AllIntermediates() {
+		items = append(items, &item{crypto: intermediate, issuer: root, host: userHost, isCA: true})
+	}
+	items = append(items, &item{crypto: m.AdminUser(), issuer: m.issuer(false, 0), host: userHost})
+	for i, user := range m.AllUsers() {
+		items = append(items, &item{crypto: user, issuer: m.issuer(false, uint64(i)), host: userHost})
+	}
+	for i, node := range m.AllNodes() {
+		items = append(items, &item{crypto: node.Crypto, issuer: m.issuer(true, uint64(i)), host: node.Address})
+	}
+	if m.TLS().ClientAuthRequired() {
+		for _, user := range append([]*CryptoMaterial{m.AdminUser()}, m.AllUsers()...) {
+			items = append(items, &item{crypto: user.TLSCrypto(), issuer: root, host: userHost, isTLS: true})
+		}
+	}
+	if m.TLS().Enabled() {
+		for _, node := range m.AllNodes() {
+			items = append(items, &item{crypto: node.Crypto.TLSCrypto(), issuer: root, host: node.Address, isTLS: true})
+		}
+	}
+	return items
+}
+
+// caCerts returns the existing root and intermediate CAs' certificates by their path name.
+func (m *BenchMaterial) caCerts() map[string]*x509.Certificate {
+	certs := map[string]*x509.Certificate{}
+	for _, ca := range append([]*CryptoMaterial{m.RootUser()}, m.AllIntermediates()...) {
+		if cert, err := ca.Cert(); err == nil {
+			certs[ca.PathName()] = cert
+		}
+	}
+	return certs
+}
+
+// membership returns the cluster and workers' addresses that the node and prometheus configurations depend on.
+func (m *BenchMaterial) membership() ([]string, []string) {
+	var nodes, workers []string
+	for _, node := range m.AllNodes() {
+		nodes = append(nodes, fmt.Sprintf("%s:%d:%d:%d", node.Address, node.NodePort, node.PeerPort, node.PrometheusPort))
+	}
+	for _, worker := range m.AllWorkers() {
+		workers = append(workers, worker.PrometheusTargetAddress())
+	}
+	return nodes, workers
+}
+
+// status checks an existing material against the manifest, its issuer CA and the configured key algorithm.
+// Material with no manifest entry (e.g., generated before the manifest existed) is only checked against its issuer.
+func (m *BenchMaterial) status(i *item, manifest *Manifest, caCerts map[string]*x509.Certificate) Status {
+	if !i.crypto.Exists() {
+		return StatusMissing
+	}
+	cert, err := i.crypto.Cert()
+	if err != nil {
+		return StatusStale
+	}
+	if manifest != nil {
+		if entry, ok := manifest.Material[i.crypto.PathName()]; ok {
+			if entry.Fingerprint != Fingerprint(cert) || entry.Host != i.host {
+				return StatusStale
+			}
+		}
+	}
+	issuerCert, ok := caCerts[i.issuer.PathName()]
+	if !ok || cert.CheckSignatureFrom(issuerCert) != nil {
+		return StatusStale
+	}
+	if KeyAlgorithm(cert) != i.keyConf(m.Crypto()).String() {
+		return StatusStale
+	}
+	return StatusOK
+}
+
+// rootStatus checks the root CA against the manifest and the configured key algorithm.
+func (m *BenchMaterial) rootStatus(manifest *Manifest) Status {
+	root := m.RootUser()
+	if !root.Exists() {
+		return StatusMissing
+	}
+	cert, err := root.Cert()
+	if err != nil {
+		return StatusStale
+	}
+	if manifest != nil {
+		if entry, ok := manifest.Material[root.PathName()]; ok && entry.Fingerprint != Fingerprint(cert) {
+			return StatusStale
+		}
+	}
+	if KeyAlgorithm(cert) != m.Crypto().Identity.String() {
+		return StatusStale
+	}
+	return StatusOK
+}
+
+// orphans returns the existing material that is not required by the configuration.
+func (m *BenchMaterial) orphans(items []*item) ([]string, error) {
+	required := map[string]bool{m.RootUser().PathName(): true}
+	for _, i := range items {
+		required[i.crypto.PathName()] = true
+	}
+	var orphans []string
+	if _, err := os.Stat(m.config.Path.Material); err != nil {
+		return orphans, nil
+	}
+	names, err := m.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if !required[name] {
+			orphans = append(orphans, name)
+		}
+	}
+	sort.Strings(orphans)
+	return orphans, nil
+}
+
+// writeManifest records all the existing required material.
+func (m *BenchMaterial) writeManifest(items []*item) error {
+	nodes, workers := m.membership()
+	manifest := &Manifest{
+		TLSMode:  m.TLS().Mode,
+		Crypto:   *m.Crypto(),
+		CA:       *m.CA(),
+		Nodes:    nodes,
+		Workers:  workers,
+		Material: map[string]*ManifestEntry{},
+	}
+	rootItem := &item{crypto: m.RootUser(), host: userHost}
+	for _, i := range append([]*item{rootItem}, items...) {
+		cert, err := i.crypto.Cert()
+		if err != nil {
+			return err
+		}
+		manifest.Material[i.crypto.PathName()] = &ManifestEntry{
+			Host:        i.host,
+			Algorithm:   KeyAlgorithm(cert),
+			Fingerprint: Fingerprint(cert),
+		}
+	}
+	b, err := yaml.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(m.ManifestPath(), b, perm)
+}
+
+func (m *BenchMaterial) generateConfigs() error {
+	nodes := m.AllNodes()
+	err := parallel(len(nodes), func(i int) error {
+		return nodes[i].generateConfigs()
+	})
+	if err != nil {
+		return err
+	}
+	return m.Prometheus().Generate()
+}
+
+func (m *BenchMaterial) configsExist() bool {
+	paths := []string{m.Prometheus().path}
+	for _, node := range m.AllNodes() {
+		paths = append(paths, node.SharedConfPath(), node.LocalConfPath())
+	}
+	for _, p := range paths {
+		if _, err := os.Stat(p); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Update generates only the missing or stale material, and keeps the existing root CA.
+// The node and prometheus configurations are regenerated if the cluster membership, the CA hierarchy,
+// or any node's material changed.
+// If there is no root CA, all the material is generated.
+func (m *BenchMaterial) Update() error {
+	manifest, err := m.ReadManifest()
+	if err != nil {
+		return err
+	}
+	rootStatus := m.rootStatus(manifest)
+	if rootStatus != StatusOK {
+		m.lg.Infof("The root CA is %s, generating all the material.", rootStatus)
+		return m.Generate()
+	}
+
+	cryptoConf := m.Crypto()
+	items := m.items()
+	var lock sync.Mutex
+	var added, regenerated []string
+	nodesChanged := false
+	// The intermediate CAs are updated first, so the identities they issue are checked against the updated CAs
+	for _, stage := range stages(items) {
+		caCerts := m.caCerts()
+		var pending []*item
+		var statuses []Status
+		for _, i := range stage {
+			if status := m.status(i, manifest, caCerts); status != StatusOK {
+				pending = append(pending, i)
+				statuses = append(statuses, status)
+			}
+		}
+		err = parallel(len(pending), func(j int) error {
+			i := pending[j]
+			if err := i.generate(cryptoConf); err != nil {
+				return err
+			}
+			lock.Lock()
+			defer lock.Unlock()
+			if statuses[j] == StatusMissing {
+				added = append(added, i.crypto.PathName())
+			} else {
+				regenerated = append(regenerated, i.crypto.PathName())
+			}
+			if strings.HasPrefix(i.crypto.PathName(), prefixNode) {
+				nodesChanged = true
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	nodes, workers := m.membership()
+	if manifest == nil || nodesChanged || !m.configsExist() || manifest.TLSMode != m.TLS().Mode ||
+		manifest.CA != *m.CA() || !reflect.DeepEqual(manifest.Nodes, nodes) || !reflect.DeepEqual(manifest.Workers, workers) {
+		if err = m.generateConfigs(); err != nil {
+			return err
+		}
+		m.lg.Infof("Regenerated the node and prometheus configurations.")
+	}
+	if err = m.writeManifest(items); err != nil {
+		return err
+	}
+
+	sort.Strings(added)
+	sort.Strings(regenerated)
+	m.lg.Infof("Added %d material: %v", len(added), added)
+	m.lg.Infof("Regenerated %d stale material: %v", len(regenerated), regenerated)
+	m.lg.Infof("Kept %d existing material.", len(items)+1-len(added)-len(regenerated))
+	orphans, err := m.orphans(items)
+	if err != nil {
+		return err
+	}
+	if len(orphans) > 0 {
+		m.lg.Warnf("Orphaned material that is not required by the configuration: %v", orphans)
+	}
+	return nil
+}
+
+// Inventory returns the status of the required material and the orphaned material.
+func (m *BenchMaterial) Inventory() ([]*InventoryEntry, error) {
+	manifest, err := m.ReadManifest()
+	if err != nil {
+		return nil, err
+	}
+	rootStatus := m.rootStatus(manifest)
+	entries := []*InventoryEntry{{Name: m.RootUser().PathName(), Status: rootStatus}}
+	items := m.items()
+	caCerts := m.caCerts()
+	for _, i := range items {
+		entries = append(entries, &InventoryEntry{Name: i.crypto.PathName(), Status: m.status(i, manifest, caCerts)})
+	}
+	orphans, err := m.orphans(items)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range orphans {
+		entries = append(entries, &InventoryEntry{Name: name, Status: StatusOrphaned})
+	}
+	return entries, nil
+}
+
+// InventoryText returns the inventory as a human-readable table with a summary.
+func (m *BenchMaterial) InventoryText() (string, error) {
+	entries, err := m.Inventory()
+	if err != nil {
+		return "", err
+	}
+	buf := &bytes.Buffer{}
+	tw := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0)
+	counts := map[Status]int{}
+	for _, e := range entries {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\n", e.Name, e.Status)
+		counts[e.Status]++
+	}
+	_ = tw.Flush()
+	_, _ = fmt.Fprintf(buf, "ok: %d, missing: %d, stale: %d, orphaned: %d\n",
+		counts[StatusOK], counts[StatusMissing], counts[StatusStale], counts[StatusOrphaned])
+	return buf.String(), nil
+}
@@ -0,0 +1,365 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package material
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"orion-bench/pkg/types"
+
+	"github.com/creasty/defaults"
+	"github.com/hyperledger-labs/orion-server/pkg/logger"
+	"github.com/stretchr/testify/require"
+)
+
+// examplesPath holds the default node and prometheus configuration files that are used to generate the material.
+const examplesPath = "../../examples"
+
+// testConfig returns a configuration of two nodes, one worker and two users with mutual TLS.
+// Its paths are in a temporary directory of the test.
+func testConfig(t *testing.T) *types.BenchmarkConf {
+	conf := &types.BenchmarkConf{}
+	require.NoError(t, defaults.Set(conf))
+	dir := t.TempDir()
+	conf.Path.Material = filepath.Join(dir, "material")
+	conf.Path.Data = filepath.Join(dir, "data")
+	conf.Path.Metrics = filepath.Join(dir, "metrics")
+	var err error
+	for name, p := range map[string]*string{
+		"local-config.yaml":  &conf.Path.DefaultLocalConf,
+		"shared-config.yaml": &conf.Path.DefaultSharedConf,
+		"prometheus.yaml":    &conf.Path.DefaultPrometheusConf,
+	} {
+		*p, err = filepath.Abs(filepath.Join(examplesPath, name))
+		require.NoError(t, err)
+	}
+
+	conf.Cluster.Nodes = []string{"127.0.0.1", "127.0.0.1"}
+	conf.Cluster.NodeBasePort = 6001
+	conf.Cluster.PeerBasePort = 7050
+	conf.Cluster.PrometheusBasePort = 2000
+	conf.Cluster.TLS.Mode = types.MutualTLS
+	conf.Workload.Workers = []string{"127.0.0.1"}
+	conf.Workload.PrometheusBasePort = 2100
+	conf.Workload.UserCount = 2
+	return conf
+}
+
+// newTestMaterial returns the material of the configuration, as a new run would.
+func newTestMaterial(t *testing.T, conf *types.BenchmarkConf) *BenchMaterial {
+	lg, err := logger.New(&logger.Config{
+		Level:         "info",
+		OutputPath:    []string{"stdout"},
+		ErrOutputPath: []string{"stderr"},
+		Encoding:      "console",
+		Name:          "orion-bench-test",
+	})
+	require.NoError(t, err)
+	return New(conf, lg)
+}
+
+// inventory returns the status of each material by its path name.
+func inventory(t *testing.T, m *BenchMaterial) map[string]Status {
+	entries, err := m.Inventory()
+	require.NoError(t, err)
+	statuses := map[string]Status{}
+	for _, e := range entries {
+		statuses[e.Name] = e.Status
+	}
+	return statuses
+}
+
+// fingerprints returns the fingerprint of each existing material by its path name.
+func fingerprints(t *testing.T, m *BenchMaterial) map[string]string {
+	names, err := m.List()
+	require.NoError(t, err)
+	prints := map[string]string{}
+	for _, name := range names {
+		cert, err := (&CryptoMaterial{path: filepath.Join(m.config.Path.Material, name)}).Cert()
+		require.NoError(t, err)
+		prints[name] = Fingerprint(cert)
+	}
+	return prints
+}
+
+// requireStatuses verifies that each material has the expected status, and that the rest are ok.
+func requireStatuses(t *testing.T, m *BenchMaterial, expected map[string]Status) {
+	for name, status := range inventory(t, m) {
+		want, ok := expected[name]
+		if !ok {
+			want = StatusOK
+		}
+		require.Equal(t, want, status, name)
+	}
+}
+
+// requireChanged verifies that only the expected material was (re)generated since the fingerprints were taken.
+func requireChanged(t *testing.T, m *BenchMaterial, before map[string]string, changed ...string) {
+	isChanged := map[string]bool{}
+	for _, name := range changed {
+		isChanged[name] = true
+	}
+	for name, fingerprint := range fingerprints(t, m) {
+		prev, existed := before[name]
+		if isChanged[name] {
+			require.True(t, !existed || prev != fingerprint, "%s was not generated", name)
+		} else {
+			require.Equal(t, prev, fingerprint, "%s was regenerated", name)
+		}
+	}
+}
+
+// markConfig overwrites a node's local configuration, so a test can tell whether it was regenerated.
+func markConfig(t *testing.T, m *BenchMaterial) string {
+	path := m.Node(0).LocalConfPath()
+	require.NoError(t, os.WriteFile(path, []byte("marker"), perm))
+	return path
+}
+
+func requireMarked(t *testing.T, path string, marked bool) {
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, marked, string(b) == "marker")
+}
+
+func TestUpdateFromScratch(t *testing.T) {
+	conf := testConfig(t)
+	m := newTestMaterial(t, conf)
+
+	statuses := inventory(t, m)
+	require.Len(t, statuses, 11, "root, admin, 2 users, 2 nodes, and their TLS certificates")
+	for name, status := range statuses {
+		require.Equal(t, StatusMissing, status, name)
+	}
+
+	require.NoError(t, m.Update())
+	requireStatuses(t, m, nil)
+	for _, node := range m.AllNodes() {
+		require.FileExists(t, node.LocalConfPath())
+		require.FileExists(t, node.SharedConfPath())
+	}
+	require.FileExists(t, m.Prometheus().path)
+
+	manifest, err := m.ReadManifest()
+	require.NoError(t, err)
+	require.Equal(t, types.MutualTLS, manifest.TLSMode)
+	require.Equal(t, []string{"127.0.0.1:6001:7050:2000", "127.0.0.1:6002:7051:2001"}, manifest.Nodes)
+	require.Equal(t, []string{"127.0.0.1:2100"}, manifest.Workers)
+	require.Len(t, manifest.Material, 11)
+	require.Equal(t, &ManifestEntry{
+		Host:        "127.0.0.1",
+		Algorithm:   "ecdsa P-256",
+		Fingerprint: fingerprints(t, m)["node-N00001"],
+	}, manifest.Material["node-N00001"])
+}
+
+func TestUpdate(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		mutate func(t *testing.T, conf *types.BenchmarkConf, m *BenchMaterial)
+		// The material's status before the update, if it is not ok
+		statuses map[string]Status
+		// The material that the update generates
+		changed []string
+		// Whether the node configurations are regenerated
+		configs bool
+	}{
+		{
+			name:   "kept",
+			mutate: func(t *testing.T, conf *types.BenchmarkConf, m *BenchMaterial) {},
+		},
+		{
+			name: "added users",
+			mutate: func(t *testing.T, conf *types.BenchmarkConf, m *BenchMaterial) {
+				conf.Workload.UserCount = 3
+			},
+			statuses: map[string]Status{"user-U00002": StatusMissing, "user-U00002.tls": StatusMissing},
+			changed:  []string{"user-U00002", "user-U00002.tls"},
+		},
+		{
+			name: "missing key",
+			mutate: func(t *testing.T, conf *types.BenchmarkConf, m *BenchMaterial) {
+				require.NoError(t, os.Remove(m.User(1).KeyPath()))
+			},
+			statuses: map[string]Status{"user-U00001": StatusMissing},
+			changed:  []string{"user-U00001"},
+		},
+		{
+			name: "replaced certificate",
+			mutate: func(t *testing.T, conf *types.BenchmarkConf, m *BenchMaterial) {
+				// The certificate does not match the manifest, although it was issued by the root CA
+				require.NoError(t, m.User(0).generate(m.RootUser(), userHost, m.Crypto()))
+			},
+			statuses: map[string]Status{"user-U00000": StatusStale},
+			changed:  []string{"user-U00000"},
+		},
+		{
+			name: "TLS key algorithm",
+			mutate: func(t *testing.T, conf *types.BenchmarkConf, m *BenchMaterial) {
+				conf.Material.Crypto.TLS.Curve = "P-384"
+			},
+			statuses: map[string]Status{
+				"user-admin.tls":  StatusStale,
+				"user-U00000.tls": StatusStale,
+				"user-U00001.tls": StatusStale,
+				"node-N00000.tls": StatusStale,
+				"node-N00001.tls": StatusStale,
+			},
+			changed: []string{
+				"user-admin.tls", "user-U00000.tls", "user-U00001.tls", "node-N00000.tls", "node-N00001.tls",
+			},
+			configs: true,
+		},
+		{
+			name: "added node",
+			mutate: func(t *testing.T, conf *types.BenchmarkConf, m *BenchMaterial) {
+				conf.Cluster.Nodes = append(conf.Cluster.Nodes, "127.0.0.1")
+			},
+			statuses: map[string]Status{"node-N00002": StatusMissing, "node-N00002.tls": StatusMissing},
+			changed:  []string{"node-N00002", "node-N00002.tls"},
+			configs:  true,
+		},
+		{
+			name: "moved node",
+			mutate: func(t *testing.T, conf *types.BenchmarkConf, m *BenchMaterial) {
+				conf.Cluster.Nodes[1] = "localhost"
+			},
+			statuses: map[string]Status{"node-N00001": StatusStale, "node-N00001.tls": StatusStale},
+			changed:  []string{"node-N00001", "node-N00001.tls"},
+			configs:  true,
+		},
+		{
+			name: "added worker",
+			mutate: func(t *testing.T, conf *types.BenchmarkConf, m *BenchMaterial) {
+				conf.Workload.Workers = append(conf.Workload.Workers, "127.0.0.1")
+			},
+			configs: true,
+		},
+		{
+			name: "added intermediate CA",
+			mutate: func(t *testing.T, conf *types.BenchmarkConf, m *BenchMaterial) {
+				conf.Material.CA.Intermediates = 1
+			},
+			// The users are issued by the new intermediate CA, and the nodes are kept
+			statuses: map[string]Status{
+				"ca-I00000":   StatusMissing,
+				"user-admin":  StatusStale,
+				"user-U00000": StatusStale,
+				"user-U00001": StatusStale,
+			},
+			changed: []string{"ca-I00000", "user-admin", "user-U00000", "user-U00001"},
+			configs: true,
+		},
+		{
+			name: "root key algorithm",
+			mutate: func(t *testing.T, conf *types.BenchmarkConf, m *BenchMaterial) {
+				conf.Material.Crypto.Identity.Curve = "P-384"
+			},
+			// A stale root CA invalidates all the material
+			statuses: map[string]Status{
+				"user-root":   StatusStale,
+				"user-admin":  StatusStale,
+				"user-U00000": StatusStale,
+				"user-U00001": StatusStale,
+				"node-N00000": StatusStale,
+				"node-N00001": StatusStale,
+			},
+			changed: []string{
+				"user-root", "user-admin", "user-U00000", "user-U00001", "node-N00000", "node-N00001",
+				"user-admin.tls", "user-U00000.tls", "user-U00001.tls", "node-N00000.tls", "node-N00001.tls",
+			},
+			configs: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := testConfig(t)
+			require.NoError(t, newTestMaterial(t, conf).Generate())
+
+			m := newTestMaterial(t, conf)
+			before := fingerprints(t, m)
+			configPath := markConfig(t, m)
+			tc.mutate(t, conf, m)
+
+			m = newTestMaterial(t, conf)
+			requireStatuses(t, m, tc.statuses)
+			require.NoError(t, m.Update())
+			requireStatuses(t, m, nil)
+			requireChanged(t, m, before, tc.changed...)
+			requireMarked(t, configPath, !tc.configs)
+
+			// The update is idempotent
+			updated := fingerprints(t, m)
+			configPath = markConfig(t, m)
+			require.NoError(t, newTestMaterial(t, conf).Update())
+			requireChanged(t, m, updated)
+			requireMarked(t, configPath, true)
+		})
+	}
+}
+
+func TestUpdateOrphaned(t *testing.T) {
+	conf := testConfig(t)
+	require.NoError(t, newTestMaterial(t, conf).Generate())
+
+	// The removed user and the TLS certificates are no longer required
+	conf.Workload.UserCount = 1
+	conf.Cluster.TLS.Mode = types.TLSOff
+	m := newTestMaterial(t, conf)
+	before := fingerprints(t, m)
+	configPath := markConfig(t, m)
+	orphaned := map[string]Status{
+		"user-U00001":     StatusOrphaned,
+		"user-U00001.tls": StatusOrphaned,
+		"user-admin.tls":  StatusOrphaned,
+		"user-U00000.tls": StatusOrphaned,
+		"node-N00000.tls": StatusOrphaned,
+		"node-N00001.tls": StatusOrphaned,
+	}
+	requireStatuses(t, m, orphaned)
+
+	// The orphaned material is kept, and the configurations are regenerated without TLS
+	require.NoError(t, m.Update())
+	requireStatuses(t, m, orphaned)
+	requireChanged(t, m, before)
+	requireMarked(t, configPath, false)
+
+	text, err := m.InventoryText()
+	require.NoError(t, err)
+	require.Contains(t, text, "user-U00001      orphaned\n")
+	require.Contains(t, text, "ok: 5, missing: 0, stale: 0, orphaned: 6\n")
+}
+
+func TestUpdateWithoutManifest(t *testing.T) {
+	conf := testConfig(t)
+	m := newTestMaterial(t, conf)
+	require.NoError(t, m.Generate())
+	before := fingerprints(t, m)
+
+	// Material that was generated before the manifest existed is only checked against its issuer
+	require.NoError(t, os.Remove(m.ManifestPath()))
+	manifest, err := m.ReadManifest()
+	require.NoError(t, err)
+	require.Nil(t, manifest)
+	requireStatuses(t, m, nil)
+
+	require.NoError(t, m.Update())
+	requireChanged(t, m, before)
+	manifest, err = m.ReadManifest()
+	require.NoError(t, err)
+	require.Len(t, manifest.Material, 11)
+}
+
+func TestReadInvalidManifest(t *testing.T) {
+	conf := testConfig(t)
+	m := newTestMaterial(t, conf)
+	require.NoError(t, os.MkdirAll(conf.Path.Material, perm))
+	require.NoError(t, os.WriteFile(m.ManifestPath(), []byte("material: [1, 2]"), perm))
+
+	_, err := m.ReadManifest()
+	require.ErrorContains(t, err, "failed to parse the manifest: "+m.ManifestPath())
+	require.ErrorContains(t, m.Update(), "failed to parse the manifest")
+	_, err = m.Inventory()
+	require.ErrorContains(t, err, "failed to parse the manifest")
+}
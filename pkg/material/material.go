@@ -10,10 +10,11 @@ import (
 	"sync"
 
 	"orion-bench/pkg/types"
-	"orion-bench/pkg/utils"
 
 	sdkconfig "github.com/hyperledger-labs/orion-sdk-go/pkg/config"
+	"github.com/hyperledger-labs/orion-server/config"
 	"github.com/hyperledger-labs/orion-server/pkg/logger"
+	"github.com/pkg/errors"
 )
 
 type BenchMaterial struct {
@@ -24,6 +25,7 @@ type BenchMaterial struct {
 	prometheus *PrometheusMaterial
 }
 
+// New creates the material of the configuration, which should pass the config check first (see config.CheckConfig).
 func New(config *types.BenchmarkConf, lg *logger.SugarLogger) *BenchMaterial {
 	return &BenchMaterial{
 		lg:     lg,
@@ -31,6 +33,26 @@ func New(config *types.BenchmarkConf, lg *logger.SugarLogger) *BenchMaterial {
 	}
 }
 
+// parallel runs f(i) for i in [0, n) concurrently, and returns the first error.
+func parallel(n int, f func(i int) error) error {
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = f(i)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func userIndex(i uint64) string {
 	return fmt.Sprintf(fmtUserIndex, i)
 }
@@ -39,8 +61,8 @@ func nodeIndex(i uint64) string {
 	return fmt.Sprintf(fmtNodeIndex, i)
 }
 
-func (m *BenchMaterial) Check(err error) {
-	utils.Check(m.lg, err)
+func caIndex(i uint64) string {
+	return fmt.Sprintf(fmtCAIndex, i)
 }
 
 func (m *BenchMaterial) getCrypto(name string, pathName string) *CryptoMaterial {
@@ -74,6 +96,12 @@ func (m *BenchMaterial) User(i uint64) *CryptoMaterial {
 	return m.getUserCrypto(userIndex(i))
 }
 
+// Intermediate returns the i-th intermediate CA.
+func (m *BenchMaterial) Intermediate(i uint64) *CryptoMaterial {
+	name := caIndex(i)
+	return m.getCrypto(name, prefixCA+name)
+}
+
 func (m *BenchMaterial) Node(i uint64) *NodeMaterial {
 	name := nodeIndex(i)
 	server, ok := m.servers.Load(name)
@@ -116,39 +144,78 @@ func (m *BenchMaterial) Prometheus() *PrometheusMaterial {
 	}
 }
 
-func (m *BenchMaterial) Generate() {
-	m.Check(os.RemoveAll(m.config.Path.Material))
-	m.Check(os.MkdirAll(m.config.Path.Material, perm))
+// TLS returns the cluster's TLS configuration.
+func (m *BenchMaterial) TLS() *types.TLSConf {
+	return &m.config.Cluster.TLS
+}
 
-	root := m.RootUser()
-	root.generateRoot()
-	m.AdminUser().generate(root, userHost)
+// Crypto returns the configuration of the generated certificates.
+func (m *BenchMaterial) Crypto() *types.CryptoConf {
+	return &m.config.Material.Crypto
+}
 
-	var wg sync.WaitGroup
-	for _, user := range m.AllUsers() {
-		wg.Add(1)
-		go func(user *CryptoMaterial) {
-			user.generate(root, userHost)
-			wg.Done()
-		}(user)
+// CA returns the configuration of the CA hierarchy.
+func (m *BenchMaterial) CA() *types.CAConf {
+	return &m.config.Material.CA
+}
+
+// issuer returns the CA that issues the identity of a user or a node with the given index.
+// The admin is issued by the same CA as the first user.
+func (m *BenchMaterial) issuer(isNode bool, index uint64) *CryptoMaterial {
+	caConf := m.CA()
+	if caConf.Intermediates == 0 ||
+		(isNode && caConf.Issue == types.IssueUsers) || (!isNode && caConf.Issue == types.IssueNodes) {
+		return m.RootUser()
 	}
+	return m.Intermediate(index % caConf.Intermediates)
+}
 
-	for _, node := range m.AllNodes() {
-		wg.Add(1)
-		go func(node *NodeMaterial) {
-			node.generate()
-			wg.Done()
-		}(node)
+// CAConfig returns the root and intermediate CAs' certificates.
+func (m *BenchMaterial) CAConfig() config.CAConfiguration {
+	caConf := config.CAConfiguration{RootCACertsPath: []string{m.RootUser().CertPath()}}
+	for _, intermediate := range m.AllIntermediates() {
+		caConf.IntermediateCACertsPath = append(caConf.IntermediateCACertsPath, intermediate.CertPath())
 	}
+	return caConf
+}
 
-	wg.Wait()
+// Generate removes all the existing material and generates all the material from scratch.
+func (m *BenchMaterial) Generate() error {
+	if err := os.RemoveAll(m.config.Path.Material); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.config.Path.Material, perm); err != nil {
+		return err
+	}
+
+	cryptoConf := m.Crypto()
+	root := m.RootUser()
+	if err := root.generateRoot(cryptoConf); err != nil {
+		return errors.Wrapf(err, "failed to generate %s", root.PathName())
+	}
+	items := m.items()
+
+	// The intermediate CAs are generated before the identities they issue
+	for _, stage := range stages(items) {
+		err := parallel(len(stage), func(i int) error {
+			return stage[i].generate(cryptoConf)
+		})
+		if err != nil {
+			return err
+		}
+	}
 
-	m.Prometheus().Generate()
+	if err := m.generateConfigs(); err != nil {
+		return err
+	}
+	return m.writeManifest(items)
 }
 
-func (m *BenchMaterial) List() []string {
+func (m *BenchMaterial) List() ([]string, error) {
 	files, err := os.ReadDir(m.config.Path.Material)
-	m.Check(err)
+	if err != nil {
+		return nil, err
+	}
 	var material []string
 	for _, f := range files {
 		if f.IsDir() {
@@ -160,7 +227,7 @@ func (m *BenchMaterial) List() []string {
 		}
 		material = append(material, strings.TrimSuffix(f.Name(), ext))
 	}
-	return material
+	return material, nil
 }
 
 func (m *BenchMaterial) AllUsers() []*CryptoMaterial {
@@ -179,6 +246,14 @@ func (m *BenchMaterial) AllNodes() []*NodeMaterial {
 	return servers
 }
 
+func (m *BenchMaterial) AllIntermediates() []*CryptoMaterial {
+	var intermediates []*CryptoMaterial
+	for i := uint64(0); i < m.CA().Intermediates; i++ {
+		intermediates = append(intermediates, m.Intermediate(i))
+	}
+	return intermediates
+}
+
 func (m *BenchMaterial) AllWorkers() []*WorkerMaterial {
 	var workers []*WorkerMaterial
 	for i := range m.config.Workload.Workers {
@@ -187,13 +262,23 @@ func (m *BenchMaterial) AllWorkers() []*WorkerMaterial {
 	return workers
 }
 
+// Scheme returns the URL scheme of the nodes' endpoints.
+func (m *BenchMaterial) Scheme() string {
+	if m.TLS().Enabled() {
+		return "https"
+	}
+	//goland:noinspection HttpUrlsUsage
+	return "http"
+}
+
 func (m *BenchMaterial) ServerTLS() sdkconfig.ServerTLSConfig {
+	tlsConf := m.TLS()
+	if !tlsConf.Enabled() {
+		return sdkconfig.ServerTLSConfig{}
+	}
 	return sdkconfig.ServerTLSConfig{
-		Enabled: false,
-		//ClientAuthRequired: true,
-		//CaConfig: config.CAConfiguration{
-		//	RootCACertsPath:         []string{m.User(Root).CertPath()},
-		//	IntermediateCACertsPath: nil,
-		//},
+		Enabled:            true,
+		ClientAuthRequired: tlsConf.ClientAuthRequired(),
+		CaConfig:           m.CAConfig(),
 	}
 }
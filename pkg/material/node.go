@@ -3,10 +3,10 @@
 package material
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
-	"sync"
 	"time"
 
 	"orion-bench/pkg/types"
@@ -16,6 +16,7 @@ import (
 	"github.com/hyperledger-labs/orion-server/pkg/logger"
 	"github.com/hyperledger-labs/orion-server/pkg/server"
 	"github.com/hyperledger-labs/orion-server/test/setup"
+	"github.com/pkg/errors"
 	"github.com/spf13/viper"
 )
 
@@ -41,10 +42,6 @@ type NodeMaterial struct {
 	defaultConf *config.Configurations
 }
 
-func (s *NodeMaterial) Check(err error) {
-	utils.Check(s.lg, err)
-}
-
 func (s *NodeMaterial) SharedConfPath() string {
 	return s.materialPath + sharedConfSuffix
 }
@@ -65,53 +62,70 @@ func (s *NodeMaterial) SnapPath() string {
 	return filepath.Join(s.dataPath, "etcdraft", "snap")
 }
 
+func (s *NodeMaterial) AuxPath() string {
+	return filepath.Join(s.dataPath, "etcdraft", "aux")
+}
+
 func (s *NodeMaterial) PrometheusTargetAddress() string {
 	return fmt.Sprintf("%s:%d", s.Address, s.PrometheusPort)
 }
 
-func (s *NodeMaterial) generate() {
-	s.Crypto.generate(s.material.RootUser(), s.Address)
-	s.GenerateSharedConfFile()
-	s.GenerateServerConfigFile()
+func (s *NodeMaterial) generateConfigs() error {
+	if err := s.GenerateSharedConfFile(); err != nil {
+		return err
+	}
+	return s.GenerateServerConfigFile()
 }
 
+// TLS returns the node's TLS configuration. The same certificate is used to serve and to connect to the peers.
 func (s *NodeMaterial) TLS() config.TLSConf {
+	tlsConf := s.material.TLS()
+	if !tlsConf.Enabled() {
+		return config.TLSConf{}
+	}
+	tlsCrypto := s.Crypto.TLSCrypto()
 	return config.TLSConf{
-		Enabled:            false,
-		ClientAuthRequired: false,
-		//ServerCertificatePath: s.Crypto.CertPath(),
-		//ServerKeyPath:         s.Crypto.KeyPath(),
-		//ClientCertificatePath: s.Crypto.CertPath(),
-		//ClientKeyPath:         s.Crypto.KeyPath(),
-		//CaConfig: config.CAConfiguration{
-		//	RootCACertsPath: []string{s.rootCrypto.CertPath()},
-		//},
+		Enabled:               true,
+		ClientAuthRequired:    tlsConf.ClientAuthRequired(),
+		ServerCertificatePath: tlsCrypto.CertPath(),
+		ServerKeyPath:         tlsCrypto.KeyPath(),
+		ClientCertificatePath: tlsCrypto.CertPath(),
+		ClientKeyPath:         tlsCrypto.KeyPath(),
+		CaConfig:              s.material.CAConfig(),
 	}
 }
 
-func (s *NodeMaterial) readConfigFile(configFilePath string, conf interface{}) {
+func (s *NodeMaterial) readConfigFile(configFilePath string, conf interface{}) error {
 	v := viper.New()
 	v.SetConfigFile(configFilePath)
-	s.Check(v.ReadInConfig())
-	s.Check(v.UnmarshalExact(conf))
+	if err := v.ReadInConfig(); err != nil {
+		return errors.Wrapf(err, "failed to read the node config: %s", configFilePath)
+	}
+	return errors.Wrapf(v.UnmarshalExact(conf), "failed to parse the node config: %s", configFilePath)
 }
 
-func (s *NodeMaterial) DefaultConfiguration() *config.Configurations {
+func (s *NodeMaterial) DefaultConfiguration() (*config.Configurations, error) {
 	if s.defaultConf == nil {
-		s.defaultConf = &config.Configurations{}
-		s.readConfigFile(s.material.config.Path.DefaultLocalConf, &s.defaultConf.LocalConfig)
-		s.readConfigFile(s.material.config.Path.DefaultSharedConf, &s.defaultConf.SharedConfig)
+		defaultConf := &config.Configurations{}
+		if err := s.readConfigFile(s.material.config.Path.DefaultLocalConf, &defaultConf.LocalConfig); err != nil {
+			return nil, err
+		}
+		if err := s.readConfigFile(s.material.config.Path.DefaultSharedConf, &defaultConf.SharedConfig); err != nil {
+			return nil, err
+		}
+		s.defaultConf = defaultConf
 	}
-	return s.defaultConf
+	return s.defaultConf, nil
 }
 
-func (s *NodeMaterial) GenerateSharedConfFile() {
-	sharedConfig := *s.DefaultConfiguration().SharedConfig
-
-	sharedConfig.CAConfig = config.CAConfiguration{
-		RootCACertsPath:         []string{s.material.RootUser().CertPath()},
-		IntermediateCACertsPath: nil,
+func (s *NodeMaterial) GenerateSharedConfFile() error {
+	defaultConf, err := s.DefaultConfiguration()
+	if err != nil {
+		return err
 	}
+	sharedConfig := *defaultConf.SharedConfig
+
+	sharedConfig.CAConfig = s.material.CAConfig()
 	sharedConfig.Admin = config.AdminConf{
 		ID:              s.material.AdminUser().name,
 		CertificatePath: s.material.AdminUser().CertPath(),
@@ -136,11 +150,15 @@ func (s *NodeMaterial) GenerateSharedConfFile() {
 		}
 	}
 
-	s.Check(setup.WriteSharedConfig(&sharedConfig, s.SharedConfPath()))
+	return setup.WriteSharedConfig(&sharedConfig, s.SharedConfPath())
 }
 
-func (s *NodeMaterial) GenerateServerConfigFile() {
-	localConfig := *s.DefaultConfiguration().LocalConfig
+func (s *NodeMaterial) GenerateServerConfigFile() error {
+	defaultConf, err := s.DefaultConfiguration()
+	if err != nil {
+		return err
+	}
+	localConfig := *defaultConf.LocalConfig
 
 	localConfig.Server.Identity = config.IdentityConf{
 		ID:              s.Crypto.Name(),
@@ -151,13 +169,18 @@ func (s *NodeMaterial) GenerateServerConfigFile() {
 		Address: "0.0.0.0",
 		Port:    uint32(s.NodePort),
 	}
+	localConfig.Server.TLS = s.TLS()
 	localConfig.Server.Database.LedgerDirectory = s.LedgerPath()
 	localConfig.Replication.WALDir = s.WalPath()
 	localConfig.Replication.SnapDir = s.SnapPath()
+	localConfig.Replication.AuxDir = s.AuxPath()
 	localConfig.Replication.Network = config.NetworkConf{
 		Address: "0.0.0.0",
 		Port:    uint32(s.PeerPort),
 	}
+	localConfig.Replication.TLS = s.TLS()
+	// Orion does not support client authentication in the replication channel
+	localConfig.Replication.TLS.ClientAuthRequired = false
 	localConfig.Bootstrap = config.BootstrapConf{
 		Method: "genesis",
 		File:   s.SharedConfPath(),
@@ -168,41 +191,63 @@ func (s *NodeMaterial) GenerateServerConfigFile() {
 			Address: "0.0.0.0",
 			Port:    uint32(s.PrometheusPort),
 		},
-		TLS: s.TLS(),
+		// The metrics are served without TLS, so the prometheus server can scrape them regardless of the TLS mode
+		TLS: config.TLSConf{},
 	}
 
-	s.Check(setup.WriteLocalConfig(&localConfig, s.LocalConfPath()))
+	return setup.WriteLocalConfig(&localConfig, s.LocalConfPath())
 }
 
-func (s *NodeMaterial) Run() {
+// Run starts the node server and its data monitoring, which stops when the context is cancelled.
+func (s *NodeMaterial) Run(ctx context.Context) (*server.BCDBHTTPServer, error) {
 	s.lg.Infof("Starting node (rank: %d)", s.rank)
 	conf, err := config.Read(s.LocalConfPath())
-	s.Check(err)
+	if err != nil {
+		return nil, err
+	}
 
 	s.lg.Infof("Creating node server.")
 	srv, err := server.New(conf)
-	s.Check(err)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create the node server")
+	}
 	s.lg.Infof("Node PID %d", os.Getpid())
 
 	utils.RegisterNode()
 
-	s.Check(srv.Start())
+	if err = srv.Start(); err != nil {
+		return nil, errors.Wrap(err, "failed to start the node server")
+	}
 	s.lg.Infof("Node server started.")
 
-	go s.DataMonitor()
+	go s.DataMonitor(ctx)
+	return srv, nil
 }
 
-func (s *NodeMaterial) RunAndWait() {
-	s.Run()
-	var wg sync.WaitGroup
-	wg.Add(1)
-	wg.Wait()
+// RunAndWait runs the node until the context is cancelled, and then stops it.
+func (s *NodeMaterial) RunAndWait(ctx context.Context) error {
+	srv, err := s.Run(ctx)
+	if err != nil {
+		return err
+	}
+	<-ctx.Done()
+	s.lg.Infof("Stopping node server (rank: %d).", s.rank)
+	if err = srv.Stop(); err != nil {
+		return errors.Wrap(err, "failed to stop the node server")
+	}
+	s.lg.Infof("Node server stopped.")
+	return nil
 }
 
-func (s *NodeMaterial) DataMonitor() {
+func (s *NodeMaterial) DataMonitor(ctx context.Context) {
 	s.lg.Infof("Starting node data monitoring.")
 	for {
 		utils.DataSize.Set(float64(utils.GetFolderSize(s.dataPath)))
-		time.Sleep(s.material.config.Cluster.DataSizeCollectionInterval)
+		select {
+		case <-ctx.Done():
+			s.lg.Infof("Stopped node data monitoring.")
+			return
+		case <-time.After(s.material.config.Cluster.DataSizeCollectionInterval):
+		}
 	}
 }
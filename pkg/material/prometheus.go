@@ -13,6 +13,7 @@ import (
 	"orion-bench/pkg/utils"
 
 	"github.com/hyperledger-labs/orion-server/pkg/logger"
+	"github.com/pkg/errors"
 )
 
 type PrometheusMaterial struct {
@@ -25,88 +26,116 @@ type PrometheusMaterial struct {
 	conf *utils.Map
 }
 
-func (p *PrometheusMaterial) Check(err error) {
-	utils.Check(p.lg, err)
-}
-
-func (p *PrometheusMaterial) readConfigFile(configFilePath string) *utils.Map {
+func (p *PrometheusMaterial) readConfigFile(configFilePath string) (*utils.Map, error) {
 	b, err := ioutil.ReadFile(configFilePath)
-	p.Check(err)
+	if err != nil {
+		return nil, err
+	}
 	conf := utils.Unmarshal(b).Map()
-	p.Check(conf.GetError())
-	return conf
+	return conf, errors.Wrapf(conf.GetError(), "failed to parse the prometheus config: %s", configFilePath)
 }
 
-func (p *PrometheusMaterial) writeConfigFile(configFilePath string) {
-	b, err := p.Conf().Marshal()
-	p.Check(err)
-	p.Check(ioutil.WriteFile(configFilePath, b, perm))
+func (p *PrometheusMaterial) writeConfigFile(configFilePath string) error {
+	conf, err := p.Conf()
+	if err != nil {
+		return err
+	}
+	b, err := conf.Marshal()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(configFilePath, b, perm)
 }
 
-func (p *PrometheusMaterial) Conf() *utils.Map {
+func (p *PrometheusMaterial) Conf() (*utils.Map, error) {
 	if p.conf == nil {
-		p.conf = p.readConfigFile(p.defaultConfPath)
+		conf, err := p.readConfigFile(p.defaultConfPath)
+		if err != nil {
+			return nil, err
+		}
+		p.conf = conf
 	}
-	return p.conf
+	return p.conf, nil
 }
 
-func (p *PrometheusMaterial) MainScrapeConfig() *utils.Map {
-	scrapeConfigs := p.Conf().SetDefaultList("scrape_configs")
+func (p *PrometheusMaterial) MainScrapeConfig() (*utils.Map, error) {
+	conf, err := p.Conf()
+	if err != nil {
+		return nil, err
+	}
+	scrapeConfigs := conf.SetDefaultList("scrape_configs")
 	for i := 0; i < scrapeConfigs.Len(); i++ {
 		if curConf := scrapeConfigs.Get(i).Map(); curConf.OK() {
-			return curConf
+			return curConf, nil
 		}
 	}
 
 	mainConf := utils.AsMap(utils.AnyMap{"job_name": "benchmark"})
-	p.Check(p.Conf().Set("scrape_configs", scrapeConfigs.Append(mainConf)).GetError())
-	return mainConf
+	return mainConf, conf.Set("scrape_configs", scrapeConfigs.Append(mainConf)).GetError()
 }
 
-func (p *PrometheusMaterial) GetStaticConfig(group string) *utils.Map {
-	mainConf := p.MainScrapeConfig()
+func (p *PrometheusMaterial) GetStaticConfig(group string) (*utils.Map, error) {
+	mainConf, err := p.MainScrapeConfig()
+	if err != nil {
+		return nil, err
+	}
 	staticConfigs := mainConf.SetDefaultList("static_configs")
 	for i := 0; i < staticConfigs.Len(); i++ {
 		s := staticConfigs.Get(i).Map()
 		g, err := s.Get("labels").Map().Get("group").String()
 		if err == nil && strings.EqualFold(strings.TrimSpace(g), group) {
-			return s
+			return s, nil
 		}
 	}
 
 	// group was not found
 	staticConf := utils.AsMap(utils.AnyMap{"labels": utils.AnyMap{"group": group}})
-	p.Check(mainConf.Set("static_configs", staticConfigs.Append(staticConf)).GetError())
-	return staticConf
+	return staticConf, mainConf.Set("static_configs", staticConfigs.Append(staticConf)).GetError()
 }
 
-func (p *PrometheusMaterial) AddTarget(group string, target string) {
-	staticConf := p.GetStaticConfig(group)
+func (p *PrometheusMaterial) AddTarget(group string, target string) error {
+	staticConf, err := p.GetStaticConfig(group)
+	if err != nil {
+		return err
+	}
 	curTargets := staticConf.Get("targets").List()
 	curTargets = curTargets.Append(target)
-	p.Check(curTargets.GetError())
-	p.Check(staticConf.Set("targets", curTargets).GetError())
+	if err = curTargets.GetError(); err != nil {
+		return err
+	}
+	return staticConf.Set("targets", curTargets).GetError()
 }
 
-func (p *PrometheusMaterial) PrintConf() {
-	b, err := p.Conf().Marshal()
-	p.Check(err)
+func (p *PrometheusMaterial) PrintConf() error {
+	conf, err := p.Conf()
+	if err != nil {
+		return err
+	}
+	b, err := conf.Marshal()
+	if err != nil {
+		return err
+	}
 	fmt.Println(string(b))
+	return nil
 }
 
-func (p *PrometheusMaterial) Generate() {
+func (p *PrometheusMaterial) Generate() error {
 	for _, node := range p.material.AllNodes() {
-		p.AddTarget("nodes", node.PrometheusTargetAddress())
+		if err := p.AddTarget("nodes", node.PrometheusTargetAddress()); err != nil {
+			return err
+		}
 	}
 
 	for _, worker := range p.material.AllWorkers() {
-		p.AddTarget("workload", worker.PrometheusTargetAddress())
+		if err := p.AddTarget("workload", worker.PrometheusTargetAddress()); err != nil {
+			return err
+		}
 	}
 
-	p.writeConfigFile(p.path)
+	return p.writeConfigFile(p.path)
 }
 
-func (p *PrometheusMaterial) Run() {
+func (p *PrometheusMaterial) Run() error {
 	p.lg.Infof("Prometheus PID %d", os.Getpid())
 	cmd := exec.Command(
 		"/bin/prometheus",
@@ -118,5 +147,5 @@ func (p *PrometheusMaterial) Run() {
 	)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	p.Check(cmd.Run())
+	return errors.Wrap(cmd.Run(), "prometheus server failed")
 }
@@ -0,0 +1,351 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package material
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"orion-bench/pkg/types"
+
+	"github.com/hyperledger-labs/orion-server/config"
+	"gopkg.in/yaml.v3"
+)
+
+// ValidationResult lists the problems of a single item. An item with no problems is valid.
+type ValidationResult struct {
+	Name     string
+	Problems []string
+}
+
+func (r *ValidationResult) problem(format string, args ...interface{}) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+}
+
+// Validation is the result of validating all the material against the configuration.
+type Validation struct {
+	Results []*ValidationResult
+}
+
+func (v *Validation) add(name string) *ValidationResult {
+	r := &ValidationResult{Name: name}
+	v.Results = append(v.Results, r)
+	return r
+}
+
+func (v *Validation) Passed() bool {
+	for _, r := range v.Results {
+		if len(r.Problems) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Text returns the validation as a human-readable table with a summary.
+func (v *Validation) Text() string {
+	buf := &bytes.Buffer{}
+	tw := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0)
+	failed := 0
+	for _, r := range v.Results {
+		if len(r.Problems) == 0 {
+			_, _ = fmt.Fprintf(tw, "%s\tok\t\n", r.Name)
+			continue
+		}
+		failed++
+		_, _ = fmt.Fprintf(tw, "%s\tFAILED\t%s\n", r.Name, strings.Join(r.Problems, "; "))
+	}
+	_ = tw.Flush()
+	if failed == 0 {
+		_, _ = fmt.Fprintf(buf, "PASSED: all %d items are valid.\n", len(v.Results))
+	} else {
+		_, _ = fmt.Fprintf(buf, "FAILED: %d out of %d items are invalid.\n", failed, len(v.Results))
+	}
+	return buf.String()
+}
+
+// trust is the CA hierarchy that the certificates are validated against.
+type trust struct {
+	roots         *x509.CertPool
+	intermediates *x509.CertPool
+	// The CAs' certificates by their path name
+	certs map[string]*x509.Certificate
+}
+
+func (t *trust) add(c *CryptoMaterial, cert *x509.Certificate, isRoot bool) {
+	if isRoot {
+		t.roots.AddCert(cert)
+	} else {
+		t.intermediates.AddCert(cert)
+	}
+	t.certs[c.PathName()] = cert
+}
+
+// checkCrypto verifies the presence, key/cert pairing, key algorithm, expiry and chain of trust of a certificate,
+// and that it was issued by the expected issuer.
+// If host is not empty, it also verifies that the certificate is valid for the host.
+func checkCrypto(
+	r *ValidationResult, c *CryptoMaterial, keyConf *types.KeyConf, t *trust, issuer *CryptoMaterial, host string,
+) *x509.Certificate {
+	if !c.Exists() {
+		r.problem("%s: missing certificate or key", c.PathName())
+		return nil
+	}
+	if _, err := tls.LoadX509KeyPair(c.CertPath(), c.KeyPath()); err != nil {
+		r.problem("%s: key does not match the certificate: %s", c.PathName(), err)
+		return nil
+	}
+	cert, err := c.Cert()
+	if err != nil {
+		r.problem("%s: %s", c.PathName(), err)
+		return nil
+	}
+
+	if algorithm := KeyAlgorithm(cert); algorithm != keyConf.String() {
+		r.problem("%s: key algorithm %s, expected %s", c.PathName(), algorithm, keyConf)
+	}
+	now := time.Now()
+	if now.Before(cert.NotBefore) {
+		r.problem("%s: not valid before %s", c.PathName(), cert.NotBefore.Format(time.RFC3339))
+	}
+	if now.After(cert.NotAfter) {
+		r.problem("%s: expired at %s", c.PathName(), cert.NotAfter.Format(time.RFC3339))
+	}
+	if t != nil {
+		_, err = cert.Verify(x509.VerifyOptions{
+			Roots:         t.roots,
+			Intermediates: t.intermediates,
+			CurrentTime:   now,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		if err != nil {
+			r.problem("%s: not trusted by the CA hierarchy: %s", c.PathName(), err)
+		} else if issuerCert, ok := t.certs[issuer.PathName()]; !ok || cert.CheckSignatureFrom(issuerCert) != nil {
+			r.problem("%s: not issued by %s", c.PathName(), issuer.PathName())
+		}
+	}
+	if host != "" {
+		if err = cert.VerifyHostname(host); err != nil {
+			r.problem("%s: the address does not match the certificate: %s", c.PathName(), err)
+		}
+	}
+	return cert
+}
+
+func checkCA(r *ValidationResult, cert *x509.Certificate) {
+	if !cert.IsCA {
+		r.problem("not a CA certificate")
+	}
+}
+
+func (m *BenchMaterial) validateCAs(v *Validation) *trust {
+	t := &trust{
+		roots:         x509.NewCertPool(),
+		intermediates: x509.NewCertPool(),
+		certs:         map[string]*x509.Certificate{},
+	}
+	cryptoConf := m.Crypto()
+	root := m.RootUser()
+	r := v.add(root.PathName())
+	cert := checkCrypto(r, root, &cryptoConf.Identity, nil, nil, "")
+	if cert == nil {
+		return t
+	}
+	checkCA(r, cert)
+	t.add(root, cert, true)
+
+	for _, intermediate := range m.AllIntermediates() {
+		r = v.add(intermediate.PathName())
+		if cert = checkCrypto(r, intermediate, &cryptoConf.Identity, t, root, ""); cert != nil {
+			checkCA(r, cert)
+			t.add(intermediate, cert, false)
+		}
+	}
+	return t
+}
+
+func (m *BenchMaterial) validateUsers(v *Validation, t *trust) {
+	cryptoConf := m.Crypto()
+	root := m.RootUser()
+	clientTLS := m.TLS().ClientAuthRequired()
+	check := func(user *CryptoMaterial, issuer *CryptoMaterial) {
+		r := v.add(user.PathName())
+		checkCrypto(r, user, &cryptoConf.Identity, t, issuer, "")
+		if clientTLS {
+			checkCrypto(r, user.TLSCrypto(), &cryptoConf.TLS, t, root, "")
+		}
+	}
+	check(m.AdminUser(), m.issuer(false, 0))
+	for i, user := range m.AllUsers() {
+		check(user, m.issuer(false, uint64(i)))
+	}
+}
+
+func equalPaths(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *BenchMaterial) validateNodeConf(r *ValidationResult, node *NodeMaterial) {
+	conf, err := config.Read(node.LocalConfPath())
+	if err != nil {
+		r.problem("%s", err)
+		return
+	}
+
+	local := conf.LocalConfig
+	if local.Server.Identity.ID != node.Crypto.Name() {
+		r.problem("local config: identity %s, expected %s", local.Server.Identity.ID, node.Crypto.Name())
+	}
+	if local.Server.Identity.CertificatePath != node.Crypto.CertPath() {
+		r.problem("local config: certificate %s, expected %s", local.Server.Identity.CertificatePath, node.Crypto.CertPath())
+	}
+	if local.Server.Network.Port != uint32(node.NodePort) {
+		r.problem("local config: node port %d, expected %d", local.Server.Network.Port, node.NodePort)
+	}
+	if local.Replication.Network.Port != uint32(node.PeerPort) {
+		r.problem("local config: peer port %d, expected %d", local.Replication.Network.Port, node.PeerPort)
+	}
+	tlsConf := node.TLS()
+	if local.Server.TLS.Enabled != tlsConf.Enabled || local.Server.TLS.ClientAuthRequired != tlsConf.ClientAuthRequired {
+		r.problem("local config: TLS does not match the TLS mode: %s", m.TLS().Mode)
+	}
+	if local.Bootstrap.File != node.SharedConfPath() {
+		r.problem("local config: bootstrap file %s, expected %s", local.Bootstrap.File, node.SharedConfPath())
+	}
+
+	shared := conf.SharedConfig
+	if shared == nil {
+		r.problem("missing shared config")
+		return
+	}
+	caConf := m.CAConfig()
+	if !equalPaths(shared.CAConfig.RootCACertsPath, caConf.RootCACertsPath) {
+		r.problem("shared config: root CAs %v, expected %v", shared.CAConfig.RootCACertsPath, caConf.RootCACertsPath)
+	}
+	if !equalPaths(shared.CAConfig.IntermediateCACertsPath, caConf.IntermediateCACertsPath) {
+		r.problem("shared config: intermediate CAs %v, expected %v",
+			shared.CAConfig.IntermediateCACertsPath, caConf.IntermediateCACertsPath)
+	}
+	if shared.Admin.ID != m.AdminUser().Name() {
+		r.problem("shared config: admin %s, expected %s", shared.Admin.ID, m.AdminUser().Name())
+	}
+
+	allNodes := m.AllNodes()
+	if len(shared.Nodes) != len(allNodes) || shared.Consensus == nil || len(shared.Consensus.Members) != len(allNodes) {
+		r.problem("shared config: the nodes do not match the cluster's nodes list")
+		return
+	}
+	for i, n := range allNodes {
+		sn, sm := shared.Nodes[i], shared.Consensus.Members[i]
+		if sn.NodeID != n.Crypto.Name() || sn.Host != n.Address || sn.Port != uint32(n.NodePort) {
+			r.problem("shared config: node %s (%s:%d), expected %s (%s:%d)",
+				sn.NodeID, sn.Host, sn.Port, n.Crypto.Name(), n.Address, n.NodePort)
+		}
+		if sm.NodeId != n.Crypto.Name() || sm.PeerHost != n.Address || sm.PeerPort != uint32(n.PeerPort) ||
+			sm.RaftId != n.RaftId {
+			r.problem("shared config: peer %s (%s:%d), expected %s (%s:%d)",
+				sm.NodeId, sm.PeerHost, sm.PeerPort, n.Crypto.Name(), n.Address, n.PeerPort)
+		}
+	}
+}
+
+func (m *BenchMaterial) validateNodes(v *Validation, t *trust) {
+	cryptoConf := m.Crypto()
+	root := m.RootUser()
+	tlsEnabled := m.TLS().Enabled()
+	for i, node := range m.AllNodes() {
+		r := v.add(node.Crypto.PathName())
+		checkCrypto(r, node.Crypto, &cryptoConf.Identity, t, m.issuer(true, uint64(i)), node.Address)
+		if tlsEnabled {
+			checkCrypto(r, node.Crypto.TLSCrypto(), &cryptoConf.TLS, t, root, node.Address)
+		}
+		m.validateNodeConf(r, node)
+	}
+}
+
+// prometheusTargets returns all the scrape targets in the generated prometheus config.
+func (m *BenchMaterial) prometheusTargets(r *ValidationResult) map[string]bool {
+	b, err := os.ReadFile(m.Prometheus().path)
+	if err != nil {
+		r.problem("%s", err)
+		return nil
+	}
+	conf := &struct {
+		ScrapeConfigs []struct {
+			StaticConfigs []struct {
+				Targets []string `yaml:"targets"`
+			} `yaml:"static_configs"`
+		} `yaml:"scrape_configs"`
+	}{}
+	if err = yaml.Unmarshal(b, conf); err != nil {
+		r.problem("%s", err)
+		return nil
+	}
+	targets := map[string]bool{}
+	for _, s := range conf.ScrapeConfigs {
+		for _, c := range s.StaticConfigs {
+			for _, t := range c.Targets {
+				targets[t] = true
+			}
+		}
+	}
+	return targets
+}
+
+func (m *BenchMaterial) validatePrometheus(v *Validation) {
+	r := v.add("prometheus")
+	targets := m.prometheusTargets(r)
+	if targets == nil {
+		return
+	}
+	for _, node := range m.AllNodes() {
+		if !targets[node.PrometheusTargetAddress()] {
+			r.problem("missing node target %s", node.PrometheusTargetAddress())
+		}
+	}
+	for _, worker := range m.AllWorkers() {
+		if !targets[worker.PrometheusTargetAddress()] {
+			r.problem("missing worker target %s", worker.PrometheusTargetAddress())
+		}
+	}
+}
+
+func (m *BenchMaterial) validateWorkers(v *Validation) {
+	seen := map[string]uint64{}
+	for _, worker := range m.AllWorkers() {
+		r := v.add(fmt.Sprintf("worker-%d", worker.Rank))
+		if worker.Address == "" {
+			r.problem("empty address")
+		}
+		target := worker.PrometheusTargetAddress()
+		if rank, ok := seen[target]; ok {
+			r.problem("the prometheus address %s is used by worker %d", target, rank)
+		}
+		seen[target] = worker.Rank
+	}
+}
+
+// Validate verifies that all the material exists, is issued by the expected CA, and is consistent with the configuration.
+func (m *BenchMaterial) Validate() *Validation {
+	v := &Validation{}
+	t := m.validateCAs(v)
+	m.validateUsers(v, t)
+	m.validateNodes(v, t)
+	m.validateWorkers(v)
+	m.validatePrometheus(v)
+	return v
+}
@@ -0,0 +1,184 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package material
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"orion-bench/pkg/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		config func(conf *types.BenchmarkConf)
+		mutate func(t *testing.T, m *BenchMaterial)
+		// The prefixes of the expected problems by the item's name
+		problems map[string][]string
+	}{
+		{
+			name:   "valid",
+			mutate: func(t *testing.T, m *BenchMaterial) {},
+		},
+		{
+			name: "valid with intermediate CAs",
+			config: func(conf *types.BenchmarkConf) {
+				conf.Material.CA.Intermediates = 2
+			},
+			mutate: func(t *testing.T, m *BenchMaterial) {},
+		},
+		{
+			name: "missing",
+			mutate: func(t *testing.T, m *BenchMaterial) {
+				require.NoError(t, os.Remove(m.User(0).CertPath()))
+			},
+			problems: map[string][]string{"user-U00000": {"user-U00000: missing certificate or key"}},
+		},
+		{
+			name: "wrong issuer",
+			config: func(conf *types.BenchmarkConf) {
+				conf.Material.CA.Intermediates = 1
+			},
+			mutate: func(t *testing.T, m *BenchMaterial) {
+				// The root CA is trusted, but the user should be issued by the intermediate CA
+				require.NoError(t, m.User(1).generate(m.RootUser(), userHost, m.Crypto()))
+			},
+			problems: map[string][]string{"user-U00001": {"user-U00001: not issued by ca-I00000"}},
+		},
+		{
+			name: "untrusted issuer",
+			mutate: func(t *testing.T, m *BenchMaterial) {
+				other := &CryptoMaterial{lg: m.lg, name: Root, path: m.RootUser().path + ".other"}
+				require.NoError(t, other.generateRoot(m.Crypto()))
+				require.NoError(t, m.User(1).generate(other, userHost, m.Crypto()))
+			},
+			problems: map[string][]string{"user-U00001": {"user-U00001: not trusted by the CA hierarchy"}},
+		},
+		{
+			name: "SAN mismatch",
+			mutate: func(t *testing.T, m *BenchMaterial) {
+				node := m.Node(1)
+				require.NoError(t, node.Crypto.generate(m.RootUser(), "10.0.0.9", m.Crypto()))
+				require.NoError(t, node.Crypto.TLSCrypto().generateTLS(m.RootUser(), "node1.example.com", m.Crypto()))
+			},
+			problems: map[string][]string{"node-N00001": {
+				"node-N00001: the address does not match the certificate: x509: certificate is valid for 10.0.0.9, " +
+					"not 127.0.0.1",
+				"node-N00001.tls: the address does not match the certificate",
+			}},
+		},
+		{
+			name: "expired",
+			mutate: func(t *testing.T, m *BenchMaterial) {
+				cryptoConf := *m.Crypto()
+				cryptoConf.Validity = -time.Minute
+				require.NoError(t, m.AdminUser().generate(m.RootUser(), userHost, &cryptoConf))
+			},
+			problems: map[string][]string{"user-admin": {
+				"user-admin: expired at",
+				"user-admin: not trusted by the CA hierarchy: x509: certificate has expired",
+			}},
+		},
+		{
+			name: "key mismatch",
+			mutate: func(t *testing.T, m *BenchMaterial) {
+				key, err := os.ReadFile(m.User(0).KeyPath())
+				require.NoError(t, err)
+				require.NoError(t, os.WriteFile(m.User(1).KeyPath(), key, perm))
+			},
+			problems: map[string][]string{
+				"user-U00001": {"user-U00001: key does not match the certificate: tls: private key does not match"},
+			},
+		},
+		{
+			name: "key algorithm",
+			mutate: func(t *testing.T, m *BenchMaterial) {
+				cryptoConf := *m.Crypto()
+				cryptoConf.TLS.Type = types.Ed25519Key
+				require.NoError(t, m.User(0).TLSCrypto().generateTLS(m.RootUser(), userHost, &cryptoConf))
+			},
+			problems: map[string][]string{
+				"user-U00000": {"user-U00000.tls: key algorithm ed25519, expected ecdsa P-256"},
+			},
+		},
+		{
+			name: "not a CA",
+			config: func(conf *types.BenchmarkConf) {
+				conf.Material.CA.Intermediates = 1
+			},
+			mutate: func(t *testing.T, m *BenchMaterial) {
+				ca := m.Intermediate(0)
+				require.NoError(t, ca.generate(m.RootUser(), userHost, m.Crypto()))
+			},
+			// The identities that the intermediate CA issued are no longer trusted
+			problems: map[string][]string{
+				"ca-I00000":   {"not a CA certificate"},
+				"user-admin":  {"user-admin: not trusted by the CA hierarchy"},
+				"user-U00000": {"user-U00000: not trusted by the CA hierarchy"},
+				"user-U00001": {"user-U00001: not trusted by the CA hierarchy"},
+			},
+		},
+		{
+			name: "stale node configuration",
+			mutate: func(t *testing.T, m *BenchMaterial) {
+				m.config.Cluster.NodeBasePort = 8000
+			},
+			// Each node's shared configuration lists all the nodes
+			problems: map[string][]string{
+				"node-N00000": {
+					"local config: node port 6001, expected 8000",
+					"shared config: node N00000 (127.0.0.1:6001), expected N00000 (127.0.0.1:8000)",
+					"shared config: node N00001 (127.0.0.1:6002), expected N00001 (127.0.0.1:8001)",
+				},
+				"node-N00001": {
+					"local config: node port 6002, expected 8001",
+					"shared config: node N00000 (127.0.0.1:6001), expected N00000 (127.0.0.1:8000)",
+					"shared config: node N00001 (127.0.0.1:6002), expected N00001 (127.0.0.1:8001)",
+				},
+			},
+		},
+		{
+			name: "missing prometheus target",
+			mutate: func(t *testing.T, m *BenchMaterial) {
+				m.config.Workload.Workers = append(m.config.Workload.Workers, "127.0.0.1")
+			},
+			problems: map[string][]string{"prometheus": {"missing worker target 127.0.0.1:2101"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := testConfig(t)
+			if tc.config != nil {
+				tc.config(conf)
+			}
+			m := newTestMaterial(t, conf)
+			require.NoError(t, m.Generate())
+			tc.mutate(t, m)
+
+			m = newTestMaterial(t, conf)
+			v := m.Validate()
+			failed := 0
+			for _, r := range v.Results {
+				expected := tc.problems[r.Name]
+				require.Len(t, r.Problems, len(expected), "%s: %v", r.Name, r.Problems)
+				for i, p := range expected {
+					require.True(t, strings.HasPrefix(r.Problems[i], p), "%s: %s", r.Name, r.Problems[i])
+				}
+				if len(expected) > 0 {
+					failed++
+				}
+			}
+			require.Equal(t, failed == 0, v.Passed())
+			if failed == 0 {
+				require.Contains(t, v.Text(), fmt.Sprintf("PASSED: all %d items are valid.\n", len(v.Results)))
+			} else {
+				require.Contains(t, v.Text(), fmt.Sprintf("FAILED: %d out of %d items are invalid.\n", failed, len(v.Results)))
+			}
+		})
+	}
+}
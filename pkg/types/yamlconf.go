@@ -3,6 +3,7 @@
 package types
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/creasty/defaults"
@@ -25,6 +26,94 @@ type ClusterConf struct {
 	PrometheusBasePort         Port          `yaml:"prometheus-base-port"`
 	DataSizeCollectionInterval time.Duration `yaml:"data-size-collection-interval"`
 	Nodes                      []string      `yaml:"nodes"`
+	TLS                        TLSConf       `yaml:"tls"`
+}
+
+// TLSMode defines which of the cluster's channels are authenticated with TLS.
+type TLSMode string
+
+const (
+	// TLSOff disables TLS
+	TLSOff TLSMode = "off"
+	// ServerTLS authenticates the servers to their clients
+	ServerTLS TLSMode = "server-only"
+	// MutualTLS authenticates both the servers and the clients
+	MutualTLS TLSMode = "mutual"
+)
+
+type TLSConf struct {
+	Mode TLSMode `default:"off" yaml:"mode"`
+}
+
+func (t *TLSConf) Enabled() bool {
+	return t.Mode == ServerTLS || t.Mode == MutualTLS
+}
+
+func (t *TLSConf) ClientAuthRequired() bool {
+	return t.Mode == MutualTLS
+}
+
+// KeyType is the key algorithm of the generated certificates.
+type KeyType string
+
+const (
+	ECDSAKey   KeyType = "ecdsa"
+	RSAKey     KeyType = "rsa"
+	Ed25519Key KeyType = "ed25519"
+)
+
+// KeyConf defines the key algorithm. The curve only applies to ECDSA keys, and the bits only apply to RSA keys.
+type KeyConf struct {
+	Type    KeyType `default:"ecdsa" yaml:"key-type"`
+	Curve   string  `default:"P-256" yaml:"curve"`
+	RSABits int     `default:"2048" yaml:"rsa-bits"`
+}
+
+// String describes the key algorithm, e.g., "ecdsa P-256" or "rsa 2048".
+func (k *KeyConf) String() string {
+	switch k.Type {
+	case ECDSAKey:
+		return fmt.Sprintf("%s %s", k.Type, k.Curve)
+	case RSAKey:
+		return fmt.Sprintf("%s %d", k.Type, k.RSABits)
+	default:
+		return string(k.Type)
+	}
+}
+
+// CryptoConf defines the generated certificates.
+// The root CA and the users' and nodes' identities use the identity key algorithm,
+// and the TLS certificates use the TLS key algorithm.
+type CryptoConf struct {
+	Validity time.Duration `default:"8760h" yaml:"validity"`
+	Identity KeyConf       `yaml:"identity"`
+	TLS      KeyConf       `yaml:"tls"`
+}
+
+func (c *CryptoConf) String() string {
+	return fmt.Sprintf("identity: %s, tls: %s, validity: %s", &c.Identity, &c.TLS, c.Validity)
+}
+
+// CAIssue selects the identities that are issued by the intermediate CAs.
+type CAIssue string
+
+const (
+	IssueAll   CAIssue = "all"
+	IssueUsers CAIssue = "users"
+	IssueNodes CAIssue = "nodes"
+)
+
+// CAConf defines the CA hierarchy. With no intermediate CAs, all the certificates are issued by the root CA.
+// Otherwise, the selected identities are issued by the intermediate CAs in a round-robin manner,
+// and the rest of the certificates (including the TLS certificates) are issued by the root CA.
+type CAConf struct {
+	Intermediates uint64  `yaml:"intermediates"`
+	Issue         CAIssue `default:"users" yaml:"issue"`
+}
+
+type MaterialConf struct {
+	Crypto CryptoConf `yaml:"crypto"`
+	CA     CAConf     `yaml:"ca"`
 }
 
 type WorkloadConf struct {
@@ -35,15 +124,24 @@ type WorkloadConf struct {
 	Session            SessionConf         `yaml:"session"`
 	Duration           time.Duration       `yaml:"duration"`
 	WarmupDuration     time.Duration       `yaml:"warmup-duration"`
+	Rate               RateConf            `yaml:"rate"`
+	WarmupRate         RateConf            `yaml:"warmup-rate"`
+	Phases             []PhaseConf         `yaml:"phases"`
+	WarmupPhases       []PhaseConf         `yaml:"warmup-phases"`
+	Saturation         SaturationConf      `yaml:"saturation"`
+	Coordinator        CoordinatorConf     `yaml:"coordinator"`
+	Blocks             BlockListenerConf   `yaml:"blocks"`
 	PrometheusBasePort Port                `yaml:"prometheus-base-port"`
 	Workers            []string            `yaml:"workers"`
 	Parameters         map[string]string   `yaml:"parameters"`
 }
 
 type SessionConf struct {
-	TxTimeout    time.Duration `yaml:"tx-timeout"`
-	QueryTimeout time.Duration `yaml:"query-timeout"`
-	Backoff      BackoffConf   `yaml:"backoff"`
+	TxTimeout    time.Duration   `yaml:"tx-timeout"`
+	QueryTimeout time.Duration   `yaml:"query-timeout"`
+	Backoff      BackoffConf     `yaml:"backoff"`
+	ErrorBudget  ErrorBudgetConf `yaml:"error-budget"`
+	Receipts     ReceiptConf     `yaml:"receipts"`
 }
 
 type WorkloadOperation struct {
@@ -51,6 +149,106 @@ type WorkloadOperation struct {
 	Weight    uint   `default:"1" yaml:"weight"`
 }
 
+type RateScope string
+
+const (
+	WorkerRate  RateScope = "worker"
+	ClusterRate RateScope = "cluster"
+)
+
+type ArrivalType string
+
+const (
+	ConstantArrival ArrivalType = "constant"
+	PoissonArrival  ArrivalType = "poisson"
+)
+
+// RateConf defines an open-loop workload. A zero target means a closed-loop workload.
+type RateConf struct {
+	Target  float64     `yaml:"target"`
+	Scope   RateScope   `default:"worker" yaml:"scope"`
+	Arrival ArrivalType `default:"constant" yaml:"arrival"`
+	Seed    int64       `yaml:"seed"`
+}
+
+// PhaseConf defines a single phase of a multi-phase workload.
+// If Ramp is set, the active users and the rate change linearly from the previous phase's values.
+type PhaseConf struct {
+	Name       string              `yaml:"name"`
+	Duration   time.Duration       `yaml:"duration"`
+	Users      float64             `default:"1" yaml:"users"`
+	Ramp       bool                `yaml:"ramp"`
+	Rate       RateConf            `yaml:"rate"`
+	Operations []WorkloadOperation `yaml:"operations"`
+}
+
+func (s *PhaseConf) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	err := defaults.Set(s)
+	if err != nil {
+		return err
+	}
+
+	type plain PhaseConf
+	if err = unmarshal((*plain)(s)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SaturationConf defines the search for the maximal sustainable rate.
+// Each step runs the workload in an open-loop with a higher rate than the previous step:
+// rate(i+1) = rate(i) * rate-factor + rate-increment.
+// The search stops when the latency SLO, the error rate or the drop rate are violated.
+type SaturationConf struct {
+	InitialRate   float64       `default:"100" yaml:"initial-rate"`
+	RateIncrement float64       `default:"100" yaml:"rate-increment"`
+	RateFactor    float64       `default:"1" yaml:"rate-factor"`
+	MaxRate       float64       `yaml:"max-rate"`
+	MaxSteps      uint          `default:"20" yaml:"max-steps"`
+	StepDuration  time.Duration `default:"1m" yaml:"step-duration"`
+	Scope         RateScope     `default:"cluster" yaml:"scope"`
+	Arrival       ArrivalType   `default:"poisson" yaml:"arrival"`
+	Seed          int64         `yaml:"seed"`
+	Operation     string        `yaml:"operation"`
+	LatencySLO    time.Duration `default:"1s" yaml:"latency-slo"`
+	SLOPercentile float64       `default:"0.99" yaml:"slo-percentile"`
+	MaxErrorRate  float64       `default:"0.01" yaml:"max-error-rate"`
+	MaxDropRate   float64       `default:"0.01" yaml:"max-drop-rate"`
+}
+
+// CoordinatorConf defines the coordination service that synchronizes the workers' start time.
+// An empty address means the workers are not synchronized.
+type CoordinatorConf struct {
+	Address         string        `yaml:"address"`
+	Port            Port          `default:"5000" yaml:"port"`
+	RegisterTimeout time.Duration `default:"5m" yaml:"register-timeout"`
+	StartDelay      time.Duration `default:"5s" yaml:"start-delay"`
+}
+
+// ErrorBudgetConf limits the failed work iterations of each user. A user that exceeds its budget stops working.
+// Zero means unlimited.
+type ErrorBudgetConf struct {
+	MaxErrors            uint64 `yaml:"max-errors"`
+	MaxConsecutiveErrors uint64 `yaml:"max-consecutive-errors"`
+}
+
+// ReceiptConf defines how the validation status of the asynchronously committed TXs is resolved.
+// The receipts of the pending TXs are fetched through the ledger API every poll interval, and a TX with no receipt
+// after the timeout is reported as unresolved. A zero poll interval disables the tracking of asynchronous commits.
+type ReceiptConf struct {
+	PollInterval time.Duration `default:"500ms" yaml:"poll-interval"`
+	Timeout      time.Duration `default:"1m" yaml:"timeout"`
+}
+
+// BlockListenerConf defines the listener that follows the new blocks while the work runs.
+// The listener polls for the next block header every retry interval, and buffers up to capacity headers.
+type BlockListenerConf struct {
+	Enabled       bool          `yaml:"enabled"`
+	RetryInterval time.Duration `default:"100ms" yaml:"retry-interval"`
+	Capacity      int           `default:"100" yaml:"capacity"`
+}
+
 type BackoffConf struct {
 	InitialInterval     time.Duration `default:"10ms" yaml:"initial-interval"`
 	RandomizationFactor float64       `default:"0.5" yaml:"randomization-factor"`
@@ -59,6 +257,25 @@ type BackoffConf struct {
 	MaxElapsedTime      time.Duration `default:"60s" yaml:"max-elapsed-time"`
 }
 
+// ComparisonConf defines the tolerance thresholds when comparing a candidate report to a baseline report.
+// The throughput and latency thresholds are relative to the baseline, and the error rate threshold is absolute.
+type ComparisonConf struct {
+	MaxThroughputDecrease float64   `default:"0.05" yaml:"max-throughput-decrease"`
+	MaxLatencyIncrease    float64   `default:"0.1" yaml:"max-latency-increase"`
+	MaxErrorRateIncrease  float64   `default:"0.01" yaml:"max-error-rate-increase"`
+	Quantiles             []float64 `default:"[0.5, 0.99]" yaml:"quantiles"`
+	MinCount              uint64    `default:"100" yaml:"min-count"`
+}
+
+// LocalConf defines the single-host experiment launcher (-local).
+// The launcher waits up to the ready timeout for the cluster to serve requests, and stops each of its child
+// processes gracefully, or kills it after the stop timeout.
+type LocalConf struct {
+	ReadyTimeout time.Duration `default:"2m" yaml:"ready-timeout"`
+	StopTimeout  time.Duration `default:"30s" yaml:"stop-timeout"`
+	Prometheus   bool          `yaml:"prometheus"`
+}
+
 type PrometheusConf struct {
 	ListenAddress string `yaml:"listen-address"`
 }
@@ -67,8 +284,11 @@ type BenchmarkConf struct {
 	LogLevel   string         `yaml:"log-level"`
 	Path       PathConf       `yaml:"path"`
 	Cluster    ClusterConf    `yaml:"cluster"`
+	Material   MaterialConf   `yaml:"material"`
 	Workload   WorkloadConf   `yaml:"workload"`
 	Prometheus PrometheusConf `yaml:"prometheus"`
+	Comparison ComparisonConf `yaml:"comparison"`
+	Local      LocalConf      `yaml:"local"`
 }
 
 func (s *BenchmarkConf) UnmarshalYAML(unmarshal func(interface{}) error) error {
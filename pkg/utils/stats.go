@@ -2,6 +2,7 @@ package utils
 
 import (
 	"math"
+	"sync"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -26,14 +27,24 @@ var SizeBase2Buckets = []float64{
 	1 << 30, math.Inf(1),
 }
 
+var CountBuckets = []float64{
+	0, 1, 2, 5, 10, 20, 50, 100, 200, 500,
+	1e3, 2e3, 5e3, 1e4, 2e4, 5e4, 1e5, math.Inf(1),
+}
+
 var DataSize = prometheus.NewGauge(prometheus.GaugeOpts{
 	Namespace: "data",
 	Name:      "size_bytes",
 	Help:      "The size of the data folder in bytes",
 })
 
+var registerNode sync.Once
+
+// RegisterNode registers the node's metrics once, so multiple nodes can run in the same process.
 func RegisterNode() prometheus.Registerer {
 	var r = prometheus.DefaultRegisterer
-	r.MustRegister(DataSize)
+	registerNode.Do(func() {
+		r.MustRegister(DataSize)
+	})
 	return r
 }
@@ -3,7 +3,6 @@
 package utils
 
 import (
-	"log"
 	"os"
 	"path/filepath"
 
@@ -20,10 +19,6 @@ func Check(lg FatalLogger, err error) {
 	}
 }
 
-func CheckDefault(err error) {
-	Check(log.Default(), err)
-}
-
 func GetFolderSize(path string) int64 {
 	var size int64 = 0
 	_ = filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
@@ -0,0 +1,94 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package workload
+
+import (
+	"context"
+	"time"
+
+	"orion-bench/pkg/types"
+	"orion-bench/pkg/workload/common"
+
+	"github.com/hyperledger-labs/orion-sdk-go/pkg/bcdb"
+	"github.com/hyperledger-labs/orion-server/pkg/logger"
+	oriontypes "github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// BlockListener follows the new blocks via the ledger API while the work runs, and reports their size,
+// validation flags and inter-block time from the client's point of view.
+// The inter-block time is measured between the arrival times of the blocks, so it is accurate up to the
+// retry interval of the listener.
+type BlockListener struct {
+	lg     *logger.SugarLogger
+	stats  *common.ClientStats
+	conf   *types.BlockListenerConf
+	ledger bcdb.Ledger
+	start  uint64
+}
+
+// NewBlockListener creates a listener that follows the blocks that are committed after the current last block.
+func NewBlockListener(
+	lg *logger.SugarLogger, stats *common.ClientStats, conf *types.BlockListenerConf, ledger bcdb.Ledger,
+) (*BlockListener, error) {
+	last, err := ledger.GetLastBlockHeader()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch the last block header")
+	}
+	return &BlockListener{
+		lg:     lg,
+		stats:  stats,
+		conf:   conf,
+		ledger: ledger,
+		start:  last.GetBaseHeader().GetNumber() + 1,
+	}, nil
+}
+
+// Run observes the new blocks until the context is cancelled.
+func (l *BlockListener) Run(ctx context.Context) {
+	service := l.ledger.NewBlockHeaderDeliveryService(&bcdb.BlockHeaderDeliveryConfig{
+		StartBlockNumber: l.start,
+		RetryInterval:    l.conf.RetryInterval,
+		Capacity:         l.conf.Capacity,
+	})
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-ctx.Done():
+			service.Stop()
+		case <-stopped:
+		}
+	}()
+
+	l.lg.Infof("Following the blocks from block %d.", l.start)
+	var lastArrival time.Time
+	for {
+		header, ok := service.Receive().(*oriontypes.BlockHeader)
+		if !ok || header == nil {
+			break
+		}
+		arrival := time.Now()
+		var interval time.Duration
+		if !lastArrival.IsZero() {
+			interval = arrival.Sub(lastArrival)
+		}
+		lastArrival = arrival
+		l.observe(header, interval)
+	}
+
+	if err := service.Error(); err != nil {
+		l.lg.Errorf("Block listener stopped: %s", err)
+	}
+}
+
+func (l *BlockListener) observe(header *oriontypes.BlockHeader, interval time.Duration) {
+	validationInfo := header.GetValidationInfo()
+	invalid := map[string]uint64{}
+	for _, info := range validationInfo {
+		if flag := info.GetFlag(); flag != oriontypes.Flag_VALID {
+			invalid[flag.String()]++
+		}
+	}
+	l.stats.ObserveBlock(header.GetBaseHeader().GetNumber(), uint64(len(validationInfo)), invalid, interval)
+}
@@ -0,0 +1,116 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BlockReport summarizes the blocks that were observed by the worker's block listener.
+// The block interval is measured between the arrival times of consecutive blocks to the listener.
+type BlockReport struct {
+	First      uint64        `json:"first"`
+	Last       uint64        `json:"last"`
+	Count      uint64        `json:"count"`
+	Txs        uint64        `json:"txs"`
+	InvalidTxs uint64        `json:"invalid-txs"`
+	MaxTxs     uint64        `json:"max-txs"`
+	Rate       float64       `json:"rate"`
+	TxRate     float64       `json:"tx-rate"`
+	Interval   *Histogram    `json:"interval"`
+	MeanTxs    float64       `json:"mean-txs"`
+	P50        time.Duration `json:"p50-interval"`
+	P99        time.Duration `json:"p99-interval"`
+}
+
+// blockStats accumulates the observed blocks since the last histograms reset.
+type blockStats struct {
+	lock   sync.Mutex
+	report *BlockReport
+}
+
+func (b *blockStats) observe(number uint64, txs uint64, invalid uint64, interval time.Duration) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.report == nil {
+		b.report = &BlockReport{First: number, Interval: NewHistogram()}
+	}
+	r := b.report
+	r.Last = number
+	r.Count++
+	r.Txs += txs
+	r.InvalidTxs += invalid
+	if txs > r.MaxTxs {
+		r.MaxTxs = txs
+	}
+	if interval > 0 {
+		r.Interval.Record(interval)
+	}
+}
+
+func (b *blockStats) reset() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.report = nil
+}
+
+// summarize returns a copy of the accumulated blocks with their statistics over the given duration.
+// It returns nil if no block was observed.
+func (b *blockStats) summarize(duration time.Duration) *BlockReport {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.report == nil {
+		return nil
+	}
+	r := *b.report
+	r.Interval = NewHistogram()
+	r.Interval.Merge(b.report.Interval)
+	r.summarize(duration)
+	return &r
+}
+
+func (r *BlockReport) summarize(duration time.Duration) {
+	if r.Count > 0 {
+		r.MeanTxs = float64(r.Txs) / float64(r.Count)
+	}
+	if duration > 0 {
+		r.Rate = float64(r.Count) / duration.Seconds()
+		r.TxRate = float64(r.Txs) / duration.Seconds()
+	}
+	r.P50 = r.Interval.Quantile(0.5)
+	r.P99 = r.Interval.Quantile(0.99)
+}
+
+// InvalidRate returns the fraction of the TXs in the blocks that were invalidated.
+func (r *BlockReport) InvalidRate() float64 {
+	if r.Txs == 0 {
+		return 0
+	}
+	return float64(r.InvalidTxs) / float64(r.Txs)
+}
+
+// MergeBlockReports merges the blocks of multiple ranks.
+// All the ranks observe the same ledger, so the report that covers the most blocks is selected.
+func MergeBlockReports(reports []*Report) *BlockReport {
+	var merged *BlockReport
+	for _, r := range reports {
+		if r.Blocks != nil && (merged == nil || r.Blocks.Count > merged.Count) {
+			merged = r.Blocks
+		}
+	}
+	return merged
+}
+
+// Text returns the blocks summary as a human-readable text.
+func (r *BlockReport) Text() string {
+	buf := &bytes.Buffer{}
+	_, _ = fmt.Fprintf(buf, "Blocks: %d-%d, count: %d, rate: %.2f blocks/s\n", r.First, r.Last, r.Count, r.Rate)
+	_, _ = fmt.Fprintf(buf, "  TXs: %d, invalid: %d (%.2f%%), rate: %.2f tx/s, per block: mean %.2f, max %d\n",
+		r.Txs, r.InvalidTxs, r.InvalidRate()*100, r.TxRate, r.MeanTxs, r.MaxTxs)
+	_, _ = fmt.Fprintf(buf, "  Interval: mean %s, p50 %s, p99 %s, max %s\n",
+		formatLatency(r.Interval.Mean()), formatLatency(r.P50), formatLatency(r.P99), formatLatency(r.Interval.Max()))
+	return buf.String()
+}
@@ -0,0 +1,153 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package common
+
+import (
+	"context"
+	"io"
+	"net"
+	"regexp"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hyperledger-labs/orion-sdk-go/pkg/bcdb"
+	"github.com/hyperledger-labs/orion-server/pkg/logger"
+	oriontypes "github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// The SDK reports some of the server's responses only by their message, so they are matched by a regular expression.
+var (
+	fullQueueExp    = regexp.MustCompile(`(?i)transaction queue is full`)
+	duplicateExp    = regexp.MustCompile(`(?i)duplicate txID`)
+	signatureExp    = regexp.MustCompile(`(?i)signature verification failed`)
+	permissionExp   = regexp.MustCompile(`(?i)status code: 403|403 Forbidden|has no (read|write) permission|no permission`)
+	leaderChangeExp = regexp.MustCompile(`(?i)leader unavailable|not a leader|status code: 307|307 Temporary Redirect|failed to select replica`)
+	timeoutExp      = regexp.MustCompile(`(?i)timeout error|status code: 408|408 Request Timeout`)
+	connectionExp   = regexp.MustCompile(`(?i)connection refused|connection reset|broken pipe|no such host`)
+)
+
+// classifiers are evaluated in order, so the more specific classes come first.
+var classifiers = []struct {
+	status StatStatus
+	match  func(err error) bool
+}{
+	{status: FullQueue, match: matchMessage(fullQueueExp)},
+	{status: Timeout, match: isTimeout},
+	{status: DuplicateTx, match: matchMessage(duplicateExp)},
+	{status: SignatureFailure, match: matchMessage(signatureExp)},
+	{status: PermissionDenied, match: matchMessage(permissionExp)},
+	{status: LeaderChange, match: matchMessage(leaderChangeExp)},
+	{status: ConnectionError, match: isConnectionError},
+}
+
+func matchMessage(exp *regexp.Regexp) func(err error) bool {
+	return func(err error) bool {
+		return exp.MatchString(err.Error())
+	}
+}
+
+func isTimeout(err error) bool {
+	var serverTimeout *bcdb.ServerTimeout
+	var netErr net.Error
+	switch {
+	case errors.As(err, &serverTimeout), errors.Is(err, context.DeadlineExceeded):
+		return true
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return true
+	default:
+		return timeoutExp.MatchString(err.Error())
+	}
+}
+
+func isConnectionError(err error) bool {
+	var opErr *net.OpError
+	switch {
+	case errors.As(err, &opErr), errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET):
+		return true
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	default:
+		return connectionExp.MatchString(err.Error())
+	}
+}
+
+// ClassifyFlag returns the status of a TX according to its validation flag in the receipt.
+func ClassifyFlag(flag oriontypes.Flag) StatStatus {
+	switch flag {
+	case oriontypes.Flag_VALID:
+		return Success
+	case oriontypes.Flag_INVALID_MVCC_CONFLICT_WITHIN_BLOCK, oriontypes.Flag_INVALID_MVCC_CONFLICT_WITH_COMMITTED_STATE:
+		return Conflict
+	case oriontypes.Flag_INVALID_NO_PERMISSION, oriontypes.Flag_INVALID_UNAUTHORISED:
+		return PermissionDenied
+	case oriontypes.Flag_INVALID_MISSING_SIGNATURE:
+		return SignatureFailure
+	default:
+		return InvalidTx
+	}
+}
+
+// Classify returns the status of an operation according to its error.
+// A TX that was invalidated is classified by its validation flag, and other errors by their type or message.
+// Errors that do not match any class are classified as Failed.
+func Classify(err error) StatStatus {
+	if err == nil {
+		return Success
+	}
+	var validationErr *bcdb.ErrorTxValidation
+	if errors.As(err, &validationErr) {
+		flag, ok := oriontypes.Flag_value[validationErr.Flag]
+		if !ok {
+			// An unknown flag must not be mistaken for the zero value (VALID)
+			return InvalidTx
+		}
+		return ClassifyFlag(oriontypes.Flag(flag))
+	}
+	for _, c := range classifiers {
+		if c.match(err) {
+			return c.status
+		}
+	}
+	return Failed
+}
+
+// errorSampler logs a sample of the failures: at most one failure of each status per interval.
+// The number of the failures that were not logged is reported with the next sample.
+type errorSampler struct {
+	lg       *logger.SugarLogger
+	interval time.Duration
+	lock     sync.Mutex
+	last     map[StatStatus]time.Time
+	skipped  map[StatStatus]uint64
+}
+
+func newErrorSampler(lg *logger.SugarLogger, interval time.Duration) *errorSampler {
+	return &errorSampler{
+		lg:       lg,
+		interval: interval,
+		last:     map[StatStatus]time.Time{},
+		skipped:  map[StatStatus]uint64{},
+	}
+}
+
+func (e *errorSampler) log(operation StatOperation, status StatStatus, err error) {
+	e.lock.Lock()
+	now := time.Now()
+	if now.Sub(e.last[status]) < e.interval {
+		e.skipped[status]++
+		e.lock.Unlock()
+		return
+	}
+	skipped := e.skipped[status]
+	e.last[status] = now
+	e.skipped[status] = 0
+	e.lock.Unlock()
+
+	if skipped > 0 {
+		e.lg.Errorf("%s failed (%s): %s [%d similar failures were not logged]", operation, status, err, skipped)
+	} else {
+		e.lg.Errorf("%s failed (%s): %s", operation, status, err)
+	}
+}
@@ -0,0 +1,273 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package common
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"orion-bench/pkg/workload/fakedb"
+
+	"github.com/hyperledger-labs/orion-sdk-go/pkg/bcdb"
+	sdkconfig "github.com/hyperledger-labs/orion-sdk-go/pkg/config"
+	"github.com/hyperledger-labs/orion-server/pkg/logger"
+	oriontypes "github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testDB = "test-db"
+	// alice may write to the test DB, and carol has no permission on it
+	alice = "alice"
+	carol = "carol"
+)
+
+func newFakeSession(t *testing.T, db *fakedb.DB, userID string) bcdb.DBSession {
+	s, err := db.Session(&sdkconfig.SessionConfig{UserConfig: &sdkconfig.UserConfig{UserID: userID}})
+	require.NoError(t, err)
+	return s
+}
+
+// newFakeDB creates a fake BCDB with the test DB and its users.
+func newFakeDB(t *testing.T) *fakedb.DB {
+	db := fakedb.New("admin")
+	s := newFakeSession(t, db, "admin")
+	dbsTx, err := s.DBsTx()
+	require.NoError(t, err)
+	require.NoError(t, dbsTx.CreateDB(testDB, nil))
+	_, _, err = dbsTx.Commit(true)
+	require.NoError(t, err)
+
+	usersTx, err := s.UsersTx()
+	require.NoError(t, err)
+	require.NoError(t, usersTx.PutUser(&oriontypes.User{
+		Id: alice,
+		Privilege: &oriontypes.Privilege{
+			DbPermission: map[string]oriontypes.Privilege_Access{testDB: oriontypes.Privilege_ReadWrite},
+		},
+	}, nil))
+	require.NoError(t, usersTx.PutUser(&oriontypes.User{Id: carol, Privilege: &oriontypes.Privilege{}}, nil))
+	_, _, err = usersTx.Commit(true)
+	require.NoError(t, err)
+	return db
+}
+
+// fakeWrite synchronously commits a write of the user to the DB, and returns the commit's error.
+func fakeWrite(t *testing.T, db *fakedb.DB, userID string, dbName string, key string) error {
+	tx, err := newFakeSession(t, db, userID).DataTx()
+	require.NoError(t, err)
+	require.NoError(t, tx.Put(dbName, key, []byte("value"), nil))
+	_, _, err = tx.Commit(true)
+	return err
+}
+
+type classifyCase struct {
+	name   string
+	err    error
+	status StatStatus
+}
+
+// fakeErrors returns the errors of the fake BCDB with their expected status.
+func fakeErrors(t *testing.T) []classifyCase {
+	db := newFakeDB(t)
+	var errs []classifyCase
+	add := func(name string, err error, status StatStatus) {
+		require.Error(t, err, name)
+		errs = append(errs, classifyCase{name, err, status})
+	}
+
+	// Two TXs that read the same version of a key, and then write it
+	require.NoError(t, fakeWrite(t, db, alice, testDB, "key"))
+	var txs []bcdb.DataTxContext
+	for i := 0; i < 2; i++ {
+		tx, err := newFakeSession(t, db, alice).DataTx()
+		require.NoError(t, err)
+		_, _, err = tx.Get(testDB, "key")
+		require.NoError(t, err)
+		require.NoError(t, tx.Put(testDB, "key", []byte("new-value"), nil))
+		txs = append(txs, tx)
+	}
+	_, _, err := txs[0].Commit(true)
+	require.NoError(t, err)
+	_, _, err = txs[1].Commit(true)
+	add("mvcc conflict", err, Conflict)
+	_, _, err = txs[1].Commit(true)
+	add("spent TX", err, Failed)
+
+	add("no write permission", fakeWrite(t, db, carol, testDB, "key"), PermissionDenied)
+	add("unknown user", fakeWrite(t, db, "dave", testDB, "key"), PermissionDenied)
+	add("missing DB", fakeWrite(t, db, alice, "missing-db", "key"), InvalidTx)
+
+	// Resubmitting a committed TX
+	env, err := txs[0].CommittedTxEnvelope()
+	require.NoError(t, err)
+	loaded, err := newFakeSession(t, db, alice).LoadDataTx(env.(*oriontypes.DataTxEnvelope))
+	require.NoError(t, err)
+	_, _, err = loaded.Commit(true)
+	add("duplicate TX", err, DuplicateTx)
+
+	tx, err := newFakeSession(t, db, carol).DataTx()
+	require.NoError(t, err)
+	_, _, err = tx.Get(testDB, "key")
+	add("no read permission", err, PermissionDenied)
+	_, _, err = tx.Get("missing-db", "key")
+	add("read missing DB", err, Failed)
+	return errs
+}
+
+func TestClassifyFakeErrors(t *testing.T) {
+	for _, tc := range fakeErrors(t) {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.status, Classify(tc.err), tc.err.Error())
+			// The wrapped errors are classified the same
+			require.Equal(t, tc.status, Classify(errors.Wrap(tc.err, "failed to commit")))
+			require.Equal(t, tc.status, Classify(fmt.Errorf("failed to commit: %w", tc.err)))
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	for _, tc := range []classifyCase{
+		{"nil", nil, Success},
+		{"unknown", errors.New("something happened"), Failed},
+		{"full queue", errors.New("failed to submit transaction, server returned: transaction queue is full"), FullQueue},
+		// The more specific classes are matched first
+		{
+			"full queue with a timeout",
+			errors.New("timeout error: transaction queue is full"),
+			FullQueue,
+		},
+		{"server timeout", &bcdb.ServerTimeout{TxID: "tx"}, Timeout},
+		{"deadline exceeded", errors.Wrap(context.DeadlineExceeded, "failed to submit"), Timeout},
+		{"net timeout", &net.DNSError{Err: "i/o timeout", IsTimeout: true}, Timeout},
+		{"request timeout", errors.New("status code: 408 Request Timeout"), Timeout},
+		{"duplicate", errors.New("status: 400 Bad Request, message: Duplicate TxID: tx"), DuplicateTx},
+		{"signature", errors.New("signature verification failed"), SignatureFailure},
+		{"forbidden", errors.New("status code: 403"), PermissionDenied},
+		{"redirect", errors.New("status code: 307 Temporary Redirect"), LeaderChange},
+		{"no leader", errors.New("failed to select replica"), LeaderChange},
+		{"op error", &net.OpError{Op: "dial", Err: errors.New("refused")}, ConnectionError},
+		{"refused", errors.Wrap(syscall.ECONNREFUSED, "failed to submit"), ConnectionError},
+		{"reset", errors.Wrap(syscall.ECONNRESET, "failed to submit"), ConnectionError},
+		{"eof", errors.Wrap(io.EOF, "failed to read the response"), ConnectionError},
+		{"unexpected eof", io.ErrUnexpectedEOF, ConnectionError},
+		{"no such host", errors.New("dial tcp: lookup node1: no such host"), ConnectionError},
+		// A validation error is classified by its flag, regardless of its reason
+		{
+			"validation error with a timeout reason",
+			&bcdb.ErrorTxValidation{
+				TxID: "tx", Flag: oriontypes.Flag_INVALID_MVCC_CONFLICT_WITHIN_BLOCK.String(), Reason: "timeout error",
+			},
+			Conflict,
+		},
+		{
+			"validation error with a permission reason",
+			&bcdb.ErrorTxValidation{
+				TxID:   "tx",
+				Flag:   oriontypes.Flag_INVALID_INCORRECT_ENTRIES.String(),
+				Reason: "the user [alice] has no write permission",
+			},
+			InvalidTx,
+		},
+		{
+			"validation error with an unknown flag",
+			&bcdb.ErrorTxValidation{TxID: "tx", Flag: "INVALID_SOMETHING", Reason: "connection refused"},
+			InvalidTx,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.status, Classify(tc.err))
+		})
+	}
+}
+
+func TestClassifyFlag(t *testing.T) {
+	for flag, status := range map[oriontypes.Flag]StatStatus{
+		oriontypes.Flag_VALID:                                      Success,
+		oriontypes.Flag_INVALID_MVCC_CONFLICT_WITHIN_BLOCK:         Conflict,
+		oriontypes.Flag_INVALID_MVCC_CONFLICT_WITH_COMMITTED_STATE: Conflict,
+		oriontypes.Flag_INVALID_NO_PERMISSION:                      PermissionDenied,
+		oriontypes.Flag_INVALID_UNAUTHORISED:                       PermissionDenied,
+		oriontypes.Flag_INVALID_MISSING_SIGNATURE:                  SignatureFailure,
+		oriontypes.Flag_INVALID_DATABASE_DOES_NOT_EXIST:            InvalidTx,
+		oriontypes.Flag_INVALID_INCORRECT_ENTRIES:                  InvalidTx,
+	} {
+		require.Equal(t, status, ClassifyFlag(flag), flag.String())
+	}
+}
+
+// newTestLogger returns a logger that writes to a file, and a function that returns the logged failures' lines,
+// without their stack traces.
+func newTestLogger(t *testing.T) (*logger.SugarLogger, func() []string) {
+	path := filepath.Join(t.TempDir(), "log")
+	lg, err := logger.New(&logger.Config{
+		Level:         "info",
+		OutputPath:    []string{path},
+		ErrOutputPath: []string{"stderr"},
+		Encoding:      "console",
+		Name:          "orion-bench-test",
+	})
+	require.NoError(t, err)
+	return lg, func() []string {
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+		var lines []string
+		for _, line := range strings.Split(string(b), "\n") {
+			if strings.Contains(line, " failed (") {
+				lines = append(lines, line)
+			}
+		}
+		return lines
+	}
+}
+
+func TestErrorSampler(t *testing.T) {
+	lg, lines := newTestLogger(t)
+	e := newErrorSampler(lg, time.Hour)
+	timeoutErr := errors.New("timeout error")
+	conflictErr := errors.New("mvcc conflict")
+
+	e.log(SyncCommit, Timeout, timeoutErr)
+	e.log(SyncCommit, Timeout, timeoutErr)
+	e.log(Read, Timeout, timeoutErr)
+	// Each status is sampled independently
+	e.log(SyncCommit, Conflict, conflictErr)
+	e.log(SyncCommit, Conflict, conflictErr)
+	logged := lines()
+	require.Len(t, logged, 2)
+	require.Contains(t, logged[0], "sync_commit failed (timeout): timeout error")
+	require.Contains(t, logged[1], "sync_commit failed (mvcc_conflict): mvcc conflict")
+	require.Equal(t, map[StatStatus]uint64{Timeout: 2, Conflict: 1}, e.skipped)
+
+	// The next sample of a status reports the failures that were skipped since its previous sample
+	e.last[Timeout] = time.Now().Add(-time.Hour)
+	e.log(Read, Timeout, timeoutErr)
+	e.log(Read, Timeout, timeoutErr)
+	logged = lines()
+	require.Len(t, logged, 3)
+	require.Contains(t, logged[2], "read failed (timeout): timeout error [2 similar failures were not logged]")
+	require.Equal(t, map[StatStatus]uint64{Timeout: 1, Conflict: 1}, e.skipped)
+}
+
+func TestErrorSamplerNoInterval(t *testing.T) {
+	lg, lines := newTestLogger(t)
+	e := newErrorSampler(lg, 0)
+	for i := 0; i < 3; i++ {
+		e.log(Write, Failed, errors.Errorf("failure %d", i))
+	}
+	logged := lines()
+	require.Len(t, logged, 3)
+	for i, line := range logged {
+		require.Contains(t, line, fmt.Sprintf("write failed (failed): failure %d", i))
+		require.NotContains(t, line, "similar failures")
+	}
+}
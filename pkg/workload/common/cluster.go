@@ -0,0 +1,186 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// imbalanceThreshold is the relative deviation from the mean rank throughput that is reported as imbalanced.
+const imbalanceThreshold = 0.1
+
+// MergeReports merges the reports of multiple ranks into a single report.
+// The histograms are merged losslessly, and the statistics are recomputed from the merged histograms.
+func MergeReports(workType string, reports []*Report) *Report {
+	merged := &Report{WorkType: workType, Quantiles: ReportQuantiles}
+	type entry struct {
+		histogram *Histogram
+		items     uint64
+	}
+	entries := map[histogramKey]*entry{}
+	for _, r := range reports {
+		merged.MergedRanks = append(merged.MergedRanks, r.Rank)
+		if merged.Start.IsZero() || r.Start.Before(merged.Start) {
+			merged.Start = r.Start
+		}
+		if r.End.After(merged.End) {
+			merged.End = r.End
+		}
+		if merged.Crypto == "" {
+			merged.Crypto = r.Crypto
+		}
+		for _, op := range r.Operations {
+			key := histogramKey{operation: op.Operation, status: op.Status}
+			e, ok := entries[key]
+			if !ok {
+				e = &entry{histogram: NewHistogram()}
+				entries[key] = e
+			}
+			e.histogram.Merge(op.Histogram)
+			e.items += op.Items
+		}
+	}
+
+	for key, e := range entries {
+		merged.Operations = append(merged.Operations, NewOperationReport(
+			key.operation, key.status, e.items, e.histogram, merged.Duration(),
+		))
+	}
+	merged.Blocks = MergeBlockReports(reports)
+	merged.Sort()
+	return merged
+}
+
+// SuccessHistogram merges the histograms of all the successful operations.
+func (r *Report) SuccessHistogram() *Histogram {
+	h := NewHistogram()
+	for _, op := range r.Operations {
+		if op.Status == Success {
+			h.Merge(op.Histogram)
+		}
+	}
+	return h
+}
+
+// RankSummary summarizes the successful operations of a single rank.
+type RankSummary struct {
+	Rank       uint64        `json:"rank"`
+	Count      uint64        `json:"count"`
+	Errors     uint64        `json:"errors"`
+	Throughput float64       `json:"throughput"`
+	Share      float64       `json:"share"`
+	Deviation  float64       `json:"deviation"`
+	P50        time.Duration `json:"p50"`
+	P99        time.Duration `json:"p99"`
+	Imbalanced bool          `json:"imbalanced"`
+}
+
+// ClusterReport is the cluster-wide summary of all the worker ranks.
+type ClusterReport struct {
+	WorkType string         `json:"work-type"`
+	Total    *Report        `json:"total"`
+	Ranks    []*RankSummary `json:"ranks"`
+	Missing  []uint64       `json:"missing"`
+	// The ratio between the maximal and minimal rank throughput
+	MaxMinRatio float64 `json:"max-min-ratio"`
+	// The coefficient of variation of the ranks' throughput
+	CV float64 `json:"cv"`
+}
+
+func NewClusterReport(workType string, reports []*Report, missing []uint64) *ClusterReport {
+	c := &ClusterReport{
+		WorkType: workType,
+		Total:    MergeReports(workType, reports),
+		Missing:  missing,
+	}
+
+	var total, sum, sumSq float64
+	minThroughput, maxThroughput := math.Inf(1), 0.0
+	for _, r := range reports {
+		h := r.SuccessHistogram()
+		s := &RankSummary{
+			Rank:  r.Rank,
+			Count: h.Count(),
+			P50:   h.Quantile(0.5),
+			P99:   h.Quantile(0.99),
+		}
+		for _, e := range r.Errors() {
+			s.Errors += e
+		}
+		if d := r.Duration(); d > 0 {
+			s.Throughput = float64(s.Count) / d.Seconds()
+		}
+		total += float64(s.Count)
+		sum += s.Throughput
+		sumSq += s.Throughput * s.Throughput
+		minThroughput = math.Min(minThroughput, s.Throughput)
+		maxThroughput = math.Max(maxThroughput, s.Throughput)
+		c.Ranks = append(c.Ranks, s)
+	}
+
+	n := float64(len(c.Ranks))
+	if n == 0 {
+		return c
+	}
+	mean := sum / n
+	for _, s := range c.Ranks {
+		if total > 0 {
+			s.Share = float64(s.Count) / total
+		}
+		if mean > 0 {
+			s.Deviation = (s.Throughput - mean) / mean
+		}
+		s.Imbalanced = math.Abs(s.Deviation) > imbalanceThreshold
+	}
+	if mean > 0 {
+		c.CV = math.Sqrt(math.Max(0, sumSq/n-mean*mean)) / mean
+	}
+	if minThroughput > 0 {
+		c.MaxMinRatio = maxThroughput / minThroughput
+	}
+	return c
+}
+
+// Text returns the cluster report as a human-readable text.
+func (c *ClusterReport) Text() string {
+	buf := &bytes.Buffer{}
+	buf.WriteString(c.Total.Text())
+	if len(c.Missing) > 0 {
+		_, _ = fmt.Fprintf(buf, "Missing ranks: %v\n", c.Missing)
+	}
+
+	_, _ = fmt.Fprintf(buf, "\nPer-rank breakdown (successful operations):\n")
+	tw := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tw, "rank\tcount\terrors\tthroughput (op/s)\tshare\tdeviation\tp50\tp99\t\n")
+	for _, s := range c.Ranks {
+		mark := ""
+		if s.Imbalanced {
+			mark = "imbalanced"
+		}
+		_, _ = fmt.Fprintf(tw, "%d\t%d\t%d\t%.2f\t%.2f%%\t%+.2f%%\t%s\t%s\t%s\n",
+			s.Rank, s.Count, s.Errors, s.Throughput, s.Share*100, s.Deviation*100,
+			formatLatency(s.P50), formatLatency(s.P99), mark)
+	}
+	_ = tw.Flush()
+	_, _ = fmt.Fprintf(buf, "Imbalance: max/min throughput: %.3f, coefficient of variation: %.3f\n",
+		c.MaxMinRatio, c.CV)
+	return buf.String()
+}
+
+// Write saves the cluster report as text and JSON. The path should not include an extension.
+func (c *ClusterReport) Write(path string, perm os.FileMode) error {
+	if err := os.WriteFile(path+".txt", []byte(c.Text()), perm); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path+".json", b, perm)
+}
@@ -0,0 +1,193 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testStart = time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// testReport returns a report of a rank with the given operations, that ran for the duration after the offset
+// from testStart.
+func testReport(rank uint64, offset time.Duration, duration time.Duration, ops ...*OperationReport) *Report {
+	r := &Report{
+		WorkType:   "benchmark",
+		Rank:       rank,
+		Start:      testStart.Add(offset),
+		End:        testStart.Add(offset + duration),
+		Quantiles:  ReportQuantiles,
+		Operations: ops,
+	}
+	r.Sort()
+	return r
+}
+
+// testOperation returns an operation report with count executions of the given latency, and two items each.
+func testOperation(operation StatOperation, status StatStatus, count int, latency time.Duration) *OperationReport {
+	h := NewHistogram()
+	for i := 0; i < count; i++ {
+		h.Record(latency)
+	}
+	return NewOperationReport(operation, status, uint64(2*count), h, 0)
+}
+
+func TestMergeReports(t *testing.T) {
+	r0 := testReport(0, time.Second, 10*time.Second,
+		testOperation(Write, Success, 10, time.Millisecond),
+		testOperation(Write, Conflict, 2, 5*time.Millisecond),
+	)
+	r0.Crypto = "identity: ecdsa P-256"
+	r0.Blocks = &BlockReport{Count: 5, Interval: NewHistogram()}
+	r1 := testReport(1, 0, 5*time.Second,
+		testOperation(Write, Success, 30, 3*time.Millisecond),
+		testOperation(Read, Success, 5, time.Microsecond),
+	)
+	r1.Blocks = &BlockReport{Count: 7, Interval: NewHistogram()}
+
+	merged := MergeReports("benchmark", []*Report{r0, r1})
+	require.Equal(t, []uint64{0, 1}, merged.MergedRanks)
+	// The merged report spans from the earliest start to the latest end
+	require.Equal(t, testStart, merged.Start)
+	require.Equal(t, testStart.Add(11*time.Second), merged.End)
+	require.Equal(t, r0.Crypto, merged.Crypto)
+	require.Same(t, r1.Blocks, merged.Blocks, "the blocks of the rank that observed the most blocks")
+
+	require.Len(t, merged.Operations, 3)
+	read, conflict, write := merged.Operations[0], merged.Operations[1], merged.Operations[2]
+	require.Equal(t, []StatOperation{Read, Write, Write},
+		[]StatOperation{read.Operation, conflict.Operation, write.Operation})
+	require.Equal(t, []StatStatus{Success, Conflict, Success}, []StatStatus{read.Status, conflict.Status, write.Status})
+
+	// The histograms are merged losslessly, and the statistics are recomputed over the merged duration
+	expected := NewHistogram()
+	expected.Merge(r0.Operations[1].Histogram)
+	expected.Merge(r1.Operations[1].Histogram)
+	require.Equal(t, expected.counts, write.Histogram.counts)
+	require.Equal(t, uint64(40), write.Count)
+	require.Equal(t, uint64(80), write.Items)
+	require.InDelta(t, 40/11.0, write.Throughput, 1e-9)
+	require.Equal(t, 3*time.Millisecond, write.Max)
+	require.Equal(t, expected.Quantile(0.5), write.Quantiles[0])
+	require.Equal(t, uint64(2), conflict.Count)
+	require.Equal(t, map[StatStatus]uint64{Conflict: 2}, merged.Errors())
+
+	// The merged reports are not modified
+	require.Equal(t, uint64(10), r0.Operations[1].Histogram.Count())
+	require.Equal(t, uint64(30), r1.Operations[1].Histogram.Count())
+}
+
+func TestNewClusterReport(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		counts     []int
+		share      []float64
+		deviation  []float64
+		imbalanced []bool
+		cv         float64
+		maxMin     float64
+	}{
+		{
+			name:       "balanced",
+			counts:     []int{200, 200, 200},
+			share:      []float64{1.0 / 3, 1.0 / 3, 1.0 / 3},
+			deviation:  []float64{0, 0, 0},
+			imbalanced: []bool{false, false, false},
+			cv:         0,
+			maxMin:     1,
+		},
+		{
+			name:       "imbalanced",
+			counts:     []int{100, 300},
+			share:      []float64{0.25, 0.75},
+			deviation:  []float64{-0.5, 0.5},
+			imbalanced: []bool{true, true},
+			cv:         0.5,
+			maxMin:     3,
+		},
+		{
+			name:       "within the threshold",
+			counts:     []int{95, 105},
+			share:      []float64{0.475, 0.525},
+			deviation:  []float64{-0.05, 0.05},
+			imbalanced: []bool{false, false},
+			cv:         0.05,
+			maxMin:     105.0 / 95,
+		},
+		{
+			name:       "a rank with no successes",
+			counts:     []int{0, 100},
+			share:      []float64{0, 1},
+			deviation:  []float64{-1, 1},
+			imbalanced: []bool{true, true},
+			cv:         1,
+			// The ratio is undefined, since the minimal throughput is zero
+			maxMin: 0,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var reports []*Report
+			for i, count := range tc.counts {
+				reports = append(reports, testReport(uint64(i), 0, 10*time.Second,
+					testOperation(Write, Success, count, time.Millisecond),
+					testOperation(Write, Timeout, i, time.Second),
+				))
+			}
+
+			c := NewClusterReport("benchmark", reports, []uint64{7})
+			require.Equal(t, []uint64{7}, c.Missing)
+			require.Equal(t, "benchmark", c.WorkType)
+			require.Len(t, c.Ranks, len(tc.counts))
+			for i, s := range c.Ranks {
+				require.Equal(t, uint64(i), s.Rank)
+				require.Equal(t, uint64(tc.counts[i]), s.Count)
+				require.Equal(t, uint64(i), s.Errors)
+				require.InDelta(t, float64(tc.counts[i])/10, s.Throughput, 1e-9, "rank %d", i)
+				require.InDelta(t, tc.share[i], s.Share, 1e-9, "rank %d", i)
+				require.InDelta(t, tc.deviation[i], s.Deviation, 1e-9, "rank %d", i)
+				require.Equal(t, tc.imbalanced[i], s.Imbalanced, "rank %d", i)
+			}
+			require.InDelta(t, tc.cv, c.CV, 1e-9)
+			require.InDelta(t, tc.maxMin, c.MaxMinRatio, 1e-9)
+		})
+	}
+
+	t.Run("no reports", func(t *testing.T) {
+		c := NewClusterReport("benchmark", nil, []uint64{0, 1})
+		require.Empty(t, c.Ranks)
+		require.Equal(t, []uint64{0, 1}, c.Missing)
+		require.Zero(t, c.CV)
+	})
+}
+
+func TestReadReportWithoutHistogram(t *testing.T) {
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		name string
+		json string
+		err  string
+	}{
+		{
+			name: "operation",
+			json: `{"work-type": "benchmark", "operations": [{"operation": "write", "status": "successful"}]}`,
+			err:  "operation write (successful) has no histogram",
+		},
+		{
+			name: "blocks",
+			json: `{"work-type": "benchmark", "blocks": {"count": 1}}`,
+			err:  "blocks have no interval histogram",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(dir, tc.name+".json")
+			require.NoError(t, os.WriteFile(path, []byte(tc.json), 0644))
+			_, err := ReadReport(path)
+			require.EqualError(t, err, "invalid report: "+path+": "+tc.err)
+		})
+	}
+}
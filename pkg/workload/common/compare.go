@@ -0,0 +1,242 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"orion-bench/pkg/types"
+
+	"github.com/pkg/errors"
+)
+
+// OperationStats are the statistics of the successful executions of an operation.
+type OperationStats struct {
+	Count      uint64          `json:"count"`
+	Throughput float64         `json:"throughput"`
+	ErrorRate  float64         `json:"error-rate"`
+	Mean       time.Duration   `json:"mean"`
+	Quantiles  []time.Duration `json:"quantiles"`
+}
+
+// OperationDelta compares the statistics of an operation in two reports.
+// The throughput and latency deltas are relative to the baseline, and the error rate delta is absolute.
+type OperationDelta struct {
+	Operation       StatOperation   `json:"operation"`
+	Baseline        *OperationStats `json:"baseline"`
+	Candidate       *OperationStats `json:"candidate"`
+	ThroughputDelta float64         `json:"throughput-delta"`
+	MeanDelta       float64         `json:"mean-delta"`
+	QuantilesDelta  []float64       `json:"quantiles-delta"`
+	ErrorRateDelta  float64         `json:"error-rate-delta"`
+	Violations      []string        `json:"violations"`
+}
+
+// Comparison is the per-operation comparison of a candidate report to a baseline report.
+type Comparison struct {
+	Baseline   string                `json:"baseline"`
+	Candidate  string                `json:"candidate"`
+	Conf       *types.ComparisonConf `json:"conf"`
+	Operations []*OperationDelta     `json:"operations"`
+	Passed     bool                  `json:"passed"`
+}
+
+// ReadAnyReport reads a worker report or the total of a cluster report that were saved as JSON.
+func ReadAnyReport(path string) (*Report, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &Report{}
+	c := &ClusterReport{}
+	if err = json.Unmarshal(b, c); err == nil && c.Total != nil {
+		r = c.Total
+	} else if err = json.Unmarshal(b, r); err != nil {
+		return nil, err
+	}
+	if err = r.validate(); err != nil {
+		return nil, errors.WithMessagef(err, "invalid report: %s", path)
+	}
+	return r, nil
+}
+
+func (r *Report) operationStats(quantiles []float64) map[StatOperation]*OperationStats {
+	histograms := map[StatOperation]*Histogram{}
+	failed := map[StatOperation]uint64{}
+	for _, op := range r.Operations {
+		if _, ok := histograms[op.Operation]; !ok {
+			histograms[op.Operation] = NewHistogram()
+		}
+		if op.Status == Success {
+			histograms[op.Operation].Merge(op.Histogram)
+		} else {
+			failed[op.Operation] += op.Count
+		}
+	}
+
+	stats := map[StatOperation]*OperationStats{}
+	for operation, h := range histograms {
+		s := &OperationStats{Count: h.Count(), Mean: h.Mean()}
+		if d := r.Duration(); d > 0 {
+			s.Throughput = float64(s.Count) / d.Seconds()
+		}
+		if total := s.Count + failed[operation]; total > 0 {
+			s.ErrorRate = float64(failed[operation]) / float64(total)
+		}
+		for _, q := range quantiles {
+			s.Quantiles = append(s.Quantiles, h.Quantile(q))
+		}
+		stats[operation] = s
+	}
+	return stats
+}
+
+func relativeDelta(baseline float64, candidate float64) float64 {
+	if baseline == 0 {
+		return 0
+	}
+	return (candidate - baseline) / baseline
+}
+
+// Compare compares the successful operations of the candidate to the baseline.
+// Operations with fewer samples than the configured minimum in the baseline are not checked against the thresholds.
+func Compare(
+	conf *types.ComparisonConf, baselinePath string, baseline *Report, candidatePath string, candidate *Report,
+) *Comparison {
+	c := &Comparison{
+		Baseline:  baselinePath,
+		Candidate: candidatePath,
+		Conf:      conf,
+		Passed:    true,
+	}
+	baseStats := baseline.operationStats(conf.Quantiles)
+	candStats := candidate.operationStats(conf.Quantiles)
+
+	var operations []string
+	for op := range baseStats {
+		operations = append(operations, string(op))
+	}
+	for op := range candStats {
+		if _, ok := baseStats[op]; !ok {
+			operations = append(operations, string(op))
+		}
+	}
+	sort.Strings(operations)
+
+	for _, op := range operations {
+		d := &OperationDelta{
+			Operation: StatOperation(op),
+			Baseline:  baseStats[StatOperation(op)],
+			Candidate: candStats[StatOperation(op)],
+		}
+		c.Operations = append(c.Operations, d)
+		if d.Baseline == nil {
+			continue
+		}
+		if d.Candidate == nil {
+			d.Violations = append(d.Violations, "missing in candidate")
+			c.Passed = false
+			continue
+		}
+
+		d.ThroughputDelta = relativeDelta(d.Baseline.Throughput, d.Candidate.Throughput)
+		d.MeanDelta = relativeDelta(float64(d.Baseline.Mean), float64(d.Candidate.Mean))
+		d.ErrorRateDelta = d.Candidate.ErrorRate - d.Baseline.ErrorRate
+		for i, q := range conf.Quantiles {
+			d.QuantilesDelta = append(d.QuantilesDelta,
+				relativeDelta(float64(d.Baseline.Quantiles[i]), float64(d.Candidate.Quantiles[i])))
+			if d.Baseline.Count >= conf.MinCount && d.QuantilesDelta[i] > conf.MaxLatencyIncrease {
+				d.Violations = append(d.Violations, fmt.Sprintf("p%g increased", q*100))
+			}
+		}
+		if d.Baseline.Count >= conf.MinCount {
+			if -d.ThroughputDelta > conf.MaxThroughputDecrease {
+				d.Violations = append(d.Violations, "throughput decreased")
+			}
+			if d.ErrorRateDelta > conf.MaxErrorRateIncrease {
+				d.Violations = append(d.Violations, "error rate increased")
+			}
+		}
+		if len(d.Violations) > 0 {
+			c.Passed = false
+		}
+	}
+	return c
+}
+
+func formatStats(s *OperationStats, f func(s *OperationStats) string) string {
+	if s == nil {
+		return "-"
+	}
+	return f(s)
+}
+
+// Text returns the comparison as a human-readable table.
+func (c *Comparison) Text() string {
+	buf := &bytes.Buffer{}
+	_, _ = fmt.Fprintf(buf, "Baseline: %s\nCandidate: %s\n", c.Baseline, c.Candidate)
+	tw := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tw, "operation\tthroughput (op/s)\tdelta\terror rate\tdelta\tmean\tdelta")
+	for _, q := range c.Conf.Quantiles {
+		_, _ = fmt.Fprintf(tw, "\tp%g\tdelta", q*100)
+	}
+	_, _ = fmt.Fprintf(tw, "\tresult\n")
+
+	for _, d := range c.Operations {
+		_, _ = fmt.Fprintf(tw, "%s\t%s -> %s\t%+.2f%%\t%s -> %s\t%+.4f\t%s -> %s\t%+.2f%%",
+			d.Operation,
+			formatStats(d.Baseline, func(s *OperationStats) string { return fmt.Sprintf("%.2f", s.Throughput) }),
+			formatStats(d.Candidate, func(s *OperationStats) string { return fmt.Sprintf("%.2f", s.Throughput) }),
+			d.ThroughputDelta*100,
+			formatStats(d.Baseline, func(s *OperationStats) string { return fmt.Sprintf("%.4f", s.ErrorRate) }),
+			formatStats(d.Candidate, func(s *OperationStats) string { return fmt.Sprintf("%.4f", s.ErrorRate) }),
+			d.ErrorRateDelta,
+			formatStats(d.Baseline, func(s *OperationStats) string { return formatLatency(s.Mean) }),
+			formatStats(d.Candidate, func(s *OperationStats) string { return formatLatency(s.Mean) }),
+			d.MeanDelta*100,
+		)
+		for i := range c.Conf.Quantiles {
+			delta := 0.0
+			if i < len(d.QuantilesDelta) {
+				delta = d.QuantilesDelta[i]
+			}
+			_, _ = fmt.Fprintf(tw, "\t%s -> %s\t%+.2f%%",
+				formatStats(d.Baseline, func(s *OperationStats) string { return formatLatency(s.Quantiles[i]) }),
+				formatStats(d.Candidate, func(s *OperationStats) string { return formatLatency(s.Quantiles[i]) }),
+				delta*100,
+			)
+		}
+		result := "ok"
+		if len(d.Violations) > 0 {
+			result = strings.Join(d.Violations, ", ")
+		}
+		_, _ = fmt.Fprintf(tw, "\t%s\n", result)
+	}
+	_ = tw.Flush()
+
+	if c.Passed {
+		_, _ = fmt.Fprintf(buf, "PASSED: no regression beyond the tolerance thresholds.\n")
+	} else {
+		_, _ = fmt.Fprintf(buf, "FAILED: regression beyond the tolerance thresholds.\n")
+	}
+	return buf.String()
+}
+
+// Write saves the comparison as text and JSON. The path should not include an extension.
+func (c *Comparison) Write(path string, perm os.FileMode) error {
+	if err := os.WriteFile(path+".txt", []byte(c.Text()), perm); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path+".json", b, perm)
+}
@@ -0,0 +1,142 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"orion-bench/pkg/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testComparisonConf() *types.ComparisonConf {
+	return &types.ComparisonConf{
+		MaxThroughputDecrease: 0.05,
+		MaxLatencyIncrease:    0.1,
+		MaxErrorRateIncrease:  0.01,
+		Quantiles:             []float64{0.5, 0.99},
+		MinCount:              100,
+	}
+}
+
+func TestCompare(t *testing.T) {
+	// The baseline writes 1000 operations of 10ms in 10s, with no errors
+	baseline := testReport(0, 0, 10*time.Second, testOperation(Write, Success, 1000, 10*time.Millisecond))
+
+	for _, tc := range []struct {
+		name       string
+		candidate  []*OperationReport
+		violations []string
+	}{
+		{
+			name:      "same",
+			candidate: []*OperationReport{testOperation(Write, Success, 1000, 10*time.Millisecond)},
+		},
+		{
+			name:      "within the thresholds",
+			candidate: []*OperationReport{testOperation(Write, Success, 960, 10800*time.Microsecond)},
+		},
+		{
+			name:       "throughput decreased",
+			candidate:  []*OperationReport{testOperation(Write, Success, 900, 10*time.Millisecond)},
+			violations: []string{"throughput decreased"},
+		},
+		{
+			name:       "latency increased",
+			candidate:  []*OperationReport{testOperation(Write, Success, 1000, 12*time.Millisecond)},
+			violations: []string{"p50 increased", "p99 increased"},
+		},
+		{
+			name: "error rate increased",
+			candidate: []*OperationReport{
+				testOperation(Write, Success, 1000, 10*time.Millisecond),
+				testOperation(Write, Conflict, 50, 10*time.Millisecond),
+			},
+			violations: []string{"error rate increased"},
+		},
+		{
+			name:       "missing in candidate",
+			candidate:  []*OperationReport{testOperation(Read, Success, 1000, 10*time.Millisecond)},
+			violations: []string{"missing in candidate"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			candidate := testReport(0, 0, 10*time.Second, tc.candidate...)
+			c := Compare(testComparisonConf(), "baseline.json", baseline, "candidate.json", candidate)
+			require.Equal(t, len(tc.violations) == 0, c.Passed)
+
+			var write *OperationDelta
+			for _, d := range c.Operations {
+				if d.Operation == Write {
+					write = d
+				} else {
+					// An operation that is only in the candidate is reported, but not checked
+					require.Nil(t, d.Baseline)
+					require.Empty(t, d.Violations)
+				}
+			}
+			require.NotNil(t, write)
+			require.Equal(t, tc.violations, write.Violations)
+			require.Contains(t, c.Text(), "write")
+		})
+	}
+}
+
+func TestCompareMinCount(t *testing.T) {
+	// The baseline has fewer samples than the minimal count, so its regressions are not checked
+	baseline := testReport(0, 0, 10*time.Second, testOperation(Write, Success, 99, 10*time.Millisecond))
+	candidate := testReport(0, 0, 10*time.Second,
+		testOperation(Write, Success, 50, 20*time.Millisecond),
+		testOperation(Write, Timeout, 50, time.Second),
+	)
+	c := Compare(testComparisonConf(), "baseline.json", baseline, "candidate.json", candidate)
+	require.True(t, c.Passed)
+	require.Len(t, c.Operations, 1)
+	d := c.Operations[0]
+	require.Empty(t, d.Violations)
+	require.InDelta(t, -49.0/99, d.ThroughputDelta, 1e-9)
+	require.InDelta(t, 0.5, d.ErrorRateDelta, 1e-9)
+	require.InDelta(t, 1, d.QuantilesDelta[0], 0.01)
+
+	// An operation that is missing in the candidate fails regardless of its count
+	candidate = testReport(0, 0, 10*time.Second, testOperation(Read, Success, 50, time.Millisecond))
+	c = Compare(testComparisonConf(), "baseline.json", baseline, "candidate.json", candidate)
+	require.False(t, c.Passed)
+}
+
+func TestReadAnyReport(t *testing.T) {
+	dir := t.TempDir()
+	worker := testReport(3, 0, 10*time.Second, testOperation(Write, Success, 10, time.Millisecond))
+	workerPath := filepath.Join(dir, "worker")
+	require.NoError(t, worker.Write(workerPath, 0644))
+
+	r0 := testReport(0, 0, 10*time.Second, testOperation(Write, Success, 10, time.Millisecond))
+	r1 := testReport(1, 0, 10*time.Second, testOperation(Write, Success, 30, time.Millisecond))
+	cluster := NewClusterReport("benchmark", []*Report{r0, r1}, nil)
+	clusterPath := filepath.Join(dir, "cluster")
+	require.NoError(t, cluster.Write(clusterPath, 0644))
+
+	r, err := ReadAnyReport(workerPath + ".json")
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), r.Rank)
+	require.Nil(t, r.MergedRanks)
+	require.Equal(t, uint64(10), r.Operations[0].Histogram.Count())
+
+	// The total of a cluster report is read
+	r, err = ReadAnyReport(clusterPath + ".json")
+	require.NoError(t, err)
+	require.Equal(t, []uint64{0, 1}, r.MergedRanks)
+	require.Equal(t, uint64(40), r.Operations[0].Histogram.Count())
+
+	invalidPath := filepath.Join(dir, "invalid.json")
+	require.NoError(t, os.WriteFile(invalidPath, []byte(`{"total": {"operations": [{"operation": "write"}]}}`), 0644))
+	_, err = ReadAnyReport(invalidPath)
+	require.EqualError(t, err, "invalid report: "+invalidPath+": operation write () has no histogram")
+
+	_, err = ReadAnyReport(filepath.Join(dir, "missing.json"))
+	require.Error(t, err)
+}
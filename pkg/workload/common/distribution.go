@@ -0,0 +1,118 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package common
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	fnvOffsetBasis64 = 0xCBF29CE484222325
+	fnvPrime64       = 1099511628211
+)
+
+// FNVHash64 hashes a value using the 64-bit FNV-1a hash (the same as YCSB's Utils.fnvhash64).
+func FNVHash64(v uint64) uint64 {
+	hash := uint64(fnvOffsetBasis64)
+	for i := 0; i < 8; i++ {
+		octet := v & 0xff
+		v >>= 8
+		hash ^= octet
+		hash *= fnvPrime64
+	}
+	// YCSB returns the absolute value of the signed hash
+	if int64(hash) < 0 {
+		return uint64(-int64(hash))
+	}
+	return hash
+}
+
+// Zipfian draws values in [0, n) where the smaller values are more popular.
+// It follows YCSB's ZipfianGenerator ("Quickly Generating Billion-Record Synthetic Databases", Gray et al.).
+// It is immutable after creation, so it can be shared between users that use their own random source.
+type Zipfian struct {
+	n     uint64
+	theta float64
+	alpha float64
+	zetan float64
+	eta   float64
+}
+
+// ZipfianConstant is YCSB's default zipfian constant.
+const ZipfianConstant = 0.99
+
+func zeta(n uint64, theta float64) float64 {
+	sum := 0.0
+	for i := uint64(1); i <= n; i++ {
+		sum += 1 / math.Pow(float64(i), theta)
+	}
+	return sum
+}
+
+// NewZipfian creates a zipfian distribution over n values. The constant theta must be in (0, 1).
+func NewZipfian(n uint64, theta float64) (*Zipfian, error) {
+	if n == 0 {
+		return nil, errors.New("zipfian distribution must have at least one value")
+	}
+	if theta <= 0 || theta >= 1 {
+		return nil, errors.Errorf("zipfian constant must be in (0, 1), got: %g", theta)
+	}
+	zetan := zeta(n, theta)
+	zeta2 := zeta(2, theta)
+	return &Zipfian{
+		n:     n,
+		theta: theta,
+		alpha: 1 / (1 - theta),
+		zetan: zetan,
+		eta:   (1 - math.Pow(2/float64(n), 1-theta)) / (1 - zeta2/zetan),
+	}, nil
+}
+
+func (z *Zipfian) Next(r *rand.Rand) uint64 {
+	u := r.Float64()
+	uz := u * z.zetan
+	var v uint64
+	if uz < 1 {
+		v = 0
+	} else if uz < 1+math.Pow(0.5, z.theta) {
+		v = 1
+	} else {
+		v = uint64(float64(z.n) * math.Pow(z.eta*u-z.eta+1, z.alpha))
+	}
+	if v >= z.n {
+		v = z.n - 1
+	}
+	return v
+}
+
+// NextScrambled draws a zipfian value, and scatters the popular values across the range using a hash.
+func (z *Zipfian) NextScrambled(r *rand.Rand) uint64 {
+	return FNVHash64(z.Next(r)) % z.n
+}
+
+// Hotspot draws values in [0, n), where the values in [0, hotSize) are drawn with the hot probability,
+// and the rest are drawn uniformly.
+type Hotspot struct {
+	n              uint64
+	hotSize        uint64
+	hotProbability float64
+}
+
+// NewHotspot creates a hotspot distribution where the hot fraction of the values are in the hotspot.
+func NewHotspot(n uint64, hotFraction float64, hotProbability float64) *Hotspot {
+	return &Hotspot{
+		n:              n,
+		hotSize:        uint64(hotFraction * float64(n)),
+		hotProbability: hotProbability,
+	}
+}
+
+func (h *Hotspot) Next(r *rand.Rand) uint64 {
+	if h.hotSize > 0 && (h.hotSize == h.n || r.Float64() < h.hotProbability) {
+		return uint64(r.Int63n(int64(h.hotSize)))
+	}
+	return h.hotSize + uint64(r.Int63n(int64(h.n-h.hotSize)))
+}
@@ -0,0 +1,140 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package common
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const draws = 200000
+
+// histogram returns the number of times each value in [0, n) was drawn.
+func histogram(t *testing.T, n uint64, next func(r *rand.Rand) uint64) []uint64 {
+	r := rand.New(rand.NewSource(7))
+	counts := make([]uint64, n)
+	for i := 0; i < draws; i++ {
+		v := next(r)
+		require.Less(t, v, n)
+		counts[v]++
+	}
+	return counts
+}
+
+func frequency(counts []uint64, from uint64, to uint64) float64 {
+	var sum uint64
+	for _, c := range counts[from:to] {
+		sum += c
+	}
+	return float64(sum) / draws
+}
+
+func TestFNVHash64(t *testing.T) {
+	for _, v := range []uint64{0, 1, 2, 1000, math.MaxUint32, math.MaxUint64} {
+		h := fnv.New64a()
+		b := make([]byte, 8)
+		binary.LittleEndian.PutUint64(b, v)
+		_, err := h.Write(b)
+		require.NoError(t, err)
+		expected := int64(h.Sum64())
+		if expected < 0 {
+			expected = -expected
+		}
+		require.Equal(t, uint64(expected), FNVHash64(v), v)
+		require.LessOrEqual(t, FNVHash64(v), uint64(math.MaxInt64))
+	}
+}
+
+func TestNewZipfian(t *testing.T) {
+	for _, tc := range []struct {
+		n     uint64
+		theta float64
+		err   string
+	}{
+		{n: 0, theta: ZipfianConstant, err: "zipfian distribution must have at least one value"},
+		{n: 10, theta: 0, err: "zipfian constant must be in (0, 1), got: 0"},
+		{n: 10, theta: 1, err: "zipfian constant must be in (0, 1), got: 1"},
+		{n: 10, theta: -0.5, err: "zipfian constant must be in (0, 1), got: -0.5"},
+	} {
+		_, err := NewZipfian(tc.n, tc.theta)
+		require.EqualError(t, err, tc.err)
+	}
+
+	z, err := NewZipfian(1, ZipfianConstant)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{draws}, histogram(t, 1, z.Next))
+}
+
+func TestZipfian(t *testing.T) {
+	const n = 100
+	z, err := NewZipfian(n, ZipfianConstant)
+	require.NoError(t, err)
+	counts := histogram(t, n, z.Next)
+
+	// The value k is drawn with a probability of about 1/(k+1)^theta, normalized by zeta(n)
+	zetan := zeta(n, ZipfianConstant)
+	require.InEpsilon(t, 1/zetan, frequency(counts, 0, 1), 0.03)
+	require.InEpsilon(t, math.Pow(0.5, ZipfianConstant)/zetan, frequency(counts, 1, 2), 0.03)
+	require.InEpsilon(t, zeta(10, ZipfianConstant)/zetan, frequency(counts, 0, 10), 0.05)
+
+	// The smaller values are more popular
+	for from := uint64(10); from < n; from += 10 {
+		require.Greater(t, frequency(counts, from-10, from), frequency(counts, from, from+10), from)
+	}
+}
+
+func TestZipfianScrambled(t *testing.T) {
+	const n = 100
+	z, err := NewZipfian(n, ZipfianConstant)
+	require.NoError(t, err)
+	counts := histogram(t, n, z.NextScrambled)
+
+	// The most popular value is scattered by its hash, and is drawn as often as the unscrambled one
+	hot := FNVHash64(0) % n
+	require.NotZero(t, hot)
+	for v, c := range counts {
+		if uint64(v) != hot {
+			require.Less(t, c, counts[hot], v)
+		}
+	}
+	require.InEpsilon(t, 1/zeta(n, ZipfianConstant), frequency(counts, hot, hot+1), 0.03)
+}
+
+func TestHotspot(t *testing.T) {
+	const n = 100
+	for _, tc := range []struct {
+		name           string
+		hotFraction    float64
+		hotProbability float64
+		// The expected frequency of the values in the hotspot
+		hot float64
+	}{
+		{name: "hotspot", hotFraction: 0.2, hotProbability: 0.8, hot: 0.8},
+		{name: "cold hotspot", hotFraction: 0.2, hotProbability: 0, hot: 0},
+		{name: "uniform", hotFraction: 0.5, hotProbability: 0.5, hot: 0.5},
+		// Without a hotspot, or when all the values are in the hotspot, the values are drawn uniformly
+		{name: "no hotspot", hotFraction: 0, hotProbability: 0.8, hot: 0},
+		{name: "all hot", hotFraction: 1, hotProbability: 0.2, hot: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := NewHotspot(n, tc.hotFraction, tc.hotProbability)
+			counts := histogram(t, n, h.Next)
+			hotSize := uint64(tc.hotFraction * n)
+			require.InDelta(t, tc.hot, frequency(counts, 0, hotSize), 0.01)
+
+			// The values are drawn uniformly within the hotspot, and within the rest of the values
+			for v, c := range counts {
+				expected := tc.hot / float64(hotSize)
+				if uint64(v) >= hotSize {
+					expected = (1 - tc.hot) / float64(n-hotSize)
+				}
+				require.InDelta(t, expected, float64(c)/draws, 0.2*expected+1e-9, v)
+			}
+		})
+	}
+}
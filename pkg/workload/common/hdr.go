@@ -0,0 +1,205 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package common
+
+import (
+	"encoding/json"
+	"math"
+	"math/bits"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// subBucketBits determines the histogram precision: the relative error of each value is below 2^-subBucketBits.
+const subBucketBits = 7
+
+// Histogram is a high dynamic range (HDR-style) histogram of durations.
+// Values are recorded in log-linear buckets: values below 2^(subBucketBits+1) nanoseconds are recorded exactly,
+// and larger values are recorded with a bounded relative error.
+// Histograms can be merged without losing precision. It is safe for concurrent use.
+type Histogram struct {
+	lock   sync.Mutex
+	counts map[int]uint64
+	count  uint64
+	sum    float64
+	min    int64
+	max    int64
+}
+
+func NewHistogram() *Histogram {
+	return &Histogram{counts: map[int]uint64{}, min: math.MaxInt64}
+}
+
+func bucketIndex(v int64) int {
+	if v < 0 {
+		v = 0
+	}
+	if v < 1<<(subBucketBits+1) {
+		return int(v)
+	}
+	shift := bits.Len64(uint64(v)) - 1 - subBucketBits
+	return shift<<subBucketBits + int(v>>shift)
+}
+
+// bucketValue returns the middle of the bucket's value range.
+func bucketValue(index int) int64 {
+	if index < 1<<(subBucketBits+1) {
+		return int64(index)
+	}
+	shift := index>>subBucketBits - 1
+	m := int64(index - shift<<subBucketBits)
+	lower := m << shift
+	return lower + (int64(1)<<shift)/2
+}
+
+// Record adds a single duration to the histogram.
+func (h *Histogram) Record(d time.Duration) {
+	v := int64(d)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.counts[bucketIndex(v)]++
+	h.count++
+	h.sum += float64(v)
+	if v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+}
+
+// Merge adds all the values of another histogram to this histogram.
+func (h *Histogram) Merge(o *Histogram) {
+	if h == o {
+		return
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for i, c := range o.counts {
+		h.counts[i] += c
+	}
+	h.count += o.count
+	h.sum += o.sum
+	if o.min < h.min {
+		h.min = o.min
+	}
+	if o.max > h.max {
+		h.max = o.max
+	}
+}
+
+func (h *Histogram) Count() uint64 {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.count
+}
+
+func (h *Histogram) Mean() time.Duration {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.count == 0 {
+		return 0
+	}
+	return time.Duration(h.sum / float64(h.count))
+}
+
+func (h *Histogram) Min() time.Duration {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.count == 0 {
+		return 0
+	}
+	return time.Duration(h.min)
+}
+
+func (h *Histogram) Max() time.Duration {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return time.Duration(h.max)
+}
+
+// Quantile returns the q-quantile (0 <= q <= 1) of the recorded durations.
+// The extremes (q=0 and q=1) are the exact minimum and maximum.
+func (h *Histogram) Quantile(q float64) time.Duration {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	switch {
+	case h.count == 0:
+		return 0
+	case q <= 0:
+		return time.Duration(h.min)
+	case q >= 1:
+		return time.Duration(h.max)
+	}
+
+	indices := make([]int, 0, len(h.counts))
+	for i := range h.counts {
+		indices = append(indices, i)
+	}
+	sort.Ints(indices)
+
+	rank := uint64(math.Ceil(q * float64(h.count)))
+	if rank == 0 {
+		rank = 1
+	}
+	var cumulative uint64
+	for _, i := range indices {
+		cumulative += h.counts[i]
+		if cumulative >= rank {
+			// The bucket value is an estimate, so we clamp it to the actual range
+			v := bucketValue(i)
+			if v < h.min {
+				v = h.min
+			}
+			if v > h.max {
+				v = h.max
+			}
+			return time.Duration(v)
+		}
+	}
+	return time.Duration(h.max)
+}
+
+type histogramJSON struct {
+	SubBucketBits int            `json:"sub-bucket-bits"`
+	Count         uint64         `json:"count"`
+	Sum           float64        `json:"sum"`
+	Min           int64          `json:"min"`
+	Max           int64          `json:"max"`
+	Counts        map[int]uint64 `json:"counts"`
+}
+
+func (h *Histogram) MarshalJSON() ([]byte, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return json.Marshal(&histogramJSON{
+		SubBucketBits: subBucketBits,
+		Count:         h.count,
+		Sum:           h.sum,
+		Min:           h.min,
+		Max:           h.max,
+		Counts:        h.counts,
+	})
+}
+
+func (h *Histogram) UnmarshalJSON(b []byte) error {
+	j := &histogramJSON{}
+	if err := json.Unmarshal(b, j); err != nil {
+		return err
+	}
+	if j.SubBucketBits != subBucketBits {
+		return errors.Errorf("histogram precision mismatch: %d != %d", j.SubBucketBits, subBucketBits)
+	}
+	if j.Counts == nil {
+		j.Counts = map[int]uint64{}
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.counts, h.count, h.sum, h.min, h.max = j.Counts, j.Count, j.Sum, j.Min, j.Max
+	return nil
+}
@@ -0,0 +1,152 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package common
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBucketRoundTrip(t *testing.T) {
+	maxError := math.Pow(2, -subBucketBits)
+	for _, tc := range []struct {
+		name  string
+		from  int64
+		to    int64
+		step  int64
+		exact bool
+	}{
+		{"exact", 0, 1 << (subBucketBits + 1), 1, true},
+		{"first log bucket", 1 << (subBucketBits + 1), 1 << (subBucketBits + 3), 1, false},
+		{"microseconds", int64(time.Microsecond), int64(time.Millisecond), 997, false},
+		{"seconds", int64(time.Second), int64(time.Minute), int64(time.Millisecond) + 7, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			prevIndex := -1
+			for v := tc.from; v < tc.to; v += tc.step {
+				index := bucketIndex(v)
+				require.GreaterOrEqual(t, index, prevIndex, "the buckets are monotonic: %d", v)
+				prevIndex = index
+
+				estimate := bucketValue(index)
+				if tc.exact {
+					require.Equal(t, v, estimate)
+					continue
+				}
+				relativeError := math.Abs(float64(estimate-v)) / float64(v)
+				require.LessOrEqual(t, relativeError, maxError, "value %d, estimate %d", v, estimate)
+			}
+		})
+	}
+
+	require.Equal(t, 0, bucketIndex(-1), "negative values are recorded as zero")
+}
+
+// newTestHistogram records the durations in a new histogram.
+func newTestHistogram(durations ...time.Duration) *Histogram {
+	h := NewHistogram()
+	for _, d := range durations {
+		h.Record(d)
+	}
+	return h
+}
+
+func TestQuantile(t *testing.T) {
+	var durations []time.Duration
+	for i := 1; i <= 100; i++ {
+		durations = append(durations, time.Duration(i)*time.Millisecond)
+	}
+	h := newTestHistogram(durations...)
+	maxError := math.Pow(2, -subBucketBits)
+
+	for _, tc := range []struct {
+		q    float64
+		want time.Duration
+	}{
+		{0, time.Millisecond},
+		{1, 100 * time.Millisecond},
+		{0.5, 50 * time.Millisecond},
+		{0.99, 99 * time.Millisecond},
+		{0.001, time.Millisecond},
+	} {
+		got := h.Quantile(tc.q)
+		require.InDelta(t, float64(tc.want), float64(got), maxError*float64(tc.want), "q=%g", tc.q)
+	}
+	// The extremes are exact
+	require.Equal(t, time.Millisecond, h.Quantile(0))
+	require.Equal(t, 100*time.Millisecond, h.Quantile(1))
+	// The estimates are clamped to the recorded range
+	require.Equal(t, 5*time.Second, newTestHistogram(5*time.Second).Quantile(0.5))
+
+	require.Equal(t, time.Duration(0), NewHistogram().Quantile(0.5), "an empty histogram")
+	require.Equal(t, time.Duration(0), NewHistogram().Min(), "an empty histogram")
+}
+
+func TestMerge(t *testing.T) {
+	a := newTestHistogram(time.Millisecond, 2*time.Millisecond, 3*time.Millisecond)
+	b := newTestHistogram(10*time.Microsecond, 5*time.Second)
+	all := newTestHistogram(time.Millisecond, 2*time.Millisecond, 3*time.Millisecond, 10*time.Microsecond, 5*time.Second)
+
+	merged := NewHistogram()
+	merged.Merge(a)
+	merged.Merge(b)
+	merged.Merge(NewHistogram())
+	// Merging a histogram into itself is ignored
+	merged.Merge(merged)
+
+	require.Equal(t, all.counts, merged.counts)
+	require.Equal(t, uint64(5), merged.Count())
+	require.Equal(t, all.Mean(), merged.Mean())
+	require.Equal(t, 10*time.Microsecond, merged.Min())
+	require.Equal(t, 5*time.Second, merged.Max())
+	for _, q := range []float64{0, 0.25, 0.5, 0.75, 1} {
+		require.Equal(t, all.Quantile(q), merged.Quantile(q), "q=%g", q)
+	}
+
+	// The merged histograms are not modified
+	require.Equal(t, uint64(3), a.Count())
+	require.Equal(t, uint64(2), b.Count())
+}
+
+func TestHistogramJSON(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		h    *Histogram
+	}{
+		{"empty", NewHistogram()},
+		{"values", newTestHistogram(0, 100, time.Millisecond, 5*time.Second)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := json.Marshal(tc.h)
+			require.NoError(t, err)
+			decoded := &Histogram{}
+			require.NoError(t, json.Unmarshal(b, decoded))
+
+			require.Equal(t, tc.h.counts, decoded.counts)
+			require.Equal(t, tc.h.Count(), decoded.Count())
+			require.Equal(t, tc.h.Mean(), decoded.Mean())
+			require.Equal(t, tc.h.Min(), decoded.Min())
+			require.Equal(t, tc.h.Max(), decoded.Max())
+			require.Equal(t, tc.h.Quantile(0.5), decoded.Quantile(0.5))
+		})
+	}
+
+	t.Run("precision mismatch", func(t *testing.T) {
+		b, err := json.Marshal(&histogramJSON{SubBucketBits: subBucketBits + 1})
+		require.NoError(t, err)
+		err = json.Unmarshal(b, &Histogram{})
+		require.EqualError(t, err, "histogram precision mismatch: 8 != 7")
+	})
+
+	t.Run("no counts", func(t *testing.T) {
+		h := &Histogram{}
+		require.NoError(t, json.Unmarshal([]byte(`{"sub-bucket-bits": 7}`), h))
+		// A decoded histogram without counts can still record values
+		h.Record(time.Millisecond)
+		require.Equal(t, uint64(1), h.Count())
+	})
+}
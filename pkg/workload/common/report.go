@@ -0,0 +1,219 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ReportQuantiles are the latency quantiles that are included in the report.
+var ReportQuantiles = []float64{0.5, 0.9, 0.99, 0.999}
+
+// OperationReport summarizes the latency of a single operation and status.
+type OperationReport struct {
+	Operation  StatOperation   `json:"operation"`
+	Status     StatStatus      `json:"status"`
+	Count      uint64          `json:"count"`
+	Items      uint64          `json:"items"`
+	Throughput float64         `json:"throughput"`
+	Mean       time.Duration   `json:"mean"`
+	Quantiles  []time.Duration `json:"quantiles"`
+	Max        time.Duration   `json:"max"`
+	Histogram  *Histogram      `json:"histogram"`
+}
+
+// Report is the end-of-run summary of a worker.
+type Report struct {
+	WorkType   string             `json:"work-type"`
+	Rank       uint64             `json:"rank"`
+	Start      time.Time          `json:"start"`
+	End        time.Time          `json:"end"`
+	Quantiles  []float64          `json:"quantiles"`
+	Operations []*OperationReport `json:"operations"`
+	// The blocks that were observed by the block listener, if it was enabled
+	Blocks *BlockReport `json:"blocks,omitempty"`
+	// The key algorithms of the material that was used in the run
+	Crypto string `json:"crypto,omitempty"`
+	// The ranks of a merged report
+	MergedRanks []uint64 `json:"merged-ranks,omitempty"`
+}
+
+// NewOperationReport computes the histogram statistics over the given duration.
+func NewOperationReport(
+	operation StatOperation, status StatStatus, items uint64, h *Histogram, duration time.Duration,
+) *OperationReport {
+	r := &OperationReport{
+		Operation: operation,
+		Status:    status,
+		Count:     h.Count(),
+		Items:     items,
+		Mean:      h.Mean(),
+		Max:       h.Max(),
+		Histogram: h,
+	}
+	if duration > 0 {
+		r.Throughput = float64(r.Count) / duration.Seconds()
+	}
+	for _, q := range ReportQuantiles {
+		r.Quantiles = append(r.Quantiles, h.Quantile(q))
+	}
+	return r
+}
+
+// Report creates a summary of all the operations since the last histograms reset.
+func (s *ClientStats) Report(workType string, rank uint64, start time.Time, end time.Time) *Report {
+	r := &Report{
+		WorkType:  workType,
+		Rank:      rank,
+		Start:     start,
+		End:       end,
+		Quantiles: ReportQuantiles,
+		Blocks:    s.blocks.summarize(end.Sub(start)),
+	}
+	s.histograms.Range(func(key, value interface{}) bool {
+		k := key.(histogramKey)
+		e := value.(*histogramEntry)
+		r.Operations = append(r.Operations, NewOperationReport(
+			k.operation, k.status, atomic.LoadUint64(&e.items), e.histogram, end.Sub(start),
+		))
+		return true
+	})
+	r.Sort()
+	return r
+}
+
+func (r *Report) Sort() {
+	sort.Slice(r.Operations, func(i, j int) bool {
+		a, b := r.Operations[i], r.Operations[j]
+		if a.Operation != b.Operation {
+			return a.Operation < b.Operation
+		}
+		return a.Status < b.Status
+	})
+}
+
+func (r *Report) Duration() time.Duration {
+	return r.End.Sub(r.Start)
+}
+
+// Errors returns the number of unsuccessful operations by status.
+func (r *Report) Errors() map[StatStatus]uint64 {
+	errs := map[StatStatus]uint64{}
+	for _, op := range r.Operations {
+		if op.Status != Success {
+			errs[op.Status] += op.Count
+		}
+	}
+	return errs
+}
+
+func formatLatency(d time.Duration) string {
+	return d.Round(time.Microsecond).String()
+}
+
+// WriteOperationsTable writes the operations as a human-readable table.
+func WriteOperationsTable(buf *bytes.Buffer, quantiles []float64, operations []*OperationReport) {
+	tw := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tw, "operation\tstatus\tcount\titems\tthroughput (op/s)\tmean")
+	for _, q := range quantiles {
+		_, _ = fmt.Fprintf(tw, "\tp%g", q*100)
+	}
+	_, _ = fmt.Fprintf(tw, "\tmax\n")
+	for _, op := range operations {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%.2f\t%s",
+			op.Operation, op.Status, op.Count, op.Items, op.Throughput, formatLatency(op.Mean))
+		for _, v := range op.Quantiles {
+			_, _ = fmt.Fprintf(tw, "\t%s", formatLatency(v))
+		}
+		_, _ = fmt.Fprintf(tw, "\t%s\n", formatLatency(op.Max))
+	}
+	_ = tw.Flush()
+}
+
+// WriteErrors writes the unsuccessful operations breakdown by status.
+func WriteErrors(buf *bytes.Buffer, errs map[StatStatus]uint64) {
+	if len(errs) == 0 {
+		_, _ = fmt.Fprintf(buf, "No errors.\n")
+		return
+	}
+	var statuses []string
+	for status := range errs {
+		statuses = append(statuses, string(status))
+	}
+	sort.Strings(statuses)
+	_, _ = fmt.Fprintf(buf, "Errors:\n")
+	for _, status := range statuses {
+		_, _ = fmt.Fprintf(buf, "  %s: %d\n", status, errs[StatStatus(status)])
+	}
+}
+
+// Text returns the report as a human-readable text.
+func (r *Report) Text() string {
+	buf := &bytes.Buffer{}
+	if r.MergedRanks != nil {
+		_, _ = fmt.Fprintf(buf, "%s cluster report (ranks: %v)\n", r.WorkType, r.MergedRanks)
+	} else {
+		_, _ = fmt.Fprintf(buf, "%s report (rank: %d)\n", r.WorkType, r.Rank)
+	}
+	_, _ = fmt.Fprintf(buf, "Start: %s, end: %s, duration: %s\n",
+		r.Start.Format(time.RFC3339), r.End.Format(time.RFC3339), r.Duration().Round(time.Millisecond))
+	if r.Crypto != "" {
+		_, _ = fmt.Fprintf(buf, "Crypto: %s\n", r.Crypto)
+	}
+	WriteOperationsTable(buf, r.Quantiles, r.Operations)
+	WriteErrors(buf, r.Errors())
+	if r.Blocks != nil {
+		buf.WriteString(r.Blocks.Text())
+	}
+	return buf.String()
+}
+
+// Write saves the report as text and JSON. The path should not include an extension.
+func (r *Report) Write(path string, perm os.FileMode) error {
+	if err := os.WriteFile(path+".txt", []byte(r.Text()), perm); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path+".json", b, perm)
+}
+
+// ReadReport reads a report that was saved as JSON.
+func ReadReport(path string) (*Report, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &Report{}
+	if err = json.Unmarshal(b, r); err != nil {
+		return nil, err
+	}
+	if err = r.validate(); err != nil {
+		return nil, errors.WithMessagef(err, "invalid report: %s", path)
+	}
+	return r, nil
+}
+
+// validate checks that the report has all the histograms, since they are merged and compared.
+func (r *Report) validate() error {
+	for _, op := range r.Operations {
+		if op.Histogram == nil {
+			return errors.Errorf("operation %s (%s) has no histogram", op.Operation, op.Status)
+		}
+	}
+	if r.Blocks != nil && r.Blocks.Interval == nil {
+		return errors.New("blocks have no interval histogram")
+	}
+	return nil
+}
@@ -2,7 +2,8 @@ package common
 
 import (
 	"net/http"
-	"regexp"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"orion-bench/pkg/utils"
@@ -12,20 +13,34 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-var fullQueueExp = regexp.MustCompile(`(?i)transaction queue is full`)
+// errorLogInterval is the minimal interval between two logged failures of the same status.
+const errorLogInterval = time.Second
 
 type StatStatus string
 type StatOperation string
+type StatStart string
 
 const (
-	Success     StatStatus    = "successful"
-	Failed      StatStatus    = "failed"
-	FullQueue   StatStatus    = "full_queue"
-	Write       StatOperation = "write"
-	Read        StatOperation = "read"
-	Query       StatOperation = "query"
-	AsyncCommit StatOperation = "async_commit"
-	SyncCommit  StatOperation = "sync_commit"
+	Success          StatStatus    = "successful"
+	Failed           StatStatus    = "failed"
+	FullQueue        StatStatus    = "full_queue"
+	Conflict         StatStatus    = "mvcc_conflict"
+	InvalidTx        StatStatus    = "invalid_tx"
+	DuplicateTx      StatStatus    = "duplicate_tx"
+	PermissionDenied StatStatus    = "permission_denied"
+	SignatureFailure StatStatus    = "signature_failure"
+	Timeout          StatStatus    = "timeout"
+	ConnectionError  StatStatus    = "connection_error"
+	LeaderChange     StatStatus    = "leader_change"
+	Unresolved       StatStatus    = "unresolved"
+	Write            StatOperation = "write"
+	Read             StatOperation = "read"
+	Query            StatOperation = "query"
+	AsyncCommit      StatOperation = "async_commit"
+	SyncCommit       StatOperation = "sync_commit"
+	TxCommit         StatOperation = "tx_commit"
+	Scheduled        StatStart     = "scheduled"
+	Actual           StatStart     = "actual"
 )
 
 func GetCommitOp(sync bool) StatOperation {
@@ -41,18 +56,43 @@ type ClientStats struct {
 	registry       *prometheus.Registry
 	operation      *prometheus.HistogramVec
 	operationCount *prometheus.CounterVec
-	backoff        prometheus.Histogram
+	backoff        *prometheus.HistogramVec
 	contentSize    *prometheus.HistogramVec
+	workLatency    *prometheus.HistogramVec
+	dropped        *prometheus.CounterVec
+	txCount        *prometheus.CounterVec
+	txLatency      *prometheus.HistogramVec
+	blockHeight    prometheus.Gauge
+	blockTxs       *prometheus.HistogramVec
+	blockInvalid   *prometheus.CounterVec
+	blockInterval  *prometheus.HistogramVec
+	blocks         blockStats
+	errorSampler   *errorSampler
 	mux            *http.ServeMux
+	phase          atomic.Value
+	histograms     sync.Map
+	// The high-resolution latency histograms of each phase's successful operations (see SummarizePhase)
+	phaseHistograms sync.Map
 }
 
-func (s *ClientStats) Check(err error) {
-	utils.Check(s.lg, err)
+type phaseHistogramKey struct {
+	phase     string
+	operation StatOperation
+}
+
+type histogramKey struct {
+	operation StatOperation
+	status    StatStatus
+}
+
+type histogramEntry struct {
+	histogram *Histogram
+	items     uint64
 }
 
 func (s *ClientStats) mustRegister(cs ...prometheus.Collector) {
 	for _, c := range cs {
-		s.Check(s.registry.Register(c))
+		utils.Check(s.lg, s.registry.Register(c))
 	}
 }
 
@@ -65,25 +105,70 @@ func RegisterClientStats(lg *logger.SugarLogger) *ClientStats {
 			Name:      "latency_seconds",
 			Help:      "The latency (seconds) of an operation",
 			Buckets:   utils.TimeBuckets,
-		}, []string{"status", "operation"}),
+		}, []string{"phase", "status", "operation"}),
 		operationCount: prometheus.NewCounterVec(prometheus.CounterOpts{
 			Namespace: "client",
 			Name:      "count",
 			Help:      "The number of operations operation",
-		}, []string{"status", "operation"}),
-		backoff: prometheus.NewHistogram(prometheus.HistogramOpts{
+		}, []string{"phase", "status", "operation"}),
+		backoff: prometheus.NewHistogramVec(prometheus.HistogramOpts{
 			Namespace: "client",
 			Name:      "backoff_seconds",
 			Help:      "The backoff (seconds) of a worker",
 			Buckets:   utils.TimeBuckets,
-		}),
+		}, []string{"phase"}),
 		contentSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
 			Namespace: "client",
 			Name:      "content_size_bytes",
 			Help:      "The backoff (seconds) of a worker",
 			Buckets:   utils.SizeBase2Buckets,
-		}, []string{"status"}),
-		mux: http.NewServeMux(),
+		}, []string{"phase", "status"}),
+		workLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "client",
+			Name:      "work_latency_seconds",
+			Help:      "The latency (seconds) of a user work iteration, measured from its scheduled or actual start",
+			Buckets:   utils.TimeBuckets,
+		}, []string{"phase", "start", "status"}),
+		dropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "client",
+			Name:      "dropped_count",
+			Help:      "The number of scheduled operations that were dropped since all the users were busy",
+		}, []string{"phase"}),
+		txCount: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "client",
+			Name:      "tx_count",
+			Help:      "The number of submitted TXs by their final validation status and flag",
+		}, []string{"phase", "status", "flag"}),
+		txLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "client",
+			Name:      "tx_commit_latency_seconds",
+			Help:      "The latency (seconds) from the submission of a TX until its validation status was resolved",
+			Buckets:   utils.TimeBuckets,
+		}, []string{"phase", "status"}),
+		blockHeight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "client",
+			Name:      "block_height",
+			Help:      "The number of the last block that was observed by the block listener",
+		}),
+		blockTxs: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "client",
+			Name:      "block_tx_count",
+			Help:      "The number of TXs in each observed block",
+			Buckets:   utils.CountBuckets,
+		}, []string{"phase"}),
+		blockInvalid: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "client",
+			Name:      "block_invalid_tx_count",
+			Help:      "The number of invalid TXs in the observed blocks by their validation flag",
+		}, []string{"phase", "flag"}),
+		blockInterval: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "client",
+			Name:      "block_interval_seconds",
+			Help:      "The time (seconds) between the arrival of consecutive blocks to the block listener",
+			Buckets:   utils.TimeBuckets,
+		}, []string{"phase"}),
+		errorSampler: newErrorSampler(lg, errorLogInterval),
+		mux:          http.NewServeMux(),
 	}
 	s.mustRegister(
 		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
@@ -92,46 +177,146 @@ func RegisterClientStats(lg *logger.SugarLogger) *ClientStats {
 		s.operationCount,
 		s.backoff,
 		s.contentSize,
+		s.workLatency,
+		s.dropped,
+		s.txCount,
+		s.txLatency,
+		s.blockHeight,
+		s.blockTxs,
+		s.blockInvalid,
+		s.blockInterval,
 	)
+	s.SetPhase("")
 	s.mux.Handle("/metrics", promhttp.InstrumentMetricHandler(
 		s.registry, promhttp.HandlerFor(s.registry, promhttp.HandlerOpts{}),
 	))
 	return s
 }
 
+// ServePrometheus serves the metrics. A failure is only logged, since the run's report does not depend on it.
 func (s *ClientStats) ServePrometheus(addr string) {
 	s.lg.Infof("Starting prometheus listner on: %s", addr)
-	s.Check(http.ListenAndServe(addr, s.mux))
+	if err := http.ListenAndServe(addr, s.mux); err != nil {
+		s.lg.Errorf("Prometheus listener failed: %s", err)
+	}
 }
 
-func (s *ClientStats) getStatus(err error) StatStatus {
-	if err == nil {
-		return Success
-	} else if m := fullQueueExp.FindStringSubmatch(err.Error()); m != nil {
-		return FullQueue
-	} else {
-		s.lg.Errorf("WriteTx failed: %s", err)
-		return Failed
+// getStatus classifies the error of an operation and logs a sample of the failures.
+func (s *ClientStats) getStatus(operation StatOperation, err error) StatStatus {
+	status := Classify(err)
+	if status != Success {
+		s.errorSampler.log(operation, status, err)
 	}
+	return status
+}
+
+// IsConflict returns true if a TX was invalidated due to an MVCC conflict.
+func IsConflict(err error) bool {
+	return Classify(err) == Conflict
+}
+
+// SetPhase sets the phase label of all the following observations.
+func (s *ClientStats) SetPhase(phase string) {
+	s.phase.Store(phase)
+}
+
+func (s *ClientStats) Phase() string {
+	return s.phase.Load().(string)
 }
 
 func (s *ClientStats) ObserveBackoff(duration time.Duration) {
-	s.backoff.Observe(duration.Seconds())
+	s.backoff.WithLabelValues(s.Phase()).Observe(duration.Seconds())
+}
+
+// ObserveWorkLatency records the latency of a work iteration from both its scheduled and actual start time.
+// Measuring from the scheduled start avoids coordinated omission in open-loop workloads.
+// The iteration's status is classified by its error.
+func (s *ClientStats) ObserveWorkLatency(scheduled time.Time, started time.Time, err error) {
+	end := time.Now()
+	phase := s.Phase()
+	status := string(Classify(err))
+	s.workLatency.WithLabelValues(phase, string(Scheduled), status).Observe(end.Sub(scheduled).Seconds())
+	s.workLatency.WithLabelValues(phase, string(Actual), status).Observe(end.Sub(started).Seconds())
+}
+
+func (s *ClientStats) ObserveDropped() {
+	s.dropped.WithLabelValues(s.Phase()).Inc()
+}
+
+// ObserveTxOutcome records the final validation status of a submitted TX, and its submit-to-commit latency.
+// It is also reported as the TxCommit operation.
+func (s *ClientStats) ObserveTxOutcome(flag string, status StatStatus, latency time.Duration) {
+	phase := s.Phase()
+	s.txCount.WithLabelValues(phase, string(status), flag).Inc()
+	s.txLatency.WithLabelValues(phase, string(status)).Observe(latency.Seconds())
+	s.observeHistogram(TxCommit, status, latency, 1)
+}
+
+// ObserveBlock records a block that was observed by the block listener.
+// The invalid TXs are counted by their validation flag. A non-positive interval (e.g., of the first block) is ignored.
+func (s *ClientStats) ObserveBlock(number uint64, txs uint64, invalid map[string]uint64, interval time.Duration) {
+	phase := s.Phase()
+	s.blockHeight.Set(float64(number))
+	s.blockTxs.WithLabelValues(phase).Observe(float64(txs))
+	var invalidCount uint64
+	for flag, count := range invalid {
+		s.blockInvalid.WithLabelValues(phase, flag).Add(float64(count))
+		invalidCount += count
+	}
+	if interval > 0 {
+		s.blockInterval.WithLabelValues(phase).Observe(interval.Seconds())
+	}
+	s.blocks.observe(number, txs, invalidCount, interval)
 }
 
 func (s *ClientStats) ObserveContentSize(size uint64, err error) {
-	s.contentSize.WithLabelValues(string(s.getStatus(err))).Observe(float64(size))
+	s.contentSize.WithLabelValues(s.Phase(), string(Classify(err))).Observe(float64(size))
 }
 
 func (s *ClientStats) ObserveOperationLatency(
 	operation StatOperation, duration time.Duration, count uint64, err error,
 ) {
 	labels := prometheus.Labels{
-		"status":    string(s.getStatus(err)),
+		"phase":     s.Phase(),
+		"status":    string(s.getStatus(operation, err)),
 		"operation": string(operation),
 	}
 	s.operation.With(labels).Observe(duration.Seconds())
 	s.operationCount.With(labels).Add(float64(count))
+	s.observeHistogram(operation, StatStatus(labels["status"]), duration, count)
+	if StatStatus(labels["status"]) == Success {
+		s.phaseHistogram(labels["phase"], operation).Record(duration)
+	}
+}
+
+func (s *ClientStats) phaseHistogram(phase string, operation StatOperation) *Histogram {
+	key := phaseHistogramKey{phase: phase, operation: operation}
+	h, ok := s.phaseHistograms.Load(key)
+	if !ok {
+		h, _ = s.phaseHistograms.LoadOrStore(key, NewHistogram())
+	}
+	return h.(*Histogram)
+}
+
+func (s *ClientStats) observeHistogram(operation StatOperation, status StatStatus, duration time.Duration, count uint64) {
+	key := histogramKey{operation: operation, status: status}
+	entry, ok := s.histograms.Load(key)
+	if !ok {
+		entry, _ = s.histograms.LoadOrStore(key, &histogramEntry{histogram: NewHistogram()})
+	}
+	e := entry.(*histogramEntry)
+	e.histogram.Record(duration)
+	atomic.AddUint64(&e.items, count)
+}
+
+// ResetHistograms clears the high-resolution histograms and the observed blocks that are used for the
+// end-of-run report.
+func (s *ClientStats) ResetHistograms() {
+	s.blocks.reset()
+	s.histograms.Range(func(key, _ interface{}) bool {
+		s.histograms.Delete(key)
+		return true
+	})
 }
 
 func (s *ClientStats) TimeOperation(
@@ -0,0 +1,112 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package common
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// PhaseSummary summarizes the client metrics that were collected during a single phase.
+type PhaseSummary struct {
+	Phase string
+	// Work is the number of work iterations, and SuccessfulWork is the number of those that did not fail
+	Work           uint64
+	SuccessfulWork uint64
+	Dropped        uint64
+	Successful     uint64
+	Failed         uint64
+	FullQueue      uint64
+	// The latency of the successful operations
+	latency *Histogram
+}
+
+func labelsOf(m *dto.Metric) map[string]string {
+	labels := map[string]string{}
+	for _, l := range m.GetLabel() {
+		labels[l.GetName()] = l.GetValue()
+	}
+	return labels
+}
+
+// SummarizePhase collects the metrics of a phase from the registry, and the phase's high-resolution latency
+// histograms. If operation is empty, the latency of all the operations is summarized.
+func (s *ClientStats) SummarizePhase(phase string, operation StatOperation) (*PhaseSummary, error) {
+	families, err := s.registry.Gather()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to gather the client metrics")
+	}
+
+	summary := &PhaseSummary{Phase: phase, latency: NewHistogram()}
+	s.phaseHistograms.Range(func(key, value interface{}) bool {
+		k := key.(phaseHistogramKey)
+		if k.phase == phase && (operation == "" || k.operation == operation) {
+			summary.latency.Merge(value.(*Histogram))
+		}
+		return true
+	})
+
+	for _, f := range families {
+		for _, m := range f.GetMetric() {
+			labels := labelsOf(m)
+			if labels["phase"] != phase {
+				continue
+			}
+			switch f.GetName() {
+			case "client_work_latency_seconds":
+				if labels["start"] != string(Actual) {
+					continue
+				}
+				summary.Work += m.GetHistogram().GetSampleCount()
+				if StatStatus(labels["status"]) == Success {
+					summary.SuccessfulWork += m.GetHistogram().GetSampleCount()
+				}
+			case "client_dropped_count":
+				summary.Dropped += uint64(m.GetCounter().GetValue())
+			case "client_latency_seconds":
+				if operation != "" && labels["operation"] != string(operation) {
+					continue
+				}
+				h := m.GetHistogram()
+				switch StatStatus(labels["status"]) {
+				case Success:
+					summary.Successful += h.GetSampleCount()
+				case FullQueue:
+					summary.FullQueue += h.GetSampleCount()
+					summary.Failed += h.GetSampleCount()
+				default:
+					summary.Failed += h.GetSampleCount()
+				}
+			}
+		}
+	}
+	return summary, nil
+}
+
+// ErrorRate returns the fraction of the operations that did not succeed.
+func (p *PhaseSummary) ErrorRate() float64 {
+	total := p.Successful + p.Failed
+	if total == 0 {
+		return 0
+	}
+	return float64(p.Failed) / float64(total)
+}
+
+// DropRate returns the fraction of the scheduled work that was dropped.
+func (p *PhaseSummary) DropRate() float64 {
+	total := p.Work + p.Dropped
+	if total == 0 {
+		return 0
+	}
+	return float64(p.Dropped) / float64(total)
+}
+
+// Quantile returns the q-quantile of the successful operations' latency, or -1 if no operation succeeded.
+func (p *PhaseSummary) Quantile(q float64) time.Duration {
+	if p.latency.Count() == 0 {
+		return -1
+	}
+	return p.latency.Quantile(q)
+}
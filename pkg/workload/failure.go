@@ -0,0 +1,146 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package workload
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"text/tabwriter"
+
+	"orion-bench/pkg/types"
+
+	"github.com/pkg/errors"
+)
+
+// Failure is returned by UserWorker.Work when a work iteration failed.
+// A fatal failure stops the user immediately, and a transient failure consumes the user's error budget.
+// Errors that are not wrapped by a Failure are considered transient.
+type Failure struct {
+	Err   error
+	Fatal bool
+}
+
+func (f *Failure) Error() string {
+	return f.Err.Error()
+}
+
+func (f *Failure) Unwrap() error {
+	return f.Err
+}
+
+// Transient wraps an error as a transient failure. It returns nil if err is nil.
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Failure{Err: err}
+}
+
+// Fatal wraps an error as a fatal failure. It returns nil if err is nil.
+func Fatal(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Failure{Err: err, Fatal: true}
+}
+
+func IsFatal(err error) bool {
+	var f *Failure
+	return errors.As(err, &f) && f.Fatal
+}
+
+// UserResult records the failures of a single user.
+type UserResult struct {
+	Index       uint64
+	Errors      uint64
+	consecutive uint64
+	// LastError is the last failure of the user
+	LastError error
+	// StopReason is the reason the user stopped before the end of the work, or empty if it did not
+	StopReason string
+}
+
+// fail records a failure and returns false if the user should stop working.
+func (r *UserResult) fail(err error, budget *types.ErrorBudgetConf) bool {
+	r.Errors++
+	r.consecutive++
+	r.LastError = err
+	switch {
+	case IsFatal(err):
+		r.StopReason = "fatal failure"
+	case budget.MaxErrors > 0 && r.Errors >= budget.MaxErrors:
+		r.StopReason = fmt.Sprintf("error budget exhausted (%d errors)", r.Errors)
+	case budget.MaxConsecutiveErrors > 0 && r.consecutive >= budget.MaxConsecutiveErrors:
+		r.StopReason = fmt.Sprintf("error budget exhausted (%d consecutive errors)", r.consecutive)
+	}
+	return r.StopReason == ""
+}
+
+func (r *UserResult) succeed() {
+	r.consecutive = 0
+}
+
+// stop records a reason for stopping the user that is not a failure of a work iteration.
+func (r *UserResult) stop(reason string) {
+	r.StopReason = reason
+}
+
+// ErrorSummary summarizes the failures of all the users.
+type ErrorSummary struct {
+	Users  uint64
+	Errors uint64
+	// Failed lists the users that had any failure, ordered by their index
+	Failed []*UserResult
+	// Stopped is the number of users that stopped before the end of the work due to failures
+	Stopped uint64
+}
+
+func NewErrorSummary(results []*UserResult) *ErrorSummary {
+	s := &ErrorSummary{Users: uint64(len(results))}
+	for _, r := range results {
+		s.Errors += r.Errors
+		if r.StopReason != "" {
+			s.Stopped++
+		}
+		if r.Errors > 0 || r.StopReason != "" {
+			s.Failed = append(s.Failed, r)
+		}
+	}
+	sort.Slice(s.Failed, func(i, j int) bool {
+		return s.Failed[i].Index < s.Failed[j].Index
+	})
+	return s
+}
+
+// Err returns an error if any user stopped due to failures.
+func (s *ErrorSummary) Err() error {
+	if s.Stopped == 0 {
+		return nil
+	}
+	return errors.Errorf("%d out of %d users stopped due to failures", s.Stopped, s.Users)
+}
+
+// Text returns the summary as a human-readable table.
+func (s *ErrorSummary) Text() string {
+	buf := &bytes.Buffer{}
+	_, _ = fmt.Fprintf(buf, "Errors: %d failed work iterations in %d out of %d users, %d users stopped.\n",
+		s.Errors, len(s.Failed), s.Users, s.Stopped)
+	if len(s.Failed) == 0 {
+		return buf.String()
+	}
+	tw := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tw, "user\terrors\tstatus\tlast error\n")
+	for _, r := range s.Failed {
+		status, lastErr := "completed", "-"
+		if r.StopReason != "" {
+			status = "stopped: " + r.StopReason
+		}
+		if r.LastError != nil {
+			lastErr = r.LastError.Error()
+		}
+		_, _ = fmt.Fprintf(tw, "%d\t%d\t%s\t%s\n", r.Index, r.Errors, status, lastErr)
+	}
+	_ = tw.Flush()
+	return buf.String()
+}
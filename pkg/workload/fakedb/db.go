@@ -0,0 +1,195 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+// Package fakedb implements an in-memory BCDB for unit testing workloads without an Orion cluster.
+// It implements the subset of the SDK that is used by the workloads: data, DBs and users TXs, range queries,
+// and the ledger's receipts and block headers.
+//
+// Each committed TX is validated and applied atomically in its own block. The validation follows Orion's rules:
+// the TX's users must exist and have a write permission on the TX's DBs, the read versions must match the committed
+// versions (MVCC), and the writes to keys with an ACL must be signed according to the ACL's sign policy.
+// Signatures are only checked for their presence in the envelope, and are not verified.
+package fakedb
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/hyperledger-labs/orion-sdk-go/pkg/bcdb"
+	sdkconfig "github.com/hyperledger-labs/orion-sdk-go/pkg/config"
+	oriontypes "github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// ErrUnsupported is returned by the SDK methods that are not implemented by the fake.
+var ErrUnsupported = errors.New("not supported by the fake BCDB")
+
+var _ bcdb.BCDB = (*DB)(nil)
+
+// DB is an in-memory BCDB. It is safe for concurrent use.
+type DB struct {
+	lock     sync.Mutex
+	dbs      map[string]*table
+	users    map[string]*oriontypes.User
+	blocks   []*oriontypes.BlockHeader
+	receipts map[string]*oriontypes.TxReceipt
+	txCount  uint64
+}
+
+type table struct {
+	index map[string]oriontypes.IndexAttributeType
+	data  map[string]*oriontypes.ValueWithMetadata
+}
+
+// New creates an empty BCDB whose genesis block adds the admin user.
+func New(adminID string) *DB {
+	db := &DB{
+		dbs:      map[string]*table{},
+		users:    map[string]*oriontypes.User{},
+		receipts: map[string]*oriontypes.TxReceipt{},
+	}
+	db.users[adminID] = &oriontypes.User{
+		Id:        adminID,
+		Privilege: &oriontypes.Privilege{Admin: true},
+	}
+	db.appendBlock(oriontypes.Flag_VALID, "")
+	return db
+}
+
+// Session opens a session of the configured user. The user is only checked when the session is used.
+func (db *DB) Session(config *sdkconfig.SessionConfig) (bcdb.DBSession, error) {
+	if config.UserConfig == nil || config.UserConfig.UserID == "" {
+		return nil, errors.New("session user is not configured")
+	}
+	return &session{db: db, userID: config.UserConfig.UserID}, nil
+}
+
+func (db *DB) newTxID() string {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	db.txCount++
+	return fmt.Sprintf("fake-tx-%d", db.txCount)
+}
+
+// appendBlock adds a block with a single TX. It must be called while holding the lock.
+func (db *DB) appendBlock(flag oriontypes.Flag, reason string) *oriontypes.BlockHeader {
+	header := &oriontypes.BlockHeader{
+		BaseHeader: &oriontypes.BlockHeaderBase{Number: uint64(len(db.blocks)) + 1},
+		ValidationInfo: []*oriontypes.ValidationInfo{{
+			Flag:            flag,
+			ReasonIfInvalid: reason,
+		}},
+	}
+	db.blocks = append(db.blocks, header)
+	return header
+}
+
+func (db *DB) block(number uint64) *oriontypes.BlockHeader {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	if number == 0 || number > uint64(len(db.blocks)) {
+		return nil
+	}
+	return db.blocks[number-1]
+}
+
+// Height returns the number of the last block.
+func (db *DB) Height() uint64 {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	return uint64(len(db.blocks))
+}
+
+// Get returns the committed value and metadata of a key, or nil if it does not exist.
+func (db *DB) Get(dbName string, key string) *oriontypes.ValueWithMetadata {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	if t, ok := db.dbs[dbName]; ok {
+		return t.data[key]
+	}
+	return nil
+}
+
+// Keys returns the sorted keys of a DB.
+func (db *DB) Keys(dbName string) []string {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	t, ok := db.dbs[dbName]
+	if !ok {
+		return nil
+	}
+	return t.sortedKeys()
+}
+
+// User returns a user, or nil if it does not exist.
+func (db *DB) User(userID string) *oriontypes.User {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	return db.users[userID]
+}
+
+// Receipt returns the receipt of a committed TX, or nil if it was not committed.
+func (db *DB) Receipt(txID string) *oriontypes.TxReceipt {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	return db.receipts[txID]
+}
+
+// Flags counts the committed TXs by their validation flag.
+func (db *DB) Flags() map[oriontypes.Flag]uint64 {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	flags := map[oriontypes.Flag]uint64{}
+	for _, receipt := range db.receipts {
+		flags[receipt.GetHeader().GetValidationInfo()[receipt.GetTxIndex()].GetFlag()]++
+	}
+	return flags
+}
+
+func (t *table) sortedKeys() []string {
+	keys := make([]string, 0, len(t.data))
+	for k := range t.data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// canRead returns true if the user may read the key, according to its ACL and the user's DB privilege.
+func (db *DB) canRead(user *oriontypes.User, dbName string, value *oriontypes.ValueWithMetadata) bool {
+	if user == nil {
+		return false
+	}
+	if !user.GetPrivilege().GetAdmin() {
+		if _, ok := user.GetPrivilege().GetDbPermission()[dbName]; !ok {
+			return false
+		}
+	}
+	acl := value.GetMetadata().GetAccessControl()
+	if acl == nil || (len(acl.GetReadUsers()) == 0 && len(acl.GetReadWriteUsers()) == 0) {
+		return true
+	}
+	return acl.GetReadUsers()[user.GetId()] || acl.GetReadWriteUsers()[user.GetId()]
+}
+
+// commit validates and applies a TX in a new block, and returns its receipt.
+// The validate function returns the TX's validation flag, and the apply function is only called for a valid TX.
+func (db *DB) commit(
+	txID string, validate func() (oriontypes.Flag, string), apply func(version *oriontypes.Version),
+) (*oriontypes.TxReceipt, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	if _, ok := db.receipts[txID]; ok {
+		return nil, errors.Errorf("failed to submit transaction, server returned: status: 400 Bad Request, "+
+			"message: duplicate txID: %s", txID)
+	}
+
+	flag, reason := validate()
+	header := db.appendBlock(flag, reason)
+	if flag == oriontypes.Flag_VALID {
+		apply(&oriontypes.Version{BlockNum: header.GetBaseHeader().GetNumber(), TxNum: 0})
+	}
+	receipt := &oriontypes.TxReceipt{Header: header, TxIndex: 0}
+	db.receipts[txID] = receipt
+	return receipt, nil
+}
@@ -0,0 +1,278 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package fakedb
+
+import (
+	"testing"
+
+	"github.com/hyperledger-labs/orion-sdk-go/pkg/bcdb"
+	sdkconfig "github.com/hyperledger-labs/orion-sdk-go/pkg/config"
+	oriontypes "github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testDB = "test-db"
+	admin  = "admin"
+	alice  = "alice"
+	bob    = "bob"
+	// carol has no permission on the test DB
+	carol = "carol"
+)
+
+func newSession(t *testing.T, db *DB, userID string) bcdb.DBSession {
+	s, err := db.Session(&sdkconfig.SessionConfig{UserConfig: &sdkconfig.UserConfig{UserID: userID}})
+	require.NoError(t, err)
+	return s
+}
+
+// newTestDB creates a DB with the test DB, and the users alice and bob that may write to it.
+func newTestDB(t *testing.T) *DB {
+	db := New(admin)
+	s := newSession(t, db, admin)
+
+	dbsTx, err := s.DBsTx()
+	require.NoError(t, err)
+	require.NoError(t, dbsTx.CreateDB(testDB, nil))
+	_, _, err = dbsTx.Commit(true)
+	require.NoError(t, err)
+
+	usersTx, err := s.UsersTx()
+	require.NoError(t, err)
+	for _, userID := range []string{alice, bob} {
+		require.NoError(t, usersTx.PutUser(&oriontypes.User{
+			Id: userID,
+			Privilege: &oriontypes.Privilege{
+				DbPermission: map[string]oriontypes.Privilege_Access{testDB: oriontypes.Privilege_ReadWrite},
+			},
+		}, nil))
+	}
+	require.NoError(t, usersTx.PutUser(&oriontypes.User{Id: carol, Privilege: &oriontypes.Privilege{}}, nil))
+	_, _, err = usersTx.Commit(true)
+	require.NoError(t, err)
+	return db
+}
+
+// put synchronously commits a single write of the user, and returns the commit's error.
+func put(t *testing.T, db *DB, userID string, key string, value string, acl *oriontypes.AccessControl) error {
+	tx, err := newSession(t, db, userID).DataTx()
+	require.NoError(t, err)
+	require.NoError(t, tx.Put(testDB, key, []byte(value), acl))
+	_, _, err = tx.Commit(true)
+	return err
+}
+
+func requireFlag(t *testing.T, err error, flag oriontypes.Flag) {
+	t.Helper()
+	require.Error(t, err)
+	validationErr, ok := err.(*bcdb.ErrorTxValidation)
+	require.True(t, ok, "not a validation error: %s", err)
+	require.Equal(t, flag.String(), validationErr.Flag)
+}
+
+func requireValue(t *testing.T, db *DB, key string, value string) {
+	t.Helper()
+	committed := db.Get(testDB, key)
+	require.NotNil(t, committed, "key '%s' does not exist", key)
+	require.Equal(t, value, string(committed.GetValue()))
+}
+
+func TestMVCCConflict(t *testing.T) {
+	t.Run("stale read", func(t *testing.T) {
+		db := newTestDB(t)
+		require.NoError(t, put(t, db, alice, "key", "v1", nil))
+
+		tx, err := newSession(t, db, alice).DataTx()
+		require.NoError(t, err)
+		value, _, err := tx.Get(testDB, "key")
+		require.NoError(t, err)
+		require.Equal(t, "v1", string(value))
+		require.NoError(t, tx.Put(testDB, "key", []byte("v2"), nil))
+
+		require.NoError(t, put(t, db, bob, "key", "v3", nil))
+		_, _, err = tx.Commit(true)
+		requireFlag(t, err, oriontypes.Flag_INVALID_MVCC_CONFLICT_WITH_COMMITTED_STATE)
+		requireValue(t, db, "key", "v3")
+	})
+
+	t.Run("read of a key that was created", func(t *testing.T) {
+		db := newTestDB(t)
+		tx, err := newSession(t, db, alice).DataTx()
+		require.NoError(t, err)
+		value, _, err := tx.Get(testDB, "key")
+		require.NoError(t, err)
+		require.Nil(t, value)
+		require.NoError(t, tx.Put(testDB, "other", []byte("v1"), nil))
+
+		require.NoError(t, put(t, db, bob, "key", "v1", nil))
+		_, _, err = tx.Commit(true)
+		requireFlag(t, err, oriontypes.Flag_INVALID_MVCC_CONFLICT_WITH_COMMITTED_STATE)
+		require.Nil(t, db.Get(testDB, "other"))
+	})
+
+	t.Run("assert read", func(t *testing.T) {
+		db := newTestDB(t)
+		require.NoError(t, put(t, db, alice, "key", "v1", nil))
+		version := db.Get(testDB, "key").GetMetadata().GetVersion()
+
+		tx, err := newSession(t, db, alice).DataTx()
+		require.NoError(t, err)
+		require.NoError(t, tx.AssertRead(testDB, "key", version))
+		require.NoError(t, tx.Put(testDB, "other", []byte("v1"), nil))
+		_, _, err = tx.Commit(true)
+		require.NoError(t, err)
+
+		tx, err = newSession(t, db, alice).DataTx()
+		require.NoError(t, err)
+		require.NoError(t, tx.AssertRead(testDB, "key", &oriontypes.Version{BlockNum: version.GetBlockNum() + 1}))
+		require.NoError(t, tx.Put(testDB, "other", []byte("v2"), nil))
+		_, _, err = tx.Commit(true)
+		requireFlag(t, err, oriontypes.Flag_INVALID_MVCC_CONFLICT_WITH_COMMITTED_STATE)
+		requireValue(t, db, "other", "v1")
+	})
+
+	t.Run("asynchronous commit", func(t *testing.T) {
+		db := newTestDB(t)
+		require.NoError(t, put(t, db, alice, "key", "v1", nil))
+
+		tx, err := newSession(t, db, alice).DataTx()
+		require.NoError(t, err)
+		_, _, err = tx.Get(testDB, "key")
+		require.NoError(t, err)
+		require.NoError(t, tx.Put(testDB, "key", []byte("v2"), nil))
+		require.NoError(t, put(t, db, bob, "key", "v3", nil))
+
+		// The validation status is only available from the receipt
+		txID, receiptEnv, err := tx.Commit(false)
+		require.NoError(t, err)
+		require.Nil(t, receiptEnv)
+		ledger, err := newSession(t, db, admin).Ledger()
+		require.NoError(t, err)
+		receipt, err := ledger.GetTransactionReceipt(txID)
+		require.NoError(t, err)
+		info := receipt.GetHeader().GetValidationInfo()[receipt.GetTxIndex()]
+		require.Equal(t, oriontypes.Flag_INVALID_MVCC_CONFLICT_WITH_COMMITTED_STATE, info.GetFlag())
+		require.Equal(t, uint64(1), db.Flags()[oriontypes.Flag_INVALID_MVCC_CONFLICT_WITH_COMMITTED_STATE])
+	})
+}
+
+func TestACL(t *testing.T) {
+	db := newTestDB(t)
+	require.NoError(t, put(t, db, alice, "private", "v1", &oriontypes.AccessControl{
+		ReadWriteUsers: map[string]bool{alice: true},
+	}))
+	require.NoError(t, put(t, db, alice, "shared", "v1", &oriontypes.AccessControl{
+		ReadUsers:      map[string]bool{bob: true},
+		ReadWriteUsers: map[string]bool{alice: true},
+	}))
+	require.NoError(t, put(t, db, alice, "public", "v1", nil))
+
+	t.Run("read", func(t *testing.T) {
+		tx, err := newSession(t, db, bob).DataTx()
+		require.NoError(t, err)
+		_, _, err = tx.Get(testDB, "private")
+		require.EqualError(t, err, "error while processing 'GET' due to status code: 403 Forbidden, "+
+			"the user [bob] has no read permission on key [private] present in the database [test-db]")
+		value, _, err := tx.Get(testDB, "shared")
+		require.NoError(t, err)
+		require.Equal(t, "v1", string(value))
+	})
+
+	t.Run("range query", func(t *testing.T) {
+		q, err := newSession(t, db, bob).Query()
+		require.NoError(t, err)
+		it, err := q.GetDataByRange(testDB, "", "", 0)
+		require.NoError(t, err)
+		var keys []string
+		for {
+			kv, more, err := it.Next()
+			require.NoError(t, err)
+			if !more {
+				break
+			}
+			keys = append(keys, kv.GetKey())
+		}
+		require.Equal(t, []string{"public", "shared"}, keys)
+	})
+
+	t.Run("write", func(t *testing.T) {
+		requireFlag(t, put(t, db, bob, "private", "v2", nil), oriontypes.Flag_INVALID_NO_PERMISSION)
+		requireFlag(t, put(t, db, bob, "shared", "v2", nil), oriontypes.Flag_INVALID_NO_PERMISSION)
+		require.NoError(t, put(t, db, bob, "public", "v2", nil))
+		require.NoError(t, put(t, db, alice, "private", "v2", nil))
+		requireValue(t, db, "private", "v2")
+		requireValue(t, db, "shared", "v1")
+		requireValue(t, db, "public", "v2")
+	})
+
+	t.Run("no DB permission", func(t *testing.T) {
+		requireFlag(t, put(t, db, carol, "public", "v3", nil), oriontypes.Flag_INVALID_NO_PERMISSION)
+		requireValue(t, db, "public", "v2")
+	})
+}
+
+func TestMultiSign(t *testing.T) {
+	db := newTestDB(t)
+	jointACL := &oriontypes.AccessControl{
+		ReadWriteUsers:     map[string]bool{alice: true, bob: true},
+		SignPolicyForWrite: oriontypes.AccessControl_ALL,
+	}
+	require.NoError(t, put(t, db, alice, "joint", "v1", jointACL))
+	require.NoError(t, put(t, db, alice, "either", "v1", &oriontypes.AccessControl{
+		ReadWriteUsers:     map[string]bool{alice: true, bob: true},
+		SignPolicyForWrite: oriontypes.AccessControl_ANY,
+	}))
+
+	// construct returns alice's signed envelope of a write to the joint key, which keeps its ACL
+	construct := func(value string, mustSign ...string) *oriontypes.DataTxEnvelope {
+		tx, err := newSession(t, db, alice).DataTx()
+		require.NoError(t, err)
+		require.NoError(t, tx.Put(testDB, "joint", []byte(value), jointACL))
+		for _, userID := range mustSign {
+			tx.AddMustSignUser(userID)
+		}
+		txEnv, err := tx.SignConstructedTxEnvelopeAndCloseTx()
+		require.NoError(t, err)
+		return txEnv.(*oriontypes.DataTxEnvelope)
+	}
+
+	t.Run("sign policy", func(t *testing.T) {
+		requireFlag(t, put(t, db, alice, "joint", "v2", jointACL), oriontypes.Flag_INVALID_NO_PERMISSION)
+		requireFlag(t, put(t, db, bob, "joint", "v2", jointACL), oriontypes.Flag_INVALID_NO_PERMISSION)
+		require.NoError(t, put(t, db, bob, "either", "v2", nil))
+		requireValue(t, db, "joint", "v1")
+		requireValue(t, db, "either", "v2")
+	})
+
+	t.Run("missing signature", func(t *testing.T) {
+		loaded, err := newSession(t, db, alice).LoadDataTx(construct("v2", bob))
+		require.NoError(t, err)
+		_, _, err = loaded.Commit(true)
+		requireFlag(t, err, oriontypes.Flag_INVALID_MISSING_SIGNATURE)
+		requireValue(t, db, "joint", "v1")
+	})
+
+	t.Run("co-signed by a must-sign user", func(t *testing.T) {
+		loaded, err := newSession(t, db, bob).LoadDataTx(construct("v2", bob))
+		require.NoError(t, err)
+		require.Equal(t, []string{alice, bob}, loaded.MustSignUsers())
+		require.Equal(t, []string{alice}, loaded.SignedUsers())
+		_, _, err = loaded.Commit(true)
+		require.NoError(t, err)
+		requireValue(t, db, "joint", "v2")
+	})
+
+	t.Run("co-signed by another user", func(t *testing.T) {
+		loaded, err := newSession(t, db, bob).LoadDataTx(construct("v3"))
+		require.NoError(t, err)
+		txEnv, err := loaded.CoSignTxEnvelopeAndCloseTx()
+		require.NoError(t, err)
+
+		loaded, err = newSession(t, db, alice).LoadDataTx(txEnv.(*oriontypes.DataTxEnvelope))
+		require.NoError(t, err)
+		require.Equal(t, []string{alice, bob}, loaded.SignedUsers())
+		_, _, err = loaded.Commit(true)
+		require.NoError(t, err)
+		requireValue(t, db, "joint", "v3")
+	})
+}
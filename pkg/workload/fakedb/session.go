@@ -0,0 +1,254 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package fakedb
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hyperledger-labs/orion-sdk-go/pkg/bcdb"
+	sdkconfig "github.com/hyperledger-labs/orion-sdk-go/pkg/config"
+	"github.com/hyperledger-labs/orion-server/pkg/state"
+	oriontypes "github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+)
+
+// The fake implements the SDK's session, and the query and ledger APIs.
+var (
+	_ bcdb.DBSession                   = (*session)(nil)
+	_ bcdb.Query                       = (*query)(nil)
+	_ bcdb.Iterator                    = (*iterator)(nil)
+	_ bcdb.Ledger                      = (*ledger)(nil)
+	_ bcdb.BlockHeaderDelivererService = (*deliverer)(nil)
+)
+
+type session struct {
+	db     *DB
+	userID string
+}
+
+func (s *session) newTx() txBase {
+	return txBase{db: s.db, userID: s.userID, txID: s.db.newTxID()}
+}
+
+func (s *session) UsersTx() (bcdb.UsersTxContext, error) {
+	return &usersTx{txBase: s.newTx()}, nil
+}
+
+// DataTx creates a data TX. The options are ignored, since they can only be applied to the SDK's TX context.
+func (s *session) DataTx(_ ...bcdb.TxContextOption) (bcdb.DataTxContext, error) {
+	return &dataTx{
+		txBase:     s.newTx(),
+		operations: map[string]*dbOperations{},
+		txUsers:    map[string]bool{s.userID: true},
+	}, nil
+}
+
+func (s *session) LoadDataTx(txEnv *oriontypes.DataTxEnvelope) (bcdb.LoadedDataTxContext, error) {
+	switch {
+	case txEnv == nil:
+		return nil, errors.New("transaction envelope is nil")
+	case txEnv.GetPayload() == nil:
+		return nil, errors.New("payload in the transaction envelope is nil")
+	case len(txEnv.GetSignatures()) == 0:
+		return nil, errors.New("transaction envelope does not have a signature")
+	case txEnv.GetPayload().GetTxId() == "":
+		return nil, errors.New("transaction ID in the transaction envelope is empty")
+	case len(txEnv.GetPayload().GetMustSignUserIds()) == 0:
+		return nil, errors.New("no user ID in the transaction envelope")
+	}
+	return &loadedDataTx{
+		txBase: txBase{db: s.db, userID: s.userID, txID: txEnv.GetPayload().GetTxId()},
+		txEnv:  txEnv,
+	}, nil
+}
+
+func (s *session) DBsTx() (bcdb.DBsTxContext, error) {
+	return &dbsTx{
+		txBase:     s.newTx(),
+		createdDBs: map[string]map[string]oriontypes.IndexAttributeType{},
+		deletedDBs: map[string]bool{},
+	}, nil
+}
+
+func (s *session) ConfigTx() (bcdb.ConfigTxContext, error) {
+	return nil, ErrUnsupported
+}
+
+func (s *session) Provenance() (bcdb.Provenance, error) {
+	return nil, ErrUnsupported
+}
+
+func (s *session) Ledger() (bcdb.Ledger, error) {
+	return &ledger{db: s.db}, nil
+}
+
+func (s *session) Query() (bcdb.Query, error) {
+	return &query{db: s.db, userID: s.userID}, nil
+}
+
+func (s *session) ReplicaSet(_ bool) ([]*sdkconfig.Replica, error) {
+	return []*sdkconfig.Replica{{ID: "fake", Endpoint: "fake://localhost"}}, nil
+}
+
+type query struct {
+	db     *DB
+	userID string
+}
+
+func (q *query) ExecuteJSONQuery(_, _ string) ([]*oriontypes.KVWithMetadata, error) {
+	return nil, ErrUnsupported
+}
+
+// GetDataByRange returns the keys in [startKey, endKey) that the user may read.
+// An empty endKey means no upper bound, and a zero limit means no limit.
+func (q *query) GetDataByRange(dbName, startKey, endKey string, limit uint64) (bcdb.Iterator, error) {
+	q.db.lock.Lock()
+	defer q.db.lock.Unlock()
+	user, ok := q.db.users[q.userID]
+	if !ok {
+		return nil, errors.Errorf("error while processing 'GET' due to status code: 401 Unauthorized, "+
+			"the user [%s] does not exist", q.userID)
+	}
+	t, ok := q.db.dbs[dbName]
+	if !ok {
+		return nil, errors.Errorf("error while processing 'GET' due to status code: 404 Not Found, "+
+			"database [%s] does not exist", dbName)
+	}
+
+	it := &iterator{}
+	for _, k := range t.sortedKeys() {
+		if k < startKey || (endKey != "" && k >= endKey) {
+			continue
+		}
+		value := t.data[k]
+		if !q.db.canRead(user, dbName, value) {
+			continue
+		}
+		it.kvs = append(it.kvs, &oriontypes.KVWithMetadata{
+			Key:      k,
+			Value:    value.GetValue(),
+			Metadata: value.GetMetadata(),
+		})
+		if limit > 0 && uint64(len(it.kvs)) >= limit {
+			break
+		}
+	}
+	return it, nil
+}
+
+type iterator struct {
+	kvs []*oriontypes.KVWithMetadata
+}
+
+func (it *iterator) Next() (*oriontypes.KVWithMetadata, bool, error) {
+	if len(it.kvs) == 0 {
+		return nil, false, nil
+	}
+	kv := it.kvs[0]
+	it.kvs = it.kvs[1:]
+	return kv, true, nil
+}
+
+// ledger serves the block headers and the TXs' receipts.
+type ledger struct {
+	db *DB
+}
+
+func (l *ledger) GetBlockHeader(blockNum uint64) (*oriontypes.BlockHeader, error) {
+	header := l.db.block(blockNum)
+	if header == nil {
+		return nil, &bcdb.ErrorNotFound{Message: fmt.Sprintf("block not found: %d", blockNum)}
+	}
+	return header, nil
+}
+
+func (l *ledger) GetLastBlockHeader() (*oriontypes.BlockHeader, error) {
+	return l.GetBlockHeader(l.db.Height())
+}
+
+func (l *ledger) GetLedgerPath(_, _ uint64) (*bcdb.LedgerPath, error) {
+	return nil, ErrUnsupported
+}
+
+func (l *ledger) GetTransactionProof(_ uint64, _ int) (*bcdb.TxProof, error) {
+	return nil, ErrUnsupported
+}
+
+func (l *ledger) GetTransactionReceipt(txID string) (*oriontypes.TxReceipt, error) {
+	receipt := l.db.Receipt(txID)
+	if receipt == nil {
+		return nil, &bcdb.ErrorNotFound{Message: fmt.Sprintf("TxID not found: %s", txID)}
+	}
+	return receipt, nil
+}
+
+func (l *ledger) GetDataProof(_ uint64, _, _ string, _ bool) (*state.Proof, error) {
+	return nil, ErrUnsupported
+}
+
+func (l *ledger) GetFullTxProofAndVerify(
+	_ *oriontypes.TxReceipt, _ *oriontypes.BlockHeader, _ proto.Message,
+) (*bcdb.TxProof, *bcdb.LedgerPath, error) {
+	return nil, nil, ErrUnsupported
+}
+
+func (l *ledger) NewBlockHeaderDeliveryService(conf *bcdb.BlockHeaderDeliveryConfig) bcdb.BlockHeaderDelivererService {
+	retry := conf.RetryInterval
+	if retry <= 0 {
+		retry = defaultRetryInterval
+	}
+	return &deliverer{
+		db:    l.db,
+		next:  conf.StartBlockNumber,
+		retry: retry,
+		stop:  make(chan struct{}),
+	}
+}
+
+func (l *ledger) GetTxContent(_, _ uint64) (*oriontypes.GetTxResponse, error) {
+	return nil, ErrUnsupported
+}
+
+// defaultRetryInterval is used by the block header delivery service if no retry interval is configured.
+const defaultRetryInterval = 10 * time.Millisecond
+
+// deliverer delivers the block headers from the start block, and polls for the next block every retry interval.
+type deliverer struct {
+	db       *DB
+	next     uint64
+	retry    time.Duration
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func (d *deliverer) Receive() interface{} {
+	for {
+		select {
+		case <-d.stop:
+			return nil
+		default:
+		}
+		if header := d.db.block(d.next); header != nil {
+			d.next++
+			return header
+		}
+		select {
+		case <-d.stop:
+			return nil
+		case <-time.After(d.retry):
+		}
+	}
+}
+
+func (d *deliverer) Stop() {
+	d.stopOnce.Do(func() {
+		close(d.stop)
+	})
+}
+
+func (d *deliverer) Error() error {
+	return nil
+}
@@ -0,0 +1,563 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package fakedb
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger-labs/orion-sdk-go/pkg/bcdb"
+	oriontypes "github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+)
+
+// The fake implements the SDK's TX contexts.
+var (
+	_ bcdb.DataTxContext       = (*dataTx)(nil)
+	_ bcdb.LoadedDataTxContext = (*loadedDataTx)(nil)
+	_ bcdb.DBsTxContext        = (*dbsTx)(nil)
+	_ bcdb.UsersTxContext      = (*usersTx)(nil)
+)
+
+// signature is a placeholder for the signature of a user, since the fake does not verify the signatures.
+func signature(userID string) []byte {
+	return []byte("signed-by:" + userID)
+}
+
+// txBase implements the common TX context functionality.
+type txBase struct {
+	db       *DB
+	userID   string
+	txID     string
+	spent    bool
+	envelope proto.Message
+}
+
+func (t *txBase) TxID() string {
+	return t.txID
+}
+
+func (t *txBase) Abort() error {
+	if t.spent {
+		return bcdb.ErrTxSpent
+	}
+	t.spent = true
+	return nil
+}
+
+func (t *txBase) CommittedTxEnvelope() (proto.Message, error) {
+	return t.envelope, nil
+}
+
+// commit validates and applies the TX. Similar to the SDK, an asynchronous commit returns no receipt,
+// and a synchronous commit of an invalid TX returns its receipt with a validation error.
+func (t *txBase) commit(
+	sync bool, envelope proto.Message, validate func() (oriontypes.Flag, string), apply func(version *oriontypes.Version),
+) (string, *oriontypes.TxReceiptResponseEnvelope, error) {
+	if t.spent {
+		return "", nil, bcdb.ErrTxSpent
+	}
+	receipt, err := t.db.commit(t.txID, validate, apply)
+	if err != nil {
+		return t.txID, nil, err
+	}
+	t.spent = true
+	t.envelope = envelope
+	if !sync {
+		return t.txID, nil, nil
+	}
+
+	receiptEnv := &oriontypes.TxReceiptResponseEnvelope{
+		Response: &oriontypes.TxReceiptResponse{Receipt: receipt},
+	}
+	info := receipt.GetHeader().GetValidationInfo()[receipt.GetTxIndex()]
+	if info.GetFlag() != oriontypes.Flag_VALID {
+		return t.txID, receiptEnv, &bcdb.ErrorTxValidation{
+			TxID:   t.txID,
+			Flag:   info.GetFlag().String(),
+			Reason: info.GetReasonIfInvalid(),
+		}
+	}
+	return t.txID, receiptEnv, nil
+}
+
+// isAdmin must be called while holding the lock.
+func (db *DB) isAdmin(userID string) bool {
+	return db.users[userID].GetPrivilege().GetAdmin()
+}
+
+func versionEqual(a *oriontypes.Version, b *oriontypes.Version) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.GetBlockNum() == b.GetBlockNum() && a.GetTxNum() == b.GetTxNum()
+}
+
+// validateDataTx must be called while holding the lock.
+func (db *DB) validateDataTx(txEnv *oriontypes.DataTxEnvelope) (oriontypes.Flag, string) {
+	payload := txEnv.GetPayload()
+	for _, userID := range payload.GetMustSignUserIds() {
+		if _, ok := db.users[userID]; !ok {
+			return oriontypes.Flag_INVALID_UNAUTHORISED, fmt.Sprintf("the user [%s] does not exist", userID)
+		}
+		if _, ok := txEnv.GetSignatures()[userID]; !ok {
+			return oriontypes.Flag_INVALID_MISSING_SIGNATURE, fmt.Sprintf("the user [%s] did not sign the TX", userID)
+		}
+	}
+	// Similar to Orion, the users that signed the TX without being in the must-sign list also count for the ACLs
+	signers := map[string]bool{}
+	for userID := range txEnv.GetSignatures() {
+		if _, ok := db.users[userID]; ok {
+			signers[userID] = true
+		}
+	}
+
+	for _, op := range payload.GetDbOperations() {
+		t, ok := db.dbs[op.GetDbName()]
+		if !ok {
+			return oriontypes.Flag_INVALID_DATABASE_DOES_NOT_EXIST,
+				fmt.Sprintf("the database [%s] does not exist", op.GetDbName())
+		}
+		for userID := range signers {
+			privilege := db.users[userID].GetPrivilege()
+			if !privilege.GetAdmin() && privilege.GetDbPermission()[op.GetDbName()] != oriontypes.Privilege_ReadWrite {
+				return oriontypes.Flag_INVALID_NO_PERMISSION,
+					fmt.Sprintf("the user [%s] has no write permission on the database [%s]", userID, op.GetDbName())
+			}
+		}
+
+		for _, r := range op.GetDataReads() {
+			committed := t.data[r.GetKey()].GetMetadata().GetVersion()
+			if !versionEqual(r.GetVersion(), committed) {
+				return oriontypes.Flag_INVALID_MVCC_CONFLICT_WITH_COMMITTED_STATE,
+					fmt.Sprintf("mvcc conflict has occurred as the committed state for the key [%s] in the "+
+						"database [%s] changed", r.GetKey(), op.GetDbName())
+			}
+		}
+
+		var keys []string
+		for _, w := range op.GetDataWrites() {
+			keys = append(keys, w.GetKey())
+		}
+		for _, d := range op.GetDataDeletes() {
+			if _, ok := t.data[d.GetKey()]; !ok {
+				return oriontypes.Flag_INVALID_INCORRECT_ENTRIES,
+					fmt.Sprintf("the key [%s] does not exist in the database [%s]", d.GetKey(), op.GetDbName())
+			}
+			keys = append(keys, d.GetKey())
+		}
+		for _, k := range keys {
+			if !canWrite(t.data[k].GetMetadata().GetAccessControl(), signers) {
+				return oriontypes.Flag_INVALID_NO_PERMISSION,
+					fmt.Sprintf("not all required users in [%v] have signed the transaction to write/delete "+
+						"key [%s] present in the database [%s]", payload.GetMustSignUserIds(), k, op.GetDbName())
+			}
+		}
+	}
+	return oriontypes.Flag_VALID, ""
+}
+
+// canWrite returns true if the signers satisfy the sign policy of the key's ACL.
+func canWrite(acl *oriontypes.AccessControl, signers map[string]bool) bool {
+	users := acl.GetReadWriteUsers()
+	if len(users) == 0 {
+		return true
+	}
+	signed := 0
+	for userID := range users {
+		if signers[userID] {
+			signed++
+		}
+	}
+	if acl.GetSignPolicyForWrite() == oriontypes.AccessControl_ALL {
+		return signed == len(users)
+	}
+	return signed > 0
+}
+
+// applyDataTx must be called while holding the lock.
+func (db *DB) applyDataTx(payload *oriontypes.DataTx, version *oriontypes.Version) {
+	for _, op := range payload.GetDbOperations() {
+		t := db.dbs[op.GetDbName()]
+		for _, w := range op.GetDataWrites() {
+			t.data[w.GetKey()] = &oriontypes.ValueWithMetadata{
+				Value: w.GetValue(),
+				Metadata: &oriontypes.Metadata{
+					Version:       version,
+					AccessControl: w.GetAcl(),
+				},
+			}
+		}
+		for _, d := range op.GetDataDeletes() {
+			delete(t.data, d.GetKey())
+		}
+	}
+}
+
+func (db *DB) commitDataTx(
+	t *txBase, sync bool, txEnv *oriontypes.DataTxEnvelope,
+) (string, *oriontypes.TxReceiptResponseEnvelope, error) {
+	return t.commit(sync, txEnv, func() (oriontypes.Flag, string) {
+		return db.validateDataTx(txEnv)
+	}, func(version *oriontypes.Version) {
+		db.applyDataTx(txEnv.GetPayload(), version)
+	})
+}
+
+// read returns the committed value of a key, and checks the user's read permission.
+func (db *DB) read(userID string, dbName string, key string) (*oriontypes.ValueWithMetadata, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	t, ok := db.dbs[dbName]
+	if !ok {
+		return nil, errors.Errorf("error while processing 'GET' due to status code: 404 Not Found, "+
+			"database [%s] does not exist", dbName)
+	}
+	value := t.data[key]
+	if !db.canRead(db.users[userID], dbName, value) {
+		return nil, errors.Errorf("error while processing 'GET' due to status code: 403 Forbidden, "+
+			"the user [%s] has no read permission on key [%s] present in the database [%s]", userID, key, dbName)
+	}
+	return value, nil
+}
+
+type dbOperations struct {
+	reads   map[string]*oriontypes.ValueWithMetadata
+	asserts map[string]*oriontypes.Version
+	writes  map[string]*oriontypes.DataWrite
+	deletes map[string]*oriontypes.DataDelete
+}
+
+func newDBOperations() *dbOperations {
+	return &dbOperations{
+		reads:   map[string]*oriontypes.ValueWithMetadata{},
+		asserts: map[string]*oriontypes.Version{},
+		writes:  map[string]*oriontypes.DataWrite{},
+		deletes: map[string]*oriontypes.DataDelete{},
+	}
+}
+
+// dataTx mirrors the SDK's data TX context: the reads are served from the committed state,
+// and their versions are validated when the TX is committed.
+type dataTx struct {
+	txBase
+	operations map[string]*dbOperations
+	txUsers    map[string]bool
+}
+
+func (d *dataTx) ops(dbName string) *dbOperations {
+	ops, ok := d.operations[dbName]
+	if !ok {
+		ops = newDBOperations()
+		d.operations[dbName] = ops
+	}
+	return ops
+}
+
+func (d *dataTx) Commit(sync bool) (string, *oriontypes.TxReceiptResponseEnvelope, error) {
+	if d.spent {
+		return "", nil, bcdb.ErrTxSpent
+	}
+	return d.db.commitDataTx(&d.txBase, sync, d.composeEnvelope())
+}
+
+func (d *dataTx) Put(dbName string, key string, value []byte, acl *oriontypes.AccessControl) error {
+	if d.spent {
+		return bcdb.ErrTxSpent
+	}
+	ops := d.ops(dbName)
+	delete(ops.deletes, key)
+	ops.writes[key] = &oriontypes.DataWrite{Key: key, Value: value, Acl: acl}
+	return nil
+}
+
+func (d *dataTx) Get(dbName, key string) ([]byte, *oriontypes.Metadata, error) {
+	if d.spent {
+		return nil, nil, bcdb.ErrTxSpent
+	}
+	ops := d.ops(dbName)
+	if _, ok := ops.asserts[key]; ok {
+		return nil, nil, errors.Errorf("can not execute Get and AssertRead for the same key '%s' in the same transaction", key)
+	}
+	if value, ok := ops.reads[key]; ok {
+		return value.GetValue(), value.GetMetadata(), nil
+	}
+
+	value, err := d.db.read(d.userID, dbName, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	ops.reads[key] = value
+	return value.GetValue(), value.GetMetadata(), nil
+}
+
+func (d *dataTx) Delete(dbName, key string) error {
+	if d.spent {
+		return bcdb.ErrTxSpent
+	}
+	ops := d.ops(dbName)
+	delete(ops.writes, key)
+	ops.deletes[key] = &oriontypes.DataDelete{Key: key}
+	return nil
+}
+
+func (d *dataTx) AssertRead(dbName string, key string, version *oriontypes.Version) error {
+	if d.spent {
+		return bcdb.ErrTxSpent
+	}
+	ops := d.ops(dbName)
+	if _, ok := ops.reads[key]; ok {
+		return errors.Errorf("can not execute Get and AssertRead for the same key '%s' in the same transaction", key)
+	}
+	if current, ok := ops.asserts[key]; ok && current != version {
+		return errors.New("the received version is different from the existing version")
+	}
+	ops.asserts[key] = version
+	return nil
+}
+
+func (d *dataTx) AddMustSignUser(userID string) {
+	d.txUsers[userID] = true
+}
+
+func (d *dataTx) SignConstructedTxEnvelopeAndCloseTx() (proto.Message, error) {
+	if d.spent {
+		return nil, bcdb.ErrTxSpent
+	}
+	txEnv := d.composeEnvelope()
+	d.spent = true
+	d.envelope = txEnv
+	return txEnv, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (d *dataTx) composeEnvelope() *oriontypes.DataTxEnvelope {
+	payload := &oriontypes.DataTx{
+		MustSignUserIds: sortedKeys(d.txUsers),
+		TxId:            d.txID,
+	}
+	for _, dbName := range sortedKeys(d.operations) {
+		ops := d.operations[dbName]
+		dbOp := &oriontypes.DBOperation{DbName: dbName}
+		for _, k := range sortedKeys(ops.writes) {
+			dbOp.DataWrites = append(dbOp.DataWrites, ops.writes[k])
+		}
+		for _, k := range sortedKeys(ops.deletes) {
+			dbOp.DataDeletes = append(dbOp.DataDeletes, ops.deletes[k])
+		}
+		for _, k := range sortedKeys(ops.reads) {
+			dbOp.DataReads = append(dbOp.DataReads, &oriontypes.DataRead{
+				Key:     k,
+				Version: ops.reads[k].GetMetadata().GetVersion(),
+			})
+		}
+		for _, k := range sortedKeys(ops.asserts) {
+			dbOp.DataReads = append(dbOp.DataReads, &oriontypes.DataRead{Key: k, Version: ops.asserts[k]})
+		}
+		payload.DbOperations = append(payload.DbOperations, dbOp)
+	}
+	return &oriontypes.DataTxEnvelope{
+		Payload:    payload,
+		Signatures: map[string][]byte{d.userID: signature(d.userID)},
+	}
+}
+
+// loadedDataTx is a multi-signature data TX that was constructed by another user.
+type loadedDataTx struct {
+	txBase
+	txEnv *oriontypes.DataTxEnvelope
+}
+
+func (d *loadedDataTx) Commit(sync bool) (string, *oriontypes.TxReceiptResponseEnvelope, error) {
+	if d.spent {
+		return "", nil, bcdb.ErrTxSpent
+	}
+	d.txEnv.Signatures[d.userID] = signature(d.userID)
+	return d.db.commitDataTx(&d.txBase, sync, d.txEnv)
+}
+
+func (d *loadedDataTx) MustSignUsers() []string {
+	return d.txEnv.GetPayload().GetMustSignUserIds()
+}
+
+func (d *loadedDataTx) SignedUsers() []string {
+	return sortedKeys(d.txEnv.GetSignatures())
+}
+
+func (d *loadedDataTx) VerifySignatures() error {
+	return nil
+}
+
+func (d *loadedDataTx) Reads() map[string][]*oriontypes.DataRead {
+	reads := map[string][]*oriontypes.DataRead{}
+	for _, op := range d.txEnv.GetPayload().GetDbOperations() {
+		reads[op.GetDbName()] = op.GetDataReads()
+	}
+	return reads
+}
+
+func (d *loadedDataTx) Writes() map[string][]*oriontypes.DataWrite {
+	writes := map[string][]*oriontypes.DataWrite{}
+	for _, op := range d.txEnv.GetPayload().GetDbOperations() {
+		writes[op.GetDbName()] = op.GetDataWrites()
+	}
+	return writes
+}
+
+func (d *loadedDataTx) Deletes() map[string][]*oriontypes.DataDelete {
+	deletes := map[string][]*oriontypes.DataDelete{}
+	for _, op := range d.txEnv.GetPayload().GetDbOperations() {
+		deletes[op.GetDbName()] = op.GetDataDeletes()
+	}
+	return deletes
+}
+
+func (d *loadedDataTx) CoSignTxEnvelopeAndCloseTx() (proto.Message, error) {
+	if d.spent {
+		return nil, bcdb.ErrTxSpent
+	}
+	d.txEnv.Signatures[d.userID] = signature(d.userID)
+	d.spent = true
+	d.envelope = d.txEnv
+	return d.txEnv, nil
+}
+
+// dbsTx creates and deletes DBs. Only an admin may commit it.
+type dbsTx struct {
+	txBase
+	createdDBs map[string]map[string]oriontypes.IndexAttributeType
+	deletedDBs map[string]bool
+}
+
+func (d *dbsTx) Commit(sync bool) (string, *oriontypes.TxReceiptResponseEnvelope, error) {
+	db := d.db
+	return d.commit(sync, nil, func() (oriontypes.Flag, string) {
+		if !db.isAdmin(d.userID) {
+			return oriontypes.Flag_INVALID_NO_PERMISSION, fmt.Sprintf("the user [%s] is not an admin", d.userID)
+		}
+		for dbName := range d.createdDBs {
+			if _, ok := db.dbs[dbName]; ok {
+				return oriontypes.Flag_INVALID_INCORRECT_ENTRIES, fmt.Sprintf("the database [%s] already exists", dbName)
+			}
+		}
+		for dbName := range d.deletedDBs {
+			if _, ok := db.dbs[dbName]; !ok {
+				return oriontypes.Flag_INVALID_INCORRECT_ENTRIES, fmt.Sprintf("the database [%s] does not exist", dbName)
+			}
+		}
+		return oriontypes.Flag_VALID, ""
+	}, func(_ *oriontypes.Version) {
+		for dbName, index := range d.createdDBs {
+			db.dbs[dbName] = &table{index: index, data: map[string]*oriontypes.ValueWithMetadata{}}
+		}
+		for dbName := range d.deletedDBs {
+			delete(db.dbs, dbName)
+		}
+	})
+}
+
+func (d *dbsTx) CreateDB(dbName string, index map[string]oriontypes.IndexAttributeType) error {
+	if d.spent {
+		return bcdb.ErrTxSpent
+	}
+	d.createdDBs[dbName] = index
+	return nil
+}
+
+func (d *dbsTx) DeleteDB(dbName string) error {
+	if d.spent {
+		return bcdb.ErrTxSpent
+	}
+	d.deletedDBs[dbName] = true
+	return nil
+}
+
+func (d *dbsTx) Exists(dbName string) (bool, error) {
+	if d.spent {
+		return false, bcdb.ErrTxSpent
+	}
+	d.db.lock.Lock()
+	defer d.db.lock.Unlock()
+	_, ok := d.db.dbs[dbName]
+	return ok, nil
+}
+
+func (d *dbsTx) GetDBIndex(dbName string) (map[string]oriontypes.IndexAttributeType, error) {
+	if d.spent {
+		return nil, bcdb.ErrTxSpent
+	}
+	d.db.lock.Lock()
+	defer d.db.lock.Unlock()
+	t, ok := d.db.dbs[dbName]
+	if !ok {
+		return nil, errors.Errorf("the database [%s] does not exist", dbName)
+	}
+	return t.index, nil
+}
+
+// usersTx adds and removes users. Only an admin may commit it.
+type usersTx struct {
+	txBase
+	writes  []*oriontypes.User
+	deletes []string
+}
+
+func (u *usersTx) Commit(sync bool) (string, *oriontypes.TxReceiptResponseEnvelope, error) {
+	db := u.db
+	return u.commit(sync, nil, func() (oriontypes.Flag, string) {
+		if !db.isAdmin(u.userID) {
+			return oriontypes.Flag_INVALID_NO_PERMISSION, fmt.Sprintf("the user [%s] is not an admin", u.userID)
+		}
+		for _, userID := range u.deletes {
+			if _, ok := db.users[userID]; !ok {
+				return oriontypes.Flag_INVALID_INCORRECT_ENTRIES, fmt.Sprintf("the user [%s] does not exist", userID)
+			}
+		}
+		return oriontypes.Flag_VALID, ""
+	}, func(_ *oriontypes.Version) {
+		for _, user := range u.writes {
+			db.users[user.GetId()] = user
+		}
+		for _, userID := range u.deletes {
+			delete(db.users, userID)
+		}
+	})
+}
+
+func (u *usersTx) PutUser(user *oriontypes.User, _ *oriontypes.AccessControl) error {
+	if u.spent {
+		return bcdb.ErrTxSpent
+	}
+	u.writes = append(u.writes, user)
+	return nil
+}
+
+func (u *usersTx) GetUser(userID string) (*oriontypes.User, *oriontypes.Metadata, error) {
+	if u.spent {
+		return nil, nil, bcdb.ErrTxSpent
+	}
+	u.db.lock.Lock()
+	defer u.db.lock.Unlock()
+	if userID != u.userID && !u.db.isAdmin(u.userID) {
+		return nil, nil, errors.Errorf("error while processing 'GET' due to status code: 403 Forbidden, "+
+			"the user [%s] has no permission to read info of user [%s]", u.userID, userID)
+	}
+	return u.db.users[userID], nil, nil
+}
+
+func (u *usersTx) RemoveUser(userID string) error {
+	if u.spent {
+		return bcdb.ErrTxSpent
+	}
+	u.deletes = append(u.deletes, userID)
+	return nil
+}
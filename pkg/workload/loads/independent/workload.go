@@ -3,14 +3,17 @@
 package independent
 
 import (
+	"bytes"
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"math/rand"
 	"strings"
+	"sync"
 
 	"orion-bench/pkg/material"
 	"orion-bench/pkg/types"
-	"orion-bench/pkg/utils"
 	"orion-bench/pkg/workload"
 	"orion-bench/pkg/workload/common"
 
@@ -24,8 +27,20 @@ import (
 
 const tableName = "benchmark_db"
 
+type KeyDistribution string
+
+const (
+	Sequential KeyDistribution = "sequential"
+	Uniform    KeyDistribution = "uniform"
+	Zipfian    KeyDistribution = "zipfian"
+	Latest     KeyDistribution = "latest"
+	Hotspot    KeyDistribution = "hotspot"
+)
+
 type Workload struct {
 	workload *workload.Workload
+	// The zipfian distributions are shared by all users since their initialization is linear in the number of keys
+	zipfians sync.Map
 }
 
 type UserWorkload struct {
@@ -37,9 +52,12 @@ type UserWorkload struct {
 	userName      string
 	userCrypto    *material.CryptoMaterial
 	userSession   bcdb.DBSession
+	rand          *rand.Rand
+	zipfians      *sync.Map
 	keyIndex      common.CyclicCounter
 	commitCounter common.CyclicCounter
 	operations    *weightedrand.Chooser
+	phases        []*weightedrand.Chooser
 	signerCount   uint64
 	signers       map[string]crypto.Signer
 }
@@ -53,6 +71,12 @@ type OperationArgs struct {
 	asserts   uint64
 	aclUsers  uint64
 	size      uint64
+	dist      KeyDistribution
+	zipfConst float64
+	hotFrac   float64
+	hotProb   float64
+	zipfian   *common.Zipfian
+	hotspot   *common.Hotspot
 }
 
 type TxParams struct {
@@ -70,28 +94,54 @@ type TxParams struct {
 	readAcl      map[string]*oriontypes.AccessControl
 }
 
+// Schema declares the workload's parameters and operations.
+var Schema = &workload.Schema{
+	Params: []*workload.Param{
+		{Name: "lines-per-user", Type: workload.IntParam, Default: "1000", Min: workload.Bound(1),
+			Help: "The number of unique keys of each user, which are inserted in the warmup"},
+		{Name: "commits-per-sync", Type: workload.IntParam, Default: "0", Min: workload.Bound(0),
+			Help: "The number of commits before executing a synchronized commit (0: never)"},
+		{Name: "seed", Type: workload.IntParam, Default: "0",
+			Help: "The random seed of the keys access distributions (plus the user index)"},
+	},
+	Operations: operationsHelp(),
+}
+
+// New creates the workload, and declares its parameters to the parent.
 func New(parent *workload.Workload) workload.Worker {
+	parent.Schema = Schema
 	return &Workload{workload: parent}
 }
 
-func (w *Workload) Init() {
-	w.workload.CreateTable(tableName)
-	w.workload.AddUsers(tableName)
+func (w *Workload) Init() error {
+	if err := w.workload.CreateTable(tableName); err != nil {
+		return err
+	}
+	return w.workload.AddUsers(tableName)
 }
 
-func (w *Workload) MakeWorker(userIndex uint64, workType workload.WorkType) workload.UserWorker {
-	linesPerUser := uint64(w.workload.GetConfInt("lines-per-user"))
-	commitsPerSync := uint64(w.workload.GetConfInt("commits-per-sync"))
+func (w *Workload) MakeWorker(userIndex uint64, workType workload.WorkType) (workload.UserWorker, error) {
+	linesPerUser, err := w.workload.GetConfInt("lines-per-user")
+	if err != nil {
+		return nil, err
+	}
+	commitsPerSync, err := w.workload.GetConfInt("commits-per-sync")
+	if err != nil {
+		return nil, err
+	}
+	seed, err := w.workload.GetConfInt("seed")
+	if err != nil {
+		return nil, err
+	}
 	userPos := float64(userIndex) / float64(w.workload.Config.Workload.UserCount)
 	// We start the tx counter with an offset to prevent all users to synchronize concurrently
 	initialCommitCounter := uint64(userPos * float64(commitsPerSync))
 
-	cfg := w.workload.Config
-	if workType == workload.Warmup {
-		cfg.Workload.Session.TxTimeout = cfg.Workload.WarmupDuration
-	}
-
 	userCrypto := w.workload.Material.User(userIndex)
+	userSession, err := w.workload.Session(userCrypto)
+	if err != nil {
+		return nil, err
+	}
 	worker := &UserWorkload{
 		workload:    w.workload,
 		lg:          w.workload.Lg,
@@ -100,46 +150,50 @@ func (w *Workload) MakeWorker(userIndex uint64, workType workload.WorkType) work
 		userIndex:   userIndex,
 		userName:    userCrypto.Name(),
 		userCrypto:  userCrypto,
-		userSession: w.workload.Session(userCrypto),
+		userSession: userSession,
+		rand:        rand.New(rand.NewSource(int64(seed) + int64(userIndex))),
+		zipfians:    &w.zipfians,
 		keyIndex: common.CyclicCounter{
 			Value: 0,
-			Size:  linesPerUser,
+			Size:  uint64(linesPerUser),
 		},
 		commitCounter: common.CyclicCounter{
 			Value: initialCommitCounter,
-			Size:  commitsPerSync,
+			Size:  uint64(commitsPerSync),
 		},
 		signers:     map[string]crypto.Signer{},
 		signerCount: 0,
 	}
 
-	switch workType {
-	case workload.Warmup:
-		worker.operations = worker.makeOperationChooser(cfg.Workload.WarmupOperations)
-	case workload.Benchmark:
-		fallthrough
-	default:
-		worker.operations = worker.makeOperationChooser(cfg.Workload.Operations)
+	for _, phase := range w.workload.Phases(workType) {
+		chooser, err := worker.makeOperationChooser(phase.Operations)
+		if err != nil {
+			return nil, errors.Wrapf(err, "phase %s", phase.Name)
+		}
+		worker.phases = append(worker.phases, chooser)
 	}
+	worker.SetPhase(0)
 
 	// We start from 1 since we don't need the Signer of the current user
 	for i := uint64(1); i < worker.signerCount; i++ {
-		s := worker.material.User((userIndex + i) % cfg.Workload.UserCount).Signer()
+		s, err := worker.material.User((userIndex + i) % w.workload.Config.Workload.UserCount).Signer()
+		if err != nil {
+			return nil, err
+		}
 		worker.signers[s.Identity()] = s
 	}
 
-	return worker
+	return worker, nil
 }
 
-func (w *UserWorkload) Check(err error) {
-	utils.Check(w.lg, err)
+func (w *UserWorkload) SetPhase(phase int) {
+	w.operations = w.phases[phase]
 }
 
-func (w *UserWorkload) parseOperation(operation string) *OperationArgs {
-	args := &OperationArgs{
-		name: operation,
-	}
-	op := flag.NewFlagSet(operation, flag.ExitOnError)
+// operationFlags defines the flags of an operation.
+func operationFlags(args *OperationArgs) *flag.FlagSet {
+	op := flag.NewFlagSet(args.name, flag.ContinueOnError)
+	op.SetOutput(io.Discard)
 	op.Uint64Var(&args.reads, "read", 0, "read X keys")
 	op.Uint64Var(&args.queries, "query", 0, "query X keys")
 	op.Uint64Var(&args.writes, "write", 0, "write X keys")
@@ -147,42 +201,98 @@ func (w *UserWorkload) parseOperation(operation string) *OperationArgs {
 	op.Uint64Var(&args.conflicts, "conflict", 0, "run X concurrent conflicting reads TXs")
 	op.Uint64Var(&args.aclUsers, "acl", 0, "require sig of X users")
 	op.Uint64Var(&args.size, "size", 8, "values size")
-	w.Check(op.Parse(strings.Split(operation, " ")))
+	op.StringVar((*string)(&args.dist), "dist", string(Sequential),
+		"keys access distribution: sequential, uniform, zipfian, latest or hotspot")
+	op.Float64Var(&args.zipfConst, "zipf-const", common.ZipfianConstant, "zipfian/latest distribution constant")
+	op.Float64Var(&args.hotFrac, "hot-frac", 0.2, "the fraction of the keys in the hotspot")
+	op.Float64Var(&args.hotProb, "hot-prob", 0.8, "the probability of accessing a key in the hotspot")
+	return op
+}
+
+func operationsHelp() string {
+	buf := &bytes.Buffer{}
+	buf.WriteString("Each operation is a TX or a query, defined by the following flags, e.g., -read 1 -write 1 -size 8.\n")
+	buf.WriteString("An operation cannot have both a query and reads/writes.\n")
+	buf.WriteString("In the warmup, the lines are always written sequentially.\n")
+	op := operationFlags(&OperationArgs{})
+	op.SetOutput(buf)
+	op.PrintDefaults()
+	return buf.String()
+}
+
+func (w *UserWorkload) parseOperation(operation string) (*OperationArgs, error) {
+	args := &OperationArgs{
+		name: operation,
+	}
+	op := operationFlags(args)
+	if err := op.Parse(strings.Split(operation, " ")); err != nil {
+		return nil, errors.Wrapf(err, "invalid operation '%s'", operation)
+	}
 	if args.reads == 0 && args.queries == 0 && args.writes == 0 {
-		w.lg.Fatalf("an operation must include reads/writes/query.")
+		return nil, errors.New("an operation must include reads/writes/query")
 	}
 	if (args.reads > 0 || args.writes > 0) && args.queries > 0 {
-		w.lg.Fatalf("an operation can only have query or TX, not both.")
+		return nil, errors.New("an operation can only have query or TX, not both")
 	}
 	if args.aclUsers > 0 && args.writes == 0 {
-		w.lg.Fatalf("an operation must have atleast one write to include ACL.")
+		return nil, errors.New("an operation must have atleast one write to include ACL")
 	}
 	if args.conflicts > 0 && args.writes == 0 {
-		w.lg.Fatalf("operation with conflicts must have writes.")
+		return nil, errors.New("operation with conflicts must have writes")
 	}
 	if args.asserts > 0 && args.reads > 0 {
-		w.lg.Fatalf("operation cannot have reads and assert togather.")
+		return nil, errors.New("operation cannot have reads and assert togather")
 	}
 	if args.size == 0 {
 		args.size = 8
 	}
 
-	return args
+	switch args.dist {
+	case Sequential, Uniform:
+	case Zipfian, Latest:
+		zipfian, err := w.getZipfian(args.zipfConst)
+		if err != nil {
+			return nil, err
+		}
+		args.zipfian = zipfian
+	case Hotspot:
+		if args.hotFrac < 0 || args.hotFrac > 1 || args.hotProb < 0 || args.hotProb > 1 {
+			return nil, errors.New("hotspot fraction and probability must be in [0, 1]")
+		}
+		args.hotspot = common.NewHotspot(w.keyIndex.Size, args.hotFrac, args.hotProb)
+	default:
+		return nil, errors.Errorf("unknown keys access distribution: %s", args.dist)
+	}
+
+	return args, nil
+}
+
+func (w *UserWorkload) getZipfian(theta float64) (*common.Zipfian, error) {
+	z, ok := w.zipfians.Load(theta)
+	if !ok {
+		zipfian, err := common.NewZipfian(w.keyIndex.Size, theta)
+		if err != nil {
+			return nil, err
+		}
+		z, _ = w.zipfians.LoadOrStore(theta, zipfian)
+	}
+	return z.(*common.Zipfian), nil
 }
 
-func (w *UserWorkload) makeOperationChooser(ops []types.WorkloadOperation) *weightedrand.Chooser {
+func (w *UserWorkload) makeOperationChooser(ops []types.WorkloadOperation) (*weightedrand.Chooser, error) {
 	var choices []weightedrand.Choice
 	for _, op := range ops {
 		if op.Weight == 0 {
 			op.Weight = 1
 		}
-		opArgs := w.parseOperation(op.Operation)
+		opArgs, err := w.parseOperation(op.Operation)
+		if err != nil {
+			return nil, err
+		}
 		choices = append(choices, weightedrand.NewChoice(opArgs, op.Weight))
 		w.signerCount = common.Max(w.signerCount, opArgs.aclUsers)
 	}
-	chooser, err := weightedrand.NewChooser(choices...)
-	w.Check(err)
-	return chooser
+	return weightedrand.NewChooser(choices...)
 }
 
 func (w *UserWorkload) read(tx bcdb.DataTxContext, key string) ([]byte, *oriontypes.Metadata, error) {
@@ -214,9 +324,14 @@ func (w *UserWorkload) txCommit(params *TxParams) error {
 
 	dataTx, isDataTx := params.tx.(bcdb.DataTxContext)
 	if isDataTx && len(params.needSign) > 0 {
-		txEnv := w.workload.MultiSignDataTx(dataTx, params.needSign)
+		txEnv, err := w.workload.MultiSignDataTx(dataTx, params.needSign)
+		if err != nil {
+			return err
+		}
 		newTx, err := w.userSession.LoadDataTx(txEnv)
-		w.Check(err)
+		if err != nil {
+			return err
+		}
 		params.tx = newTx
 	}
 
@@ -232,16 +347,16 @@ func (w *UserWorkload) txCommit(params *TxParams) error {
 	return err
 }
 
-func (w *UserWorkload) txRead(params *TxParams) {
+func (w *UserWorkload) txRead(params *TxParams) error {
 	dataTx, isDataTx := params.tx.(bcdb.DataTxContext)
 	if !isDataTx {
-		w.lg.Fatal("attempt to read with non data TX")
+		return workload.Fatal(errors.New("attempt to read with non data TX"))
 	}
 
 	for _, k := range params.readKeys {
 		record, metadata, err := w.read(dataTx, k)
 		if err != nil {
-			w.lg.Errorf("failed to read key '%s': %s", k, err)
+			w.lg.Debugf("failed to read key '%s': %s", k, err)
 			continue
 		}
 		params.readRecords[k] = record
@@ -249,26 +364,28 @@ func (w *UserWorkload) txRead(params *TxParams) {
 			params.readAcl[k] = metadata.AccessControl
 		}
 	}
+	return nil
 }
 
-func (w *UserWorkload) txAssert(params *TxParams) {
+func (w *UserWorkload) txAssert(params *TxParams) error {
 	dataTx, isDataTx := params.tx.(bcdb.DataTxContext)
 	if !isDataTx {
-		w.lg.Fatal("attempt to read with non data TX")
+		return workload.Fatal(errors.New("attempt to read with non data TX"))
 	}
 
 	for _, k := range params.assertKeys {
 		err := dataTx.AssertRead(tableName, k, &oriontypes.Version{})
 		if err != nil {
-			w.lg.Errorf("failed to read key '%s': %s", k, err)
+			w.lg.Debugf("failed to read key '%s': %s", k, err)
 		}
 	}
+	return nil
 }
 
-func (w *UserWorkload) txWrite(params *TxParams) {
+func (w *UserWorkload) txWrite(params *TxParams) error {
 	dataTx, isDataTx := params.tx.(bcdb.DataTxContext)
 	if !isDataTx {
-		w.lg.Fatal("attempt to write with non data TX")
+		return workload.Fatal(errors.New("attempt to write with non data TX"))
 	}
 
 	for _, k := range params.writeKeys {
@@ -276,7 +393,7 @@ func (w *UserWorkload) txWrite(params *TxParams) {
 		rand.Read(value)
 		err := w.write(dataTx, k, value, params.writeAcl)
 		if err != nil {
-			w.lg.Errorf("failed to write key '%s': %s", k, err)
+			w.lg.Debugf("failed to write key '%s': %s", k, err)
 			continue
 		}
 		params.writeRecords[k] = value
@@ -289,14 +406,42 @@ func (w *UserWorkload) txWrite(params *TxParams) {
 			}
 		}
 	}
+	return nil
 }
 
 func (w *UserWorkload) key(line uint64) string {
 	return fmt.Sprintf("%s.%d", w.userName, line)
 }
 
-func (w *UserWorkload) keyRange(length uint64) []string {
+// drawLine draws a line according to the operation's keys access distribution.
+// The latest distribution favors the lines that were recently written by this user.
+func (w *UserWorkload) drawLine(op *OperationArgs) uint64 {
+	lines := w.keyIndex.Size
+	switch op.dist {
+	case Uniform:
+		return uint64(w.rand.Int63n(int64(lines)))
+	case Zipfian:
+		return op.zipfian.NextScrambled(w.rand)
+	case Latest:
+		return (w.keyIndex.Value + lines - 1 - op.zipfian.Next(w.rand)) % lines
+	case Hotspot:
+		return op.hotspot.Next(w.rand)
+	default:
+		return w.keyIndex.Value
+	}
+}
+
+// keyRange returns the keys of the next operation.
+// In the warmup, the keys are always sequential to make sure all the lines are written.
+func (w *UserWorkload) keyRange(op *OperationArgs, length uint64) []string {
 	var ret []string
+	if op.dist != Sequential && w.workType != workload.Warmup {
+		for i := uint64(0); i < length; i++ {
+			ret = append(ret, w.key(w.drawLine(op)))
+		}
+		return ret
+	}
+
 	// Copy key index to avoid incrementing the global state
 	keyIndex := w.keyIndex
 	for i := uint64(0); i < length; i++ {
@@ -326,12 +471,18 @@ func (w *UserWorkload) getAcl(userCount uint64) *oriontypes.AccessControl {
 	return acl
 }
 
-func (w *UserWorkload) query(width uint64) error {
+func (w *UserWorkload) query(op *OperationArgs) error {
 	tx, err := w.userSession.Query()
-	w.Check(err)
+	if err != nil {
+		return err
+	}
 
+	startKey := w.key(w.keyIndex.Value)
+	if w.workType != workload.Warmup {
+		startKey = w.key(w.drawLine(op))
+	}
 	return w.workload.Stats.TimeOperation(common.Query, func() (uint64, error) {
-		it, err := tx.GetDataByRange(tableName, w.key(w.keyIndex.Value), "", width)
+		it, err := tx.GetDataByRange(tableName, startKey, "", op.queries)
 		if err != nil {
 			return 0, err
 		}
@@ -358,23 +509,25 @@ func (w *UserWorkload) needSync(writes uint64) bool {
 		(w.commitCounter.Size > 0 && w.commitCounter.Value == 0))
 }
 
-func (w *UserWorkload) getTxParams(args *OperationArgs) *TxParams {
+func (w *UserWorkload) getTxParams(args *OperationArgs) (*TxParams, error) {
 	tx, err := w.userSession.DataTx()
-	w.Check(err)
+	if err != nil {
+		return nil, err
+	}
 	return &TxParams{
 		tx:           tx,
 		commit:       w.needCommit(args.writes),
 		sync:         w.needSync(args.writes),
-		readKeys:     w.keyRange(args.reads),
-		assertKeys:   w.keyRange(args.asserts),
-		writeKeys:    w.keyRange(args.writes),
+		readKeys:     w.keyRange(args, args.reads),
+		assertKeys:   w.keyRange(args, args.asserts),
+		writeKeys:    w.keyRange(args, args.writes),
 		writeAcl:     w.getAcl(args.aclUsers),
 		writeSize:    args.size,
 		needSign:     map[string]crypto.Signer{},
 		readRecords:  map[string][]byte{},
 		writeRecords: map[string][]byte{},
 		readAcl:      map[string]*oriontypes.AccessControl{},
-	}
+	}, nil
 }
 
 func (t *TxParams) calcTotalWriteSize() uint64 {
@@ -386,9 +539,11 @@ func (t *TxParams) calcTotalWriteSize() uint64 {
 	return size
 }
 
-func (w *UserWorkload) getWriteConflictTxParams(main *TxParams) *TxParams {
+func (w *UserWorkload) getWriteConflictTxParams(main *TxParams) (*TxParams, error) {
 	tx, err := w.userSession.DataTx()
-	w.Check(err)
+	if err != nil {
+		return nil, err
+	}
 	return &TxParams{
 		tx:           tx,
 		commit:       true,
@@ -401,12 +556,14 @@ func (w *UserWorkload) getWriteConflictTxParams(main *TxParams) *TxParams {
 		readRecords:  map[string][]byte{},
 		writeRecords: map[string][]byte{},
 		readAcl:      map[string]*oriontypes.AccessControl{},
-	}
+	}, nil
 }
 
-func (w *UserWorkload) getReadConflictTxParams(main *TxParams) *TxParams {
+func (w *UserWorkload) getReadConflictTxParams(main *TxParams) (*TxParams, error) {
 	tx, err := w.userSession.DataTx()
-	w.Check(err)
+	if err != nil {
+		return nil, err
+	}
 	return &TxParams{
 		tx:           tx,
 		commit:       true,
@@ -419,32 +576,42 @@ func (w *UserWorkload) getReadConflictTxParams(main *TxParams) *TxParams {
 		readRecords:  map[string][]byte{},
 		writeRecords: map[string][]byte{},
 		readAcl:      map[string]*oriontypes.AccessControl{},
-	}
+	}, nil
 }
 
 func (w *UserWorkload) transaction(op *OperationArgs) error {
-	mainParams := w.getTxParams(op)
+	mainParams, err := w.getTxParams(op)
+	if err != nil {
+		return err
+	}
 	params := []*TxParams{mainParams}
+	defer w.workload.AbortTx(mainParams.tx)
 	for i := uint64(0); i < op.conflicts; i++ {
-		p := w.getReadConflictTxParams(mainParams)
-		params = append(params, p)
-	}
-
-	for _, p := range params {
+		p, err := w.getReadConflictTxParams(mainParams)
+		if err != nil {
+			return err
+		}
 		//goland:noinspection GoDeferInLoop
-		defer w.workload.CheckAbort(p.tx)
+		defer w.workload.AbortTx(p.tx)
+		params = append(params, p)
 	}
 
 	for _, p := range params {
-		w.txRead(p)
+		if err = w.txRead(p); err != nil {
+			return err
+		}
 	}
 
 	for _, p := range params {
-		w.txAssert(p)
+		if err = w.txAssert(p); err != nil {
+			return err
+		}
 	}
 
 	for _, p := range params {
-		w.txWrite(p)
+		if err = w.txWrite(p); err != nil {
+			return err
+		}
 	}
 
 	var commitErr []error
@@ -465,24 +632,30 @@ func (w *UserWorkload) drawOperation() *OperationArgs {
 	return w.operations.Pick().(*OperationArgs)
 }
 
-func (w *UserWorkload) Work() workload.WorkStatus {
+func (w *UserWorkload) Work(ctx context.Context) (workload.WorkStatus, error) {
 	op := w.drawOperation()
 
 	var err error
 	if op.queries > 0 {
-		err = w.query(op.queries)
+		err = w.query(op)
 	} else {
 		err = w.transaction(op)
 	}
 
+	if err != nil && ctx.Err() != nil {
+		// The work was stopped while the operation was in-flight
+		w.lg.Debugf("Op '%s' failed after the work was stopped: %s", op.name, err)
+		return workload.Enough, nil
+	}
 	if err != nil {
-		w.lg.Errorf("Op '%s' faild with error: %s", op.name, err)
-		return workload.NeedBackoff
+		// A sample of the failures is logged by the client stats
+		w.lg.Debugf("Op '%s' failed: %s", op.name, err)
+		return workload.NeedBackoff, errors.WithMessagef(err, "op '%s'", op.name)
 	}
 
 	cycleCompleted := w.keyIndex.Inc(common.Max(1, op.writes))
 	if w.workType == workload.Warmup && cycleCompleted {
-		return workload.Enough
+		return workload.Enough, nil
 	}
-	return workload.Ok
+	return workload.Ok, nil
 }
@@ -0,0 +1,179 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package independent
+
+import (
+	"testing"
+
+	"orion-bench/pkg/types"
+	"orion-bench/pkg/workload"
+	"orion-bench/pkg/workload/common"
+	"orion-bench/pkg/workload/workloadtest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkload(t *testing.T) {
+	for _, operation := range []string{
+		"-read 1 -write 1 -size 8",
+		"-read 2 -write 2 -dist uniform",
+		"-read 1 -write 1 -dist zipfian",
+		"-read 1 -write 1 -dist latest",
+		"-read 1 -write 1 -dist hotspot",
+		"-query 5",
+		"-read 1 -write 1 -acl 2",
+	} {
+		t.Run(operation, func(t *testing.T) {
+			conf := workloadtest.Config(t, 4)
+			conf.Workload.Parameters = map[string]string{"lines-per-user": "10", "commits-per-sync": "2"}
+			conf.Workload.WarmupOperations = []types.WorkloadOperation{{Operation: "-write 5 -size 8", Weight: 1}}
+			conf.Workload.Operations = []types.WorkloadOperation{{Operation: operation, Weight: 1}}
+			w, db := workloadtest.New(t, conf, New)
+
+			workloadtest.Warmup(t, w, 10)
+			require.Len(t, db.Keys(tableName), 4*10)
+
+			// Each user accesses all its lines more than once, so the ACL operation also writes keys with an ACL
+			workloadtest.Benchmark(t, w, 30)
+			require.Len(t, db.Keys(tableName), 4*10)
+			workloadtest.RequireValid(t, db)
+		})
+	}
+}
+
+func TestMakeWorkerInvalidOperation(t *testing.T) {
+	for _, tc := range []struct {
+		operation string
+		err       string
+	}{
+		{"-read 1 -query 1", "an operation can only have query or TX, not both"},
+		{"-read 1 -dist zipfian -zipf-const 1", "zipfian constant must be in (0, 1), got: 1"},
+		{"-read 1 -dist latest -zipf-const 0", "zipfian constant must be in (0, 1), got: 0"},
+		{"-read 1 -dist zipfian -zipf-const -0.5", "zipfian constant must be in (0, 1), got: -0.5"},
+		{"-read 1 -dist hotspot -hot-frac 2", "hotspot fraction and probability must be in [0, 1]"},
+		{"-read 1 -dist hotspot -hot-prob -0.5", "hotspot fraction and probability must be in [0, 1]"},
+		{"-read 1 -dist pareto", "unknown keys access distribution: pareto"},
+	} {
+		t.Run(tc.operation, func(t *testing.T) {
+			conf := workloadtest.Config(t, 1)
+			conf.Workload.Operations = []types.WorkloadOperation{{Operation: tc.operation, Weight: 1}}
+			w, _ := workloadtest.New(t, conf, New)
+			_, err := w.Worker.MakeWorker(0, workload.Benchmark)
+			require.EqualError(t, err, "phase benchmark: "+tc.err)
+		})
+	}
+}
+
+// newKeysWorker returns the worker of the first user, out of 100 lines.
+func newKeysWorker(t *testing.T, workType workload.WorkType) *UserWorkload {
+	conf := workloadtest.Config(t, 1)
+	conf.Workload.Parameters = map[string]string{"lines-per-user": "100"}
+	conf.Workload.WarmupOperations = []types.WorkloadOperation{{Operation: "-write 1", Weight: 1}}
+	conf.Workload.Operations = []types.WorkloadOperation{{Operation: "-read 1", Weight: 1}}
+	w, _ := workloadtest.New(t, conf, New)
+	worker, err := w.Worker.MakeWorker(0, workType)
+	require.NoError(t, err)
+	return worker.(*UserWorkload)
+}
+
+func TestKeyDistribution(t *testing.T) {
+	const draws = 50000
+	for _, tc := range []struct {
+		operation string
+		// check verifies the frequency of each line (out of 100), where the key index is at line 50
+		check func(t *testing.T, freq []float64)
+	}{
+		{
+			operation: "-read 1",
+			check: func(t *testing.T, freq []float64) {
+				require.Equal(t, 1., freq[50], "the sequential lines are accessed by the key index")
+			},
+		},
+		{
+			operation: "-read 1 -dist uniform",
+			check: func(t *testing.T, freq []float64) {
+				for line, f := range freq {
+					require.InDelta(t, 0.01, f, 0.002, line)
+				}
+			},
+		},
+		{
+			operation: "-read 1 -dist zipfian",
+			check: func(t *testing.T, freq []float64) {
+				// The most popular line is scattered by its hash, and is accessed much more than the others
+				hot := common.FNVHash64(0) % 100
+				require.NotZero(t, hot)
+				require.Greater(t, freq[hot], 0.15)
+				for line, f := range freq {
+					if uint64(line) != hot {
+						require.Less(t, f, freq[hot]/1.5, line)
+					}
+				}
+			},
+		},
+		{
+			operation: "-read 1 -dist latest",
+			check: func(t *testing.T, freq []float64) {
+				// The most recently written lines are the most popular
+				require.Greater(t, freq[49], 0.15)
+				require.Greater(t, freq[48], 0.07)
+				require.Greater(t, sum(freq[40:50]), 0.5)
+				require.Less(t, sum(freq[50:60]), 0.05)
+			},
+		},
+		{
+			operation: "-read 1 -dist hotspot -hot-frac 0.1 -hot-prob 0.9",
+			check: func(t *testing.T, freq []float64) {
+				require.InDelta(t, 0.9, sum(freq[:10]), 0.01)
+				for line, f := range freq[:10] {
+					require.InDelta(t, 0.09, f, 0.01, line)
+				}
+			},
+		},
+	} {
+		t.Run(tc.operation, func(t *testing.T) {
+			worker := newKeysWorker(t, workload.Benchmark)
+			worker.keyIndex.Value = 50
+			op, err := worker.parseOperation(tc.operation)
+			require.NoError(t, err)
+
+			counts := map[string]float64{}
+			for i := 0; i < draws; i++ {
+				keys := worker.keyRange(op, 1)
+				require.Len(t, keys, 1)
+				counts[keys[0]]++
+			}
+			freq := make([]float64, 100)
+			for line := range freq {
+				freq[line] = counts[worker.key(uint64(line))] / draws
+				delete(counts, worker.key(uint64(line)))
+			}
+			require.Empty(t, counts, "only the user's lines are accessed")
+			tc.check(t, freq)
+		})
+	}
+}
+
+func TestKeyDistributionWarmup(t *testing.T) {
+	// In the warmup, the lines are accessed sequentially from the key index, regardless of the distribution
+	worker := newKeysWorker(t, workload.Warmup)
+	worker.keyIndex.Value = 98
+	op, err := worker.parseOperation("-write 4 -dist zipfian")
+	require.NoError(t, err)
+	expected := []string{worker.key(98), worker.key(99), worker.key(0), worker.key(1)}
+	for i := 0; i < 3; i++ {
+		require.Equal(t, expected, worker.keyRange(op, 4))
+	}
+}
+
+func sum(values []float64) float64 {
+	total := 0.
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
+
+func TestSchemaDefaults(t *testing.T) {
+	require.Empty(t, Schema.CheckDefaults())
+}
@@ -0,0 +1,502 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package smallbank
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+
+	"orion-bench/pkg/types"
+	"orion-bench/pkg/workload"
+	"orion-bench/pkg/workload/common"
+
+	"github.com/hyperledger-labs/orion-sdk-go/pkg/bcdb"
+	"github.com/hyperledger-labs/orion-server/pkg/logger"
+	"github.com/mroth/weightedrand"
+	"github.com/pkg/errors"
+)
+
+const (
+	checkingTable = "checking"
+	savingsTable  = "savings"
+)
+
+type Transaction string
+
+const (
+	Balance         Transaction = "balance"
+	DepositChecking Transaction = "deposit-checking"
+	TransactSavings Transaction = "transact-savings"
+	Amalgamate      Transaction = "amalgamate"
+	WriteCheck      Transaction = "write-check"
+	SendPayment     Transaction = "send-payment"
+)
+
+// DefaultMix is the classic SmallBank transaction mix.
+var DefaultMix = map[Transaction]uint{
+	Balance:         15,
+	DepositChecking: 15,
+	TransactSavings: 15,
+	Amalgamate:      15,
+	WriteCheck:      15,
+	SendPayment:     25,
+}
+
+// errInsufficientFunds is returned when a transaction is aborted by the application logic.
+var errInsufficientFunds = errors.New("insufficient funds")
+
+type Workload struct {
+	workload *workload.Workload
+
+	// Evaluated lazily
+	parseOnce      sync.Once
+	parseErr       error
+	accountCount   uint64
+	hotspot        *common.Hotspot
+	initialBalance int64
+	maxAmount      int64
+	insertBatch    uint64
+	commitsPerSync uint64
+	seed           int64
+}
+
+type UserWorkload struct {
+	parent        *Workload
+	workload      *workload.Workload
+	lg            *logger.SugarLogger
+	workType      workload.WorkType
+	userIndex     uint64
+	userCount     uint64
+	userSession   bcdb.DBSession
+	rand          *rand.Rand
+	loadIndex     uint64
+	writeSize     uint64
+	commitCounter common.CyclicCounter
+	operations    *weightedrand.Chooser
+	phases        []*weightedrand.Chooser
+}
+
+// Schema declares the workload's parameters and operations.
+var Schema = &workload.Schema{
+	Params: []*workload.Param{
+		{Name: "account-count", Type: workload.IntParam, Default: "10000", Min: workload.Bound(2),
+			Help: "The number of accounts"},
+		{Name: "hotspot-fraction", Type: workload.FloatParam, Default: "0.01",
+			Min: workload.Bound(0), Max: workload.Bound(1), Help: "The fraction of the accounts in the hotspot"},
+		{Name: "hotspot-probability", Type: workload.FloatParam, Default: "0.9",
+			Min: workload.Bound(0), Max: workload.Bound(1), Help: "The probability of accessing an account in the hotspot"},
+		{Name: "initial-balance", Type: workload.IntParam, Default: "10000", Min: workload.Bound(0),
+			Help: "The initial checking and savings balance"},
+		{Name: "max-amount", Type: workload.IntParam, Default: "100", Min: workload.Bound(1),
+			Help: "The amounts are uniformly distributed in [1, max-amount]"},
+		{Name: "insert-batch", Type: workload.IntParam, Default: "100", Min: workload.Bound(1),
+			Help: "The number of accounts per TX in the warmup"},
+		{Name: "commits-per-sync", Type: workload.IntParam, Default: "1", Min: workload.Bound(0),
+			Help: "The number of commits before executing a synchronized commit (0: never)"},
+		{Name: "seed", Type: workload.IntParam, Default: "0",
+			Help: "The random seed of the users (plus the user index)"},
+	},
+	Operations: "Each operation is one of the SmallBank transactions: balance, deposit-checking, transact-savings,\n" +
+		"amalgamate, write-check, send-payment.\n" +
+		"With no operations, the classic mix is used. The warmup creates the accounts regardless of the operations.\n",
+}
+
+// New creates the workload, and declares its parameters to the parent.
+func New(parent *workload.Workload) workload.Worker {
+	parent.Schema = Schema
+	return &Workload{workload: parent}
+}
+
+func (w *Workload) Init() error {
+	for _, table := range []string{checkingTable, savingsTable} {
+		if err := w.workload.CreateTable(table); err != nil {
+			return err
+		}
+	}
+	return w.workload.AddUsers(checkingTable, savingsTable)
+}
+
+func (w *Workload) parseParameters() error {
+	for _, p := range []struct {
+		key string
+		set func(value int)
+	}{
+		{"account-count", func(v int) { w.accountCount = uint64(v) }},
+		{"initial-balance", func(v int) { w.initialBalance = int64(v) }},
+		{"max-amount", func(v int) { w.maxAmount = int64(v) }},
+		{"insert-batch", func(v int) { w.insertBatch = uint64(v) }},
+		{"commits-per-sync", func(v int) { w.commitsPerSync = uint64(v) }},
+		{"seed", func(v int) { w.seed = int64(v) }},
+	} {
+		value, err := w.workload.GetConfInt(p.key)
+		if err != nil {
+			return err
+		}
+		p.set(value)
+	}
+	hotspotFraction, err := w.workload.GetConfFloat("hotspot-fraction")
+	if err != nil {
+		return err
+	}
+	hotspotProbability, err := w.workload.GetConfFloat("hotspot-probability")
+	if err != nil {
+		return err
+	}
+
+	if w.accountCount < 2 {
+		return errors.New("account-count must be at least 2")
+	}
+	if hotspotFraction < 0 || hotspotFraction > 1 || hotspotProbability < 0 || hotspotProbability > 1 {
+		return errors.New("hotspot-fraction and hotspot-probability must be in [0, 1]")
+	}
+	if w.maxAmount <= 0 || w.insertBatch == 0 {
+		return errors.New("max-amount and insert-batch must be positive")
+	}
+	w.hotspot = common.NewHotspot(w.accountCount, hotspotFraction, hotspotProbability)
+	return nil
+}
+
+func (w *Workload) MakeWorker(userIndex uint64, workType workload.WorkType) (workload.UserWorker, error) {
+	w.parseOnce.Do(func() {
+		w.parseErr = w.parseParameters()
+	})
+	if w.parseErr != nil {
+		return nil, w.parseErr
+	}
+	userSession, err := w.workload.UserSession(userIndex)
+	if err != nil {
+		return nil, err
+	}
+	userCount := w.workload.Config.Workload.UserCount
+	userPos := float64(userIndex) / float64(userCount)
+	// We start the tx counter with an offset to prevent all users to synchronize concurrently
+	initialCommitCounter := uint64(userPos * float64(w.commitsPerSync))
+
+	worker := &UserWorkload{
+		parent:      w,
+		workload:    w.workload,
+		lg:          w.workload.Lg,
+		workType:    workType,
+		userIndex:   userIndex,
+		userCount:   userCount,
+		userSession: userSession,
+		rand:        rand.New(rand.NewSource(w.seed + int64(userIndex))),
+		loadIndex:   userIndex,
+		commitCounter: common.CyclicCounter{
+			Value: initialCommitCounter,
+			Size:  w.commitsPerSync,
+		},
+	}
+
+	for _, phase := range w.workload.Phases(workType) {
+		ops := phase.Operations
+		if workType == workload.Warmup {
+			// The warmup creates the accounts regardless of the operations
+			ops = nil
+		}
+		chooser, err := worker.makeOperationChooser(ops)
+		if err != nil {
+			return nil, errors.Wrapf(err, "phase %s", phase.Name)
+		}
+		worker.phases = append(worker.phases, chooser)
+	}
+	worker.SetPhase(0)
+	return worker, nil
+}
+
+func (w *UserWorkload) SetPhase(phase int) {
+	w.operations = w.phases[phase]
+}
+
+func parseTransaction(operation string) (Transaction, bool) {
+	t := Transaction(strings.ToLower(strings.TrimSpace(operation)))
+	_, ok := DefaultMix[t]
+	return t, ok
+}
+
+// makeOperationChooser uses the configured operations, or the classic SmallBank mix if none are configured.
+func (w *UserWorkload) makeOperationChooser(ops []types.WorkloadOperation) (*weightedrand.Chooser, error) {
+	var choices []weightedrand.Choice
+	for _, op := range ops {
+		if op.Weight == 0 {
+			op.Weight = 1
+		}
+		t, ok := parseTransaction(op.Operation)
+		if !ok {
+			return nil, errors.Errorf("unknown SmallBank transaction: %s", op.Operation)
+		}
+		choices = append(choices, weightedrand.NewChoice(t, op.Weight))
+	}
+	if len(choices) == 0 {
+		for t, weight := range DefaultMix {
+			choices = append(choices, weightedrand.NewChoice(t, weight))
+		}
+	}
+	return weightedrand.NewChooser(choices...)
+}
+
+func key(account uint64) string {
+	return fmt.Sprintf("account.%d", account)
+}
+
+// nextAccount draws an account from the hotspot with the hotspot probability, and from the rest otherwise.
+func (w *UserWorkload) nextAccount() uint64 {
+	return w.parent.hotspot.Next(w.rand)
+}
+
+// nextAccountPair draws two different accounts.
+// If the same account is drawn twice, the next account is used, so a single account hotspot is still contended.
+func (w *UserWorkload) nextAccountPair() (uint64, uint64) {
+	a, b := w.nextAccount(), w.nextAccount()
+	if a == b {
+		b = (a + 1) % w.parent.accountCount
+	}
+	return a, b
+}
+
+func (w *UserWorkload) nextAmount() int64 {
+	return w.rand.Int63n(w.parent.maxAmount) + 1
+}
+
+func (w *UserWorkload) getBalance(tx bcdb.DataTxContext, table string, account uint64) (int64, error) {
+	var balance int64
+	err := w.workload.Stats.TimeOperation(common.Read, func() (uint64, error) {
+		rawRecord, _, err := tx.Get(table, key(account))
+		if err != nil {
+			return 1, err
+		}
+		if rawRecord == nil {
+			return 1, errors.Errorf("account '%s' does not exist in '%s'", key(account), table)
+		}
+		balance, err = strconv.ParseInt(string(rawRecord), 10, 64)
+		return 1, err
+	})
+	return balance, err
+}
+
+func (w *UserWorkload) putBalance(tx bcdb.DataTxContext, table string, account uint64, balance int64) error {
+	k := key(account)
+	value := []byte(strconv.FormatInt(balance, 10))
+	w.writeSize += uint64(len(k) + len(value))
+	return w.workload.Stats.TimeOperation(common.Write, func() (uint64, error) {
+		return 1, tx.Put(table, k, value, nil)
+	})
+}
+
+func (w *UserWorkload) needSync() bool {
+	return w.commitCounter.Size > 0 && w.commitCounter.Value == 0
+}
+
+// commit commits the TX. MVCC conflicts are reported with a distinct status.
+func (w *UserWorkload) commit(tx bcdb.DataTxContext, sync bool) error {
+	w.commitCounter.Inc(1)
+	err := w.workload.Stats.TimeOperation(common.GetCommitOp(sync), func() (uint64, error) {
+		return 1, w.workload.CommitSync(tx, sync)
+	})
+	w.workload.Stats.ObserveContentSize(w.writeSize, err)
+	return err
+}
+
+func (w *UserWorkload) balance(tx bcdb.DataTxContext) error {
+	account := w.nextAccount()
+	if _, err := w.getBalance(tx, savingsTable, account); err != nil {
+		return err
+	}
+	_, err := w.getBalance(tx, checkingTable, account)
+	return err
+}
+
+func (w *UserWorkload) depositChecking(tx bcdb.DataTxContext) error {
+	account := w.nextAccount()
+	checking, err := w.getBalance(tx, checkingTable, account)
+	if err != nil {
+		return err
+	}
+	return w.putBalance(tx, checkingTable, account, checking+w.nextAmount())
+}
+
+func (w *UserWorkload) transactSavings(tx bcdb.DataTxContext) error {
+	account := w.nextAccount()
+	savings, err := w.getBalance(tx, savingsTable, account)
+	if err != nil {
+		return err
+	}
+	// A withdrawal or a deposit
+	amount := w.nextAmount()
+	if w.rand.Intn(2) == 0 {
+		amount = -amount
+	}
+	if savings+amount < 0 {
+		return errInsufficientFunds
+	}
+	return w.putBalance(tx, savingsTable, account, savings+amount)
+}
+
+func (w *UserWorkload) amalgamate(tx bcdb.DataTxContext) error {
+	src, dst := w.nextAccountPair()
+	savings, err := w.getBalance(tx, savingsTable, src)
+	if err != nil {
+		return err
+	}
+	checking, err := w.getBalance(tx, checkingTable, src)
+	if err != nil {
+		return err
+	}
+	dstChecking, err := w.getBalance(tx, checkingTable, dst)
+	if err != nil {
+		return err
+	}
+	if err = w.putBalance(tx, savingsTable, src, 0); err != nil {
+		return err
+	}
+	if err = w.putBalance(tx, checkingTable, src, 0); err != nil {
+		return err
+	}
+	return w.putBalance(tx, checkingTable, dst, dstChecking+savings+checking)
+}
+
+func (w *UserWorkload) writeCheck(tx bcdb.DataTxContext) error {
+	account := w.nextAccount()
+	savings, err := w.getBalance(tx, savingsTable, account)
+	if err != nil {
+		return err
+	}
+	checking, err := w.getBalance(tx, checkingTable, account)
+	if err != nil {
+		return err
+	}
+	amount := w.nextAmount()
+	if savings+checking < amount {
+		// An overdraft penalty
+		amount += 1
+	}
+	return w.putBalance(tx, checkingTable, account, checking-amount)
+}
+
+func (w *UserWorkload) sendPayment(tx bcdb.DataTxContext) error {
+	src, dst := w.nextAccountPair()
+	srcChecking, err := w.getBalance(tx, checkingTable, src)
+	if err != nil {
+		return err
+	}
+	dstChecking, err := w.getBalance(tx, checkingTable, dst)
+	if err != nil {
+		return err
+	}
+	amount := w.nextAmount()
+	if srcChecking < amount {
+		return errInsufficientFunds
+	}
+	if err = w.putBalance(tx, checkingTable, src, srcChecking-amount); err != nil {
+		return err
+	}
+	return w.putBalance(tx, checkingTable, dst, dstChecking+amount)
+}
+
+func (w *UserWorkload) transaction(t Transaction) error {
+	tx, err := w.userSession.DataTx()
+	if err != nil {
+		return err
+	}
+	defer w.workload.AbortTx(tx)
+	w.writeSize = 0
+
+	switch t {
+	case Balance:
+		err = w.balance(tx)
+	case DepositChecking:
+		err = w.depositChecking(tx)
+	case TransactSavings:
+		err = w.transactSavings(tx)
+	case Amalgamate:
+		err = w.amalgamate(tx)
+	case WriteCheck:
+		err = w.writeCheck(tx)
+	case SendPayment:
+		err = w.sendPayment(tx)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Balance is a read-only transaction
+	if t == Balance {
+		return nil
+	}
+	return w.commit(tx, w.needSync())
+}
+
+// load creates the next batch of the user's share of the accounts in a single TX.
+// The last batch is always committed synchronously.
+func (w *UserWorkload) load() (workload.WorkStatus, error) {
+	if w.loadIndex >= w.parent.accountCount {
+		return workload.Enough, nil
+	}
+
+	tx, err := w.userSession.DataTx()
+	if err != nil {
+		return workload.NeedBackoff, err
+	}
+	defer w.workload.AbortTx(tx)
+	account := w.loadIndex
+	w.writeSize = 0
+	var count uint64 = 0
+	for ; count < w.parent.insertBatch && account < w.parent.accountCount; count++ {
+		for _, table := range []string{checkingTable, savingsTable} {
+			if err = w.putBalance(tx, table, account, w.parent.initialBalance); err != nil {
+				return workload.NeedBackoff, errors.WithMessagef(err, "failed to create account '%s'", key(account))
+			}
+		}
+		account += w.userCount
+	}
+
+	lastBatch := account >= w.parent.accountCount
+	if err = w.commit(tx, lastBatch || w.needSync()); err != nil {
+		return workload.NeedBackoff, errors.WithMessage(err, "failed to create accounts")
+	}
+	w.loadIndex = account
+	if lastBatch {
+		return workload.Enough, nil
+	}
+	return workload.Ok, nil
+}
+
+func (w *UserWorkload) Work(ctx context.Context) (workload.WorkStatus, error) {
+	if w.workType == workload.Warmup {
+		status, err := w.load()
+		if err != nil && ctx.Err() != nil {
+			w.lg.Debugf("Load failed after the work was stopped: %s", err)
+			return workload.Enough, nil
+		}
+		if err != nil {
+			w.lg.Debugf("Load failed: %s", err)
+		}
+		return status, err
+	}
+
+	t := w.operations.Pick().(Transaction)
+	err := w.transaction(t)
+	switch {
+	case err == nil:
+		return workload.Ok, nil
+	case err == errInsufficientFunds:
+		w.lg.Debugf("Op '%s' aborted: %s", t, err)
+		return workload.Ok, nil
+	case common.IsConflict(err):
+		// Conflicts are expected under contention, and are not a sign of server overload
+		w.lg.Debugf("Op '%s' aborted due to a conflict: %s", t, err)
+		return workload.Ok, nil
+	case ctx.Err() != nil:
+		// The work was stopped while the operation was in-flight
+		w.lg.Debugf("Op '%s' failed after the work was stopped: %s", t, err)
+		return workload.Enough, nil
+	default:
+		// A sample of the failures is logged by the client stats
+		w.lg.Debugf("Op '%s' failed: %s", t, err)
+		return workload.NeedBackoff, errors.WithMessagef(err, "op '%s'", t)
+	}
+}
@@ -0,0 +1,84 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package smallbank
+
+import (
+	"strconv"
+	"testing"
+
+	"orion-bench/pkg/types"
+	"orion-bench/pkg/workload/workloadtest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkload(t *testing.T) {
+	conf := workloadtest.Config(t, 2)
+	conf.Workload.Parameters = map[string]string{
+		"account-count":   "20",
+		"initial-balance": "1000",
+		"insert-batch":    "5",
+	}
+	w, db := workloadtest.New(t, conf, New)
+
+	// Each user creates half of the accounts, in batches of 5
+	workloadtest.Warmup(t, w, 2)
+	for _, table := range []string{checkingTable, savingsTable} {
+		keys := db.Keys(table)
+		require.Len(t, keys, 20)
+		for _, k := range keys {
+			require.Equal(t, "1000", string(db.Get(table, k).GetValue()))
+		}
+	}
+
+	workloadtest.Benchmark(t, w, 50)
+	workloadtest.RequireValid(t, db)
+	for _, table := range []string{checkingTable, savingsTable} {
+		require.Len(t, db.Keys(table), 20)
+	}
+}
+
+// TestTransactions runs each transaction alone, and checks the balances that it may change.
+func TestTransactions(t *testing.T) {
+	for _, tc := range []struct {
+		transaction Transaction
+		// sumChange returns true if the sum of all the balances changed as expected
+		sumChange func(before int64, after int64) bool
+	}{
+		{Balance, func(before, after int64) bool { return after == before }},
+		{DepositChecking, func(before, after int64) bool { return after > before }},
+		{TransactSavings, func(before, after int64) bool { return after != before }},
+		{Amalgamate, func(before, after int64) bool { return after == before }},
+		{WriteCheck, func(before, after int64) bool { return after < before }},
+		{SendPayment, func(before, after int64) bool { return after == before }},
+	} {
+		t.Run(string(tc.transaction), func(t *testing.T) {
+			conf := workloadtest.Config(t, 1)
+			conf.Workload.Parameters = map[string]string{"account-count": "10", "initial-balance": "1000"}
+			conf.Workload.Operations = []types.WorkloadOperation{{Operation: string(tc.transaction), Weight: 1}}
+			w, db := workloadtest.New(t, conf, New)
+			workloadtest.Warmup(t, w, 1)
+
+			sum := func() int64 {
+				var total int64
+				for _, table := range []string{checkingTable, savingsTable} {
+					for _, k := range db.Keys(table) {
+						balance, err := strconv.ParseInt(string(db.Get(table, k).GetValue()), 10, 64)
+						require.NoError(t, err)
+						total += balance
+					}
+				}
+				return total
+			}
+			before := sum()
+			workloadtest.Benchmark(t, w, 1)
+			after := sum()
+			require.True(t, tc.sumChange(before, after), "the sum of the balances changed from %d to %d", before, after)
+			workloadtest.RequireValid(t, db)
+		})
+	}
+}
+
+func TestSchemaDefaults(t *testing.T) {
+	require.Empty(t, Schema.CheckDefaults())
+}
@@ -0,0 +1,563 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package ycsb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+
+	"orion-bench/pkg/types"
+	"orion-bench/pkg/workload"
+	"orion-bench/pkg/workload/common"
+
+	"github.com/hyperledger-labs/orion-sdk-go/pkg/bcdb"
+	"github.com/hyperledger-labs/orion-server/pkg/logger"
+	"github.com/mroth/weightedrand"
+	"github.com/pkg/errors"
+)
+
+const tableName = "usertable"
+
+type Operation string
+
+const (
+	Read            Operation = "read"
+	Update          Operation = "update"
+	Insert          Operation = "insert"
+	Scan            Operation = "scan"
+	ReadModifyWrite Operation = "read-modify-write"
+)
+
+type Distribution string
+
+const (
+	Uniform Distribution = "uniform"
+	Zipfian Distribution = "zipfian"
+	Latest  Distribution = "latest"
+)
+
+// CoreWorkload is one of YCSB's core workloads.
+type CoreWorkload struct {
+	Operations   map[Operation]uint
+	Distribution Distribution
+}
+
+// CoreWorkloads are YCSB's core workloads A-F.
+var CoreWorkloads = map[string]*CoreWorkload{
+	// Update heavy
+	"a": {Operations: map[Operation]uint{Read: 50, Update: 50}, Distribution: Zipfian},
+	// Read mostly
+	"b": {Operations: map[Operation]uint{Read: 95, Update: 5}, Distribution: Zipfian},
+	// Read only
+	"c": {Operations: map[Operation]uint{Read: 100}, Distribution: Zipfian},
+	// Read latest
+	"d": {Operations: map[Operation]uint{Read: 95, Insert: 5}, Distribution: Latest},
+	// Short ranges
+	"e": {Operations: map[Operation]uint{Scan: 95, Insert: 5}, Distribution: Zipfian},
+	// Read-modify-write
+	"f": {Operations: map[Operation]uint{Read: 50, ReadModifyWrite: 50}, Distribution: Zipfian},
+}
+
+type Workload struct {
+	workload *workload.Workload
+
+	// Evaluated lazily
+	parseOnce      sync.Once
+	parseErr       error
+	core           *CoreWorkload
+	distribution   Distribution
+	recordCount    uint64
+	fieldCount     uint64
+	fieldLength    uint64
+	maxScanLength  uint64
+	insertBatch    uint64
+	commitsPerSync uint64
+	seed           int64
+	zipfian        *common.Zipfian
+	keys           *knownKeys
+}
+
+// knownKeys are the keys that are known to be in the database: the loaded records, and the records that were
+// inserted by this worker's users, in the order of their inserts.
+// The users insert strided key indices, and the inserts of the other workers are not known, so the inserted key
+// indices are not contiguous. Instead, the i-th known key is drawn, so a key is never drawn before it is inserted.
+type knownKeys struct {
+	lock        sync.RWMutex
+	recordCount uint64
+	inserted    []uint64
+}
+
+// count returns the number of known keys.
+func (k *knownKeys) count() uint64 {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	return k.recordCount + uint64(len(k.inserted))
+}
+
+// get returns the key index of the i-th known key, where i is less than the count.
+func (k *knownKeys) get(i uint64) uint64 {
+	if i < k.recordCount {
+		return i
+	}
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	return k.inserted[i-k.recordCount]
+}
+
+// add adds an inserted key index.
+func (k *knownKeys) add(keyIndex uint64) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	k.inserted = append(k.inserted, keyIndex)
+}
+
+type UserWorkload struct {
+	parent        *Workload
+	workload      *workload.Workload
+	lg            *logger.SugarLogger
+	workType      workload.WorkType
+	userIndex     uint64
+	userCount     uint64
+	userSession   bcdb.DBSession
+	rand          *rand.Rand
+	loadIndex     uint64
+	insertIndex   uint64
+	commitCounter common.CyclicCounter
+	operations    *weightedrand.Chooser
+	phases        []*weightedrand.Chooser
+}
+
+// Schema declares the workload's parameters and operations.
+var Schema = &workload.Schema{
+	Params: []*workload.Param{
+		{Name: "workload", Type: workload.StringParam, Default: "a", Choices: []string{"a", "b", "c", "d", "e", "f"},
+			Help: "The core workload"},
+		{Name: "record-count", Type: workload.IntParam, Default: "1000", Min: workload.Bound(1),
+			Help: "The number of records that are loaded in the warmup"},
+		{Name: "field-count", Type: workload.IntParam, Default: "10", Min: workload.Bound(1),
+			Help: "The number of fields in a record"},
+		{Name: "field-length", Type: workload.IntParam, Default: "100", Min: workload.Bound(0),
+			Help: "The length of each field"},
+		{Name: "request-distribution", Type: workload.StringParam,
+			Choices: []string{string(Uniform), string(Zipfian), string(Latest)},
+			Help:    "Overrides the core workload's request distribution"},
+		{Name: "expected-inserts", Type: workload.IntParam, Default: "0", Min: workload.Bound(0),
+			Help: "The number of records that each worker is expected to insert, so the zipfian and latest " +
+				"distributions also draw them (0: record-count)"},
+		{Name: "zipfian-constant", Type: workload.FloatParam,
+			Default: strconv.FormatFloat(common.ZipfianConstant, 'g', -1, 64),
+			Min:     workload.Bound(0), Max: workload.Bound(1), ExclusiveMin: true, ExclusiveMax: true,
+			Help: "The constant of the zipfian and latest distributions"},
+		{Name: "max-scan-length", Type: workload.IntParam, Default: "100", Min: workload.Bound(1),
+			Help: "Scan lengths are uniformly distributed in [1, max-scan-length]"},
+		{Name: "insert-batch", Type: workload.IntParam, Default: "100", Min: workload.Bound(1),
+			Help: "The number of records per TX in the warmup"},
+		{Name: "commits-per-sync", Type: workload.IntParam, Default: "1", Min: workload.Bound(0),
+			Help: "The number of commits before executing a synchronized commit (0: never)"},
+		{Name: "seed", Type: workload.IntParam, Default: "0",
+			Help: "The random seed of the users (plus the user index)"},
+	},
+	Operations: "Each operation is one of: read, update, insert, scan, read-modify-write.\n" +
+		"With no operations, the core workload's mix is used. The warmup loads the records regardless of the operations.\n",
+}
+
+// New creates the workload, and declares its parameters to the parent.
+func New(parent *workload.Workload) workload.Worker {
+	parent.Schema = Schema
+	return &Workload{workload: parent}
+}
+
+func (w *Workload) Init() error {
+	if err := w.workload.CreateTable(tableName); err != nil {
+		return err
+	}
+	return w.workload.AddUsers(tableName)
+}
+
+func (w *Workload) parseParameters() error {
+	name := strings.ToLower(w.workload.GetConfString("workload"))
+	core, ok := CoreWorkloads[name]
+	if !ok {
+		return errors.Errorf("unknown YCSB core workload: %s", name)
+	}
+	w.core = core
+	w.distribution = Distribution(strings.ToLower(w.workload.GetConfString("request-distribution")))
+	if w.distribution == "" {
+		w.distribution = core.Distribution
+	}
+	switch w.distribution {
+	case Uniform, Zipfian, Latest:
+	default:
+		return errors.Errorf("unknown request distribution: %s", w.distribution)
+	}
+
+	for _, p := range []struct {
+		key   string
+		value *uint64
+	}{
+		{"record-count", &w.recordCount},
+		{"field-count", &w.fieldCount},
+		{"field-length", &w.fieldLength},
+		{"max-scan-length", &w.maxScanLength},
+		{"insert-batch", &w.insertBatch},
+		{"commits-per-sync", &w.commitsPerSync},
+	} {
+		value, err := w.workload.GetConfInt(p.key)
+		if err != nil {
+			return err
+		}
+		*p.value = uint64(value)
+	}
+	seed, err := w.workload.GetConfInt("seed")
+	if err != nil {
+		return err
+	}
+	w.seed = int64(seed)
+	if w.recordCount == 0 || w.fieldCount == 0 || w.maxScanLength == 0 || w.insertBatch == 0 {
+		return errors.New("record-count, field-count, max-scan-length and insert-batch must be positive")
+	}
+	expectedInserts, err := w.workload.GetConfInt("expected-inserts")
+	if err != nil {
+		return err
+	}
+	if expectedInserts == 0 {
+		expectedInserts = int(w.recordCount)
+	}
+	zipfianConstant, err := w.workload.GetConfFloat("zipfian-constant")
+	if err != nil {
+		return err
+	}
+	// Like YCSB, the zipfian distribution covers the expected inserts, and the draws of keys that were not inserted
+	// yet are skipped (see nextKeyIndex)
+	if w.zipfian, err = common.NewZipfian(w.recordCount+uint64(expectedInserts), zipfianConstant); err != nil {
+		return err
+	}
+	w.keys = &knownKeys{recordCount: w.recordCount}
+	return nil
+}
+
+func (w *Workload) MakeWorker(userIndex uint64, workType workload.WorkType) (workload.UserWorker, error) {
+	w.parseOnce.Do(func() {
+		w.parseErr = w.parseParameters()
+	})
+	if w.parseErr != nil {
+		return nil, w.parseErr
+	}
+	userSession, err := w.workload.UserSession(userIndex)
+	if err != nil {
+		return nil, err
+	}
+	userCount := w.workload.Config.Workload.UserCount
+	userPos := float64(userIndex) / float64(userCount)
+	// We start the tx counter with an offset to prevent all users to synchronize concurrently
+	initialCommitCounter := uint64(userPos * float64(w.commitsPerSync))
+
+	worker := &UserWorkload{
+		parent:      w,
+		workload:    w.workload,
+		lg:          w.workload.Lg,
+		workType:    workType,
+		userIndex:   userIndex,
+		userCount:   userCount,
+		userSession: userSession,
+		rand:        rand.New(rand.NewSource(w.seed + int64(userIndex))),
+		loadIndex:   userIndex,
+		commitCounter: common.CyclicCounter{
+			Value: initialCommitCounter,
+			Size:  w.commitsPerSync,
+		},
+	}
+
+	for _, phase := range w.workload.Phases(workType) {
+		ops := phase.Operations
+		if workType == workload.Warmup {
+			// The warmup loads the records regardless of the operations
+			ops = nil
+		}
+		chooser, err := worker.makeOperationChooser(ops)
+		if err != nil {
+			return nil, errors.Wrapf(err, "phase %s", phase.Name)
+		}
+		worker.phases = append(worker.phases, chooser)
+	}
+	worker.SetPhase(0)
+	return worker, nil
+}
+
+func (w *UserWorkload) SetPhase(phase int) {
+	w.operations = w.phases[phase]
+}
+
+func parseOperation(operation string) (Operation, bool) {
+	op := Operation(strings.ToLower(strings.TrimSpace(operation)))
+	switch op {
+	case Read, Update, Insert, Scan, ReadModifyWrite:
+		return op, true
+	default:
+		return op, false
+	}
+}
+
+// makeOperationChooser uses the configured operations, or the core workload's mix if none are configured.
+func (w *UserWorkload) makeOperationChooser(ops []types.WorkloadOperation) (*weightedrand.Chooser, error) {
+	var choices []weightedrand.Choice
+	for _, op := range ops {
+		if op.Weight == 0 {
+			op.Weight = 1
+		}
+		parsed, ok := parseOperation(op.Operation)
+		if !ok {
+			return nil, errors.Errorf("unknown YCSB operation: %s", op.Operation)
+		}
+		choices = append(choices, weightedrand.NewChoice(parsed, op.Weight))
+	}
+	if len(choices) == 0 {
+		for op, weight := range w.parent.core.Operations {
+			choices = append(choices, weightedrand.NewChoice(op, weight))
+		}
+	}
+	return weightedrand.NewChooser(choices...)
+}
+
+// key follows YCSB's hashed insert order, so consecutive records are scattered across the key space.
+func key(keyIndex uint64) string {
+	return fmt.Sprintf("user%d", common.FNVHash64(keyIndex))
+}
+
+// nextKeyIndex draws one of the known keys according to the request distribution.
+// The zipfian draws of keys that are not known yet are redrawn.
+func (w *UserWorkload) nextKeyIndex() uint64 {
+	keys := w.parent.keys
+	count := keys.count()
+	switch w.parent.distribution {
+	case Uniform:
+		return keys.get(uint64(w.rand.Int63n(int64(count))))
+	case Latest:
+		// Other workers' inserts are not tracked, so this is an approximation of the latest keys in the cluster
+		for {
+			if offset := w.parent.zipfian.Next(w.rand); offset < count {
+				return keys.get(count - 1 - offset)
+			}
+		}
+	default:
+		for {
+			if i := w.parent.zipfian.NextScrambled(w.rand); i < count {
+				return keys.get(i)
+			}
+		}
+	}
+}
+
+// nextInsertIndex returns a key index that is unique to the user, so users never insert the same key.
+func (w *UserWorkload) nextInsertIndex() uint64 {
+	keyIndex := w.parent.recordCount + w.insertIndex*w.userCount + w.userIndex
+	w.insertIndex++
+	return keyIndex
+}
+
+func (w *UserWorkload) nextScanLength() uint64 {
+	return uint64(w.rand.Int63n(int64(w.parent.maxScanLength))) + 1
+}
+
+const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+func (w *UserWorkload) record() ([]byte, error) {
+	fields := make(map[string]string, w.parent.fieldCount)
+	for i := uint64(0); i < w.parent.fieldCount; i++ {
+		value := make([]byte, w.parent.fieldLength)
+		for j := range value {
+			value[j] = letters[w.rand.Intn(len(letters))]
+		}
+		fields[fmt.Sprintf("field%d", i)] = string(value)
+	}
+	return json.Marshal(fields)
+}
+
+func (w *UserWorkload) read(tx bcdb.DataTxContext, keyIndex uint64) error {
+	return w.workload.Stats.TimeOperation(common.Read, func() (uint64, error) {
+		_, _, err := tx.Get(tableName, key(keyIndex))
+		return 1, err
+	})
+}
+
+// write always writes all the fields, since Orion replaces the entire value of a key.
+func (w *UserWorkload) write(tx bcdb.DataTxContext, keyIndex uint64) (uint64, error) {
+	rawRecord, err := w.record()
+	if err != nil {
+		return 0, err
+	}
+	k := key(keyIndex)
+	err = w.workload.Stats.TimeOperation(common.Write, func() (uint64, error) {
+		return 1, tx.Put(tableName, k, rawRecord, nil)
+	})
+	return uint64(len(k) + len(rawRecord)), err
+}
+
+func (w *UserWorkload) needSync() bool {
+	return w.commitCounter.Size > 0 && w.commitCounter.Value == 0
+}
+
+func (w *UserWorkload) commit(tx bcdb.DataTxContext, sync bool, size uint64) error {
+	w.commitCounter.Inc(1)
+	err := w.workload.Stats.TimeOperation(common.GetCommitOp(sync), func() (uint64, error) {
+		return 1, w.workload.CommitSync(tx, sync)
+	})
+	w.workload.Stats.ObserveContentSize(size, err)
+	return err
+}
+
+func (w *UserWorkload) readOnly() error {
+	tx, err := w.userSession.DataTx()
+	if err != nil {
+		return err
+	}
+	defer w.workload.AbortTx(tx)
+	return w.read(tx, w.nextKeyIndex())
+}
+
+func (w *UserWorkload) writeOnly(keyIndex uint64) error {
+	tx, err := w.userSession.DataTx()
+	if err != nil {
+		return err
+	}
+	defer w.workload.AbortTx(tx)
+	size, err := w.write(tx, keyIndex)
+	if err != nil {
+		return err
+	}
+	return w.commit(tx, w.needSync(), size)
+}
+
+func (w *UserWorkload) insert() error {
+	keyIndex := w.nextInsertIndex()
+	if err := w.writeOnly(keyIndex); err != nil {
+		return err
+	}
+	w.parent.keys.add(keyIndex)
+	return nil
+}
+
+func (w *UserWorkload) readModifyWrite() error {
+	tx, err := w.userSession.DataTx()
+	if err != nil {
+		return err
+	}
+	defer w.workload.AbortTx(tx)
+	keyIndex := w.nextKeyIndex()
+	if err := w.read(tx, keyIndex); err != nil {
+		return err
+	}
+	size, err := w.write(tx, keyIndex)
+	if err != nil {
+		return err
+	}
+	return w.commit(tx, w.needSync(), size)
+}
+
+func (w *UserWorkload) scan() error {
+	tx, err := w.userSession.Query()
+	if err != nil {
+		return err
+	}
+
+	startKey := key(w.nextKeyIndex())
+	length := w.nextScanLength()
+	return w.workload.Stats.TimeOperation(common.Query, func() (uint64, error) {
+		it, err := tx.GetDataByRange(tableName, startKey, "", length)
+		if err != nil {
+			return 0, err
+		}
+		more := it != nil
+		var count uint64 = 0
+		for more {
+			_, more, err = it.Next()
+			if err != nil {
+				break
+			}
+			count += 1
+		}
+
+		return count, err
+	})
+}
+
+// load inserts the next batch of the user's share of the records in a single TX.
+// The last batch is always committed synchronously.
+func (w *UserWorkload) load() (workload.WorkStatus, error) {
+	if w.loadIndex >= w.parent.recordCount {
+		return workload.Enough, nil
+	}
+
+	tx, err := w.userSession.DataTx()
+	if err != nil {
+		return workload.NeedBackoff, err
+	}
+	defer w.workload.AbortTx(tx)
+	keyIndex := w.loadIndex
+	var size uint64 = 0
+	for i := uint64(0); i < w.parent.insertBatch && keyIndex < w.parent.recordCount; i++ {
+		s, err := w.write(tx, keyIndex)
+		if err != nil {
+			return workload.NeedBackoff, errors.WithMessagef(err, "failed to load key '%s'", key(keyIndex))
+		}
+		size += s
+		keyIndex += w.userCount
+	}
+
+	lastBatch := keyIndex >= w.parent.recordCount
+	if err = w.commit(tx, lastBatch || w.needSync(), size); err != nil {
+		return workload.NeedBackoff, errors.WithMessage(err, "failed to load batch")
+	}
+	w.loadIndex = keyIndex
+	if lastBatch {
+		return workload.Enough, nil
+	}
+	return workload.Ok, nil
+}
+
+func (w *UserWorkload) Work(ctx context.Context) (workload.WorkStatus, error) {
+	if w.workType == workload.Warmup {
+		status, err := w.load()
+		if err != nil && ctx.Err() != nil {
+			w.lg.Debugf("Load failed after the work was stopped: %s", err)
+			return workload.Enough, nil
+		}
+		if err != nil {
+			w.lg.Debugf("Load failed: %s", err)
+		}
+		return status, err
+	}
+
+	op := w.operations.Pick().(Operation)
+	var err error
+	switch op {
+	case Read:
+		err = w.readOnly()
+	case Update:
+		err = w.writeOnly(w.nextKeyIndex())
+	case Insert:
+		err = w.insert()
+	case Scan:
+		err = w.scan()
+	case ReadModifyWrite:
+		err = w.readModifyWrite()
+	}
+
+	switch {
+	case err == nil:
+		return workload.Ok, nil
+	case ctx.Err() != nil:
+		// The work was stopped while the operation was in-flight
+		w.lg.Debugf("Op '%s' failed after the work was stopped: %s", op, err)
+		return workload.Enough, nil
+	default:
+		// A sample of the failures is logged by the client stats
+		w.lg.Debugf("Op '%s' failed: %s", op, err)
+		return workload.NeedBackoff, errors.WithMessagef(err, "op '%s'", op)
+	}
+}
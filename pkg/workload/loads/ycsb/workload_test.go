@@ -0,0 +1,78 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package ycsb
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"orion-bench/pkg/workload/common"
+	"orion-bench/pkg/workload/workloadtest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkload(t *testing.T) {
+	var names []string
+	for name := range CoreWorkloads {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			conf := workloadtest.Config(t, 2)
+			conf.Workload.Parameters = map[string]string{
+				"workload":        name,
+				"record-count":    "100",
+				"field-count":     "2",
+				"field-length":    "8",
+				"max-scan-length": "10",
+				"insert-batch":    "10",
+			}
+			w, db := workloadtest.New(t, conf, New)
+
+			// Each user loads half of the records, in batches of 10
+			workloadtest.Warmup(t, w, 5)
+			require.Len(t, db.Keys(tableName), 100)
+
+			workloadtest.Benchmark(t, w, 50)
+			require.GreaterOrEqual(t, len(db.Keys(tableName)), 100)
+			workloadtest.RequireValid(t, db)
+		})
+	}
+}
+
+// TestNextKeyIndex checks that only the loaded and the inserted keys are drawn, and that the inserted keys are drawn.
+func TestNextKeyIndex(t *testing.T) {
+	for _, distribution := range []Distribution{Uniform, Zipfian, Latest} {
+		t.Run(string(distribution), func(t *testing.T) {
+			zipfian, err := common.NewZipfian(20, common.ZipfianConstant)
+			require.NoError(t, err)
+			parent := &Workload{distribution: distribution, zipfian: zipfian, keys: &knownKeys{recordCount: 10}}
+			w := &UserWorkload{parent: parent, rand: rand.New(rand.NewSource(0))}
+
+			// Another worker's users inserted the indices in between
+			inserted := map[uint64]bool{11: true, 13: true, 15: true}
+			for i := uint64(0); i < 10; i++ {
+				inserted[i] = true
+			}
+			for _, keyIndex := range []uint64{11, 13, 15} {
+				parent.keys.add(keyIndex)
+			}
+
+			drawn := map[uint64]bool{}
+			for i := 0; i < 10000; i++ {
+				keyIndex := w.nextKeyIndex()
+				require.True(t, inserted[keyIndex], "key %d was not inserted", keyIndex)
+				drawn[keyIndex] = true
+			}
+			require.True(t, drawn[11] || drawn[13] || drawn[15], "the inserted keys are not drawn")
+		})
+	}
+}
+
+func TestSchemaDefaults(t *testing.T) {
+	require.Empty(t, Schema.CheckDefaults())
+}
@@ -0,0 +1,210 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package workload
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+)
+
+// ParamType is the type of a workload parameter's value.
+type ParamType string
+
+const (
+	IntParam    ParamType = "int"
+	FloatParam  ParamType = "float"
+	BoolParam   ParamType = "bool"
+	StringParam ParamType = "string"
+)
+
+// Param declares a workload parameter.
+// A numeric parameter must be in [Min, Max], where a nil bound means unbounded, and an exclusive bound is not
+// in the range, e.g., (Min, Max).
+// A string parameter with choices must be one of them (case-insensitive).
+type Param struct {
+	Name         string
+	Type         ParamType
+	Default      string
+	Min          *float64
+	Max          *float64
+	ExclusiveMin bool
+	ExclusiveMax bool
+	Choices      []string
+	Help         string
+}
+
+// Bound returns a numeric parameter's bound.
+func Bound(value float64) *float64 {
+	return &value
+}
+
+// Schema describes the parameters of a workload and the operations it accepts.
+type Schema struct {
+	Params []*Param
+	// Operations describes the format of the workload's operations in the config file
+	Operations string
+}
+
+// ParamError is a parameter that failed the validation.
+type ParamError struct {
+	Name string
+	Err  error
+}
+
+func (e *ParamError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Name, e.Err)
+}
+
+// Param returns the declared parameter, or nil if it is not declared.
+func (s *Schema) Param(name string) *Param {
+	if s == nil {
+		return nil
+	}
+	for _, p := range s.Params {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// Validate checks the configured parameters against the schema, and returns all the unknown and invalid parameters.
+func (s *Schema) Validate(params map[string]string) []*ParamError {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []*ParamError
+	for _, name := range names {
+		p := s.Param(name)
+		if p == nil {
+			errs = append(errs, &ParamError{Name: name, Err: errors.New("unknown parameter")})
+			continue
+		}
+		if err := p.Check(params[name]); err != nil {
+			errs = append(errs, &ParamError{Name: name, Err: err})
+		}
+	}
+	return errs
+}
+
+// CheckDefaults returns all the parameters whose default is not of their type, or is out of their range or choices.
+// An empty default of a string parameter means that it is not set, e.g., to use a value that depends on another
+// parameter, so it is valid.
+func (s *Schema) CheckDefaults() []*ParamError {
+	var errs []*ParamError
+	for _, p := range s.Params {
+		if p.Type == StringParam && p.Default == "" {
+			continue
+		}
+		if err := p.Check(p.Default); err != nil {
+			errs = append(errs, &ParamError{Name: p.Name, Err: errors.WithMessage(err, "invalid default")})
+		}
+	}
+	return errs
+}
+
+// Check returns an error if the value is not of the parameter's type, or is out of its range or choices.
+func (p *Param) Check(value string) error {
+	var number float64
+	var err error
+	switch p.Type {
+	case IntParam:
+		var intValue int
+		intValue, err = strconv.Atoi(value)
+		number = float64(intValue)
+	case FloatParam:
+		number, err = strconv.ParseFloat(value, 64)
+	case BoolParam:
+		_, err = strconv.ParseBool(value)
+		return errors.Wrapf(err, "invalid %s", p.Type)
+	default:
+		if len(p.Choices) == 0 {
+			return nil
+		}
+		for _, choice := range p.Choices {
+			if strings.EqualFold(value, choice) {
+				return nil
+			}
+		}
+		return errors.Errorf("'%s' is not one of: %s", value, strings.Join(p.Choices, ", "))
+	}
+	if err != nil {
+		return errors.Wrapf(err, "invalid %s", p.Type)
+	}
+	if !p.inRange(number) {
+		return errors.Errorf("%s is out of range %s", value, p.Range())
+	}
+	return nil
+}
+
+func (p *Param) inRange(number float64) bool {
+	if p.Min != nil && (number < *p.Min || (p.ExclusiveMin && number == *p.Min)) {
+		return false
+	}
+	if p.Max != nil && (number > *p.Max || (p.ExclusiveMax && number == *p.Max)) {
+		return false
+	}
+	return true
+}
+
+func formatBound(bound *float64, unbounded float64) string {
+	if bound == nil {
+		return strconv.FormatFloat(unbounded, 'g', -1, 64)
+	}
+	return strconv.FormatFloat(*bound, 'g', -1, 64)
+}
+
+// Range describes the valid values of the parameter, e.g., "[0, +Inf]", "(0, 1)" or "a|b|c".
+func (p *Param) Range() string {
+	switch p.Type {
+	case IntParam, FloatParam:
+		if p.Min == nil && p.Max == nil {
+			return ""
+		}
+		open, closing := "[", "]"
+		if p.ExclusiveMin {
+			open = "("
+		}
+		if p.ExclusiveMax {
+			closing = ")"
+		}
+		return fmt.Sprintf("%s%s, %s%s",
+			open, formatBound(p.Min, math.Inf(-1)), formatBound(p.Max, math.Inf(1)), closing)
+	case StringParam:
+		return strings.Join(p.Choices, "|")
+	default:
+		return ""
+	}
+}
+
+// Text describes the workload's parameters and operations as a human-readable text.
+func (s *Schema) Text(name string) string {
+	buf := &bytes.Buffer{}
+	_, _ = fmt.Fprintf(buf, "Workload: %s\n\nParameters:\n", name)
+	if len(s.Params) == 0 {
+		_, _ = fmt.Fprintln(buf, "  none")
+	} else {
+		w := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "  Name\tType\tDefault\tRange\tDescription\t")
+		for _, p := range s.Params {
+			_, _ = fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\t\n", p.Name, p.Type, p.Default, p.Range(), p.Help)
+		}
+		_ = w.Flush()
+	}
+
+	_, _ = fmt.Fprintf(buf, "\nOperations:\n")
+	for _, line := range strings.Split(strings.TrimRight(s.Operations, "\n"), "\n") {
+		_, _ = fmt.Fprintf(buf, "  %s\n", line)
+	}
+	return buf.String()
+}
@@ -0,0 +1,56 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package workload
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckDefaults(t *testing.T) {
+	s := &Schema{Params: []*Param{
+		{Name: "count", Type: IntParam, Default: "10", Min: Bound(1)},
+		{Name: "below-min", Type: IntParam, Default: "0", Min: Bound(1)},
+		{Name: "above-max", Type: FloatParam, Default: "1.5", Min: Bound(0), Max: Bound(1)},
+		{Name: "in-open-range", Type: FloatParam, Default: "0.99",
+			Min: Bound(0), Max: Bound(1), ExclusiveMin: true, ExclusiveMax: true},
+		{Name: "on-exclusive-max", Type: FloatParam, Default: "1", Min: Bound(0), Max: Bound(1), ExclusiveMax: true},
+		{Name: "on-exclusive-min", Type: IntParam, Default: "0", Min: Bound(0), ExclusiveMin: true},
+		{Name: "not-int", Type: IntParam, Default: "1.5"},
+		{Name: "no-default", Type: IntParam},
+		{Name: "enabled", Type: BoolParam, Default: "true"},
+		{Name: "mode", Type: StringParam, Default: "B", Choices: []string{"a", "b"}},
+		{Name: "unset-mode", Type: StringParam, Choices: []string{"a", "b"}},
+		{Name: "bad-mode", Type: StringParam, Default: "c", Choices: []string{"a", "b"}},
+	}}
+
+	var names []string
+	for _, e := range s.CheckDefaults() {
+		names = append(names, e.Name)
+	}
+	require.Equal(t, []string{
+		"below-min", "above-max", "on-exclusive-max", "on-exclusive-min", "not-int", "no-default", "bad-mode",
+	}, names)
+}
+
+func TestParamRange(t *testing.T) {
+	for _, tc := range []struct {
+		param *Param
+		want  string
+	}{
+		{&Param{Type: IntParam, Min: Bound(1)}, "[1, +Inf]"},
+		{&Param{Type: FloatParam, Min: Bound(0), Max: Bound(1), ExclusiveMin: true, ExclusiveMax: true}, "(0, 1)"},
+		{&Param{Type: FloatParam, Max: Bound(1), ExclusiveMax: true}, "[-Inf, 1)"},
+		{&Param{Type: IntParam}, ""},
+		{&Param{Type: StringParam, Choices: []string{"a", "b"}}, "a|b"},
+	} {
+		require.Equal(t, tc.want, tc.param.Range())
+	}
+
+	p := &Param{Name: "zipfian-constant", Type: FloatParam, Min: Bound(0), Max: Bound(1), ExclusiveMin: true,
+		ExclusiveMax: true}
+	require.EqualError(t, p.Check("1"), "1 is out of range (0, 1)")
+	require.EqualError(t, p.Check("0"), "0 is out of range (0, 1)")
+	require.NoError(t, p.Check("0.5"))
+}
@@ -0,0 +1,226 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package workload
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"orion-bench/pkg/types"
+
+	"github.com/pkg/errors"
+)
+
+// rampPoll is the interval in which an inactive user checks if it became active during a ramp phase.
+const rampPoll = 10 * time.Millisecond
+
+// Phase is a single phase of a workload run.
+type Phase struct {
+	Index     int
+	Conf      *types.PhaseConf
+	Start     time.Time
+	End       time.Time
+	rate      float64
+	fromUsers float64
+	fromRate  float64
+	schedule  *ArrivalSchedule
+}
+
+// Phases returns the phases configuration of the work type.
+// If no phases are configured, a single phase is created from the work type's duration, rate and operations.
+// Phases with no operations inherit the work type's operations.
+func (w *Workload) Phases(workType WorkType) []types.PhaseConf {
+	conf := &w.Config.Workload
+	var phases []types.PhaseConf
+	var operations []types.WorkloadOperation
+	switch workType {
+	case Warmup:
+		phases, operations = conf.WarmupPhases, conf.WarmupOperations
+		if len(phases) == 0 {
+			phases = []types.PhaseConf{{
+				Name: string(Warmup), Duration: conf.WarmupDuration, Users: 1, Rate: conf.WarmupRate,
+			}}
+		}
+	case Saturation:
+		phases, operations = w.saturationSteps(), conf.Operations
+	case Benchmark:
+		fallthrough
+	default:
+		phases, operations = conf.Phases, conf.Operations
+		if len(phases) == 0 {
+			phases = []types.PhaseConf{{
+				Name: string(Benchmark), Duration: conf.Duration, Users: 1, Rate: conf.Rate,
+			}}
+		}
+	}
+
+	ret := make([]types.PhaseConf, len(phases))
+	for i, p := range phases {
+		if p.Name == "" {
+			p.Name = fmt.Sprintf("%s-%d", workType, i)
+		}
+		if len(p.Operations) == 0 {
+			p.Operations = operations
+		}
+		ret[i] = p
+	}
+	return ret
+}
+
+// CheckPhases validates the phases configuration of the work type.
+func (w *Workload) CheckPhases(workType WorkType) error {
+	if workType == Saturation {
+		if err := w.checkSaturation(); err != nil {
+			return err
+		}
+	}
+	for _, p := range w.Phases(workType) {
+		if p.Users < 0 || p.Users > 1 {
+			return errors.Errorf("phase %s: users fraction must be between 0 and 1 (%f)", p.Name, p.Users)
+		}
+		if p.Rate.Target <= 0 {
+			continue
+		}
+		if err := checkRate(&p.Rate); err != nil {
+			return errors.Wrapf(err, "phase %s", p.Name)
+		}
+	}
+	return nil
+}
+
+// makePhases creates the phases of the work type for a worker with the given number of users.
+// The phases' time is set when the work starts (see startPhases).
+func (w *Workload) makePhases(workType WorkType, workerUsers int) []*Phase {
+	confs := w.Phases(workType)
+	phases := make([]*Phase, len(confs))
+	var prevUsers, prevRate float64
+	for i := range confs {
+		p := &Phase{Index: i, Conf: &confs[i], fromUsers: confs[i].Users}
+		if p.Conf.Rate.Target > 0 {
+			p.rate = w.WorkerRate(&p.Conf.Rate, workerUsers)
+			p.fromRate = p.rate
+			p.schedule = w.NewArrivalSchedule(&p.Conf.Rate)
+		}
+		if p.Conf.Ramp {
+			p.fromUsers = prevUsers
+			if p.rate > 0 {
+				p.fromRate = prevRate
+			}
+		}
+		prevUsers, prevRate = p.Conf.Users, p.rate
+		phases[i] = p
+	}
+	return phases
+}
+
+// startPhases sets the phases' time according to the start time, and returns the end time of the last phase.
+func startPhases(phases []*Phase, start time.Time) time.Time {
+	for _, p := range phases {
+		p.Start = start
+		p.End = start.Add(p.Conf.Duration)
+		start = p.End
+	}
+	return start
+}
+
+func (p *Phase) progress(t time.Time) float64 {
+	if !p.Conf.Ramp || p.Conf.Duration <= 0 {
+		return 1
+	}
+	return math.Min(1, math.Max(0, float64(t.Sub(p.Start))/float64(p.Conf.Duration)))
+}
+
+// Users returns the fraction of active users at a given time.
+func (p *Phase) Users(t time.Time) float64 {
+	return p.fromUsers + (p.Conf.Users-p.fromUsers)*p.progress(t)
+}
+
+// Rate returns the worker's target rate (operations per second) at a given time.
+func (p *Phase) Rate(t time.Time) float64 {
+	return p.fromRate + (p.rate-p.fromRate)*p.progress(t)
+}
+
+// OpenLoop returns true if the phase's operations are dispatched on schedule.
+func (p *Phase) OpenLoop() bool {
+	return p.rate > 0
+}
+
+// IsActive returns true if the user in the given position (out of count users) should work at a given time.
+func (p *Phase) IsActive(position int, count int, t time.Time) bool {
+	return position < int(math.Ceil(p.Users(t)*float64(count)))
+}
+
+// phaseAt returns the phase that is active at a given time, or nil if all the phases ended.
+func (w *Workload) phaseAt(t time.Time) *Phase {
+	select {
+	case <-w.ctx.Done():
+		return nil
+	default:
+	}
+	for _, p := range w.phases {
+		if t.Before(p.End) {
+			return p
+		}
+	}
+	return nil
+}
+
+// sleepUntil returns false if stopped before the given time.
+func sleepUntil(t time.Time, stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return false
+	case <-time.After(time.Until(t)):
+		return true
+	}
+}
+
+// PhaseEndFunc is called at the end of each phase, and returns whether the work should proceed to the next phase.
+type PhaseEndFunc func(p *Phase) (bool, error)
+
+// runPhases reports the current phase, and dispatches the operations of open-loop phases.
+// If onPhaseEnd is not nil, it is called at the end of each phase. If it returns false or fails, the work is stopped.
+func (w *Workload) runPhases(onPhaseEnd PhaseEndFunc) error {
+	for _, p := range w.phases {
+		w.Lg.Infof("Phase %s started (duration: %s).", p.Conf.Name, p.Conf.Duration)
+		w.Stats.SetPhase(p.Conf.Name)
+		if p.OpenLoop() {
+			w.Lg.Infof("Open-loop phase: %.2f TX/s (arrival: %s).", p.rate, p.Conf.Rate.Arrival)
+			w.dispatchArrivals(p, w.ctx.Done())
+		}
+		if !sleepUntil(p.End, w.ctx.Done()) {
+			return nil
+		}
+		if onPhaseEnd == nil {
+			continue
+		}
+		if proceed, err := onPhaseEnd(p); err != nil || !proceed {
+			w.Stop()
+			return err
+		}
+	}
+	return nil
+}
+
+// dispatchArrivals sends the scheduled start time of each operation to an idle user.
+// If all the users are busy, the operation is dropped.
+func (w *Workload) dispatchArrivals(p *Phase, stop <-chan struct{}) {
+	maxRate := math.Max(p.fromRate, p.rate)
+	scheduled := p.Start
+	for {
+		scheduled = scheduled.Add(p.schedule.Next(maxRate))
+		if !scheduled.Before(p.End) || !sleepUntil(scheduled, stop) {
+			return
+		}
+		if !p.schedule.Accept(p.Rate(scheduled) / maxRate) {
+			continue
+		}
+
+		select {
+		case w.arrivals <- scheduled:
+		default:
+			w.Stats.ObserveDropped()
+		}
+	}
+}
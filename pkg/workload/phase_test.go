@@ -0,0 +1,232 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package workload
+
+import (
+	"testing"
+	"time"
+
+	"orion-bench/pkg/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	readOps  = []types.WorkloadOperation{{Operation: "read", Weight: 1}}
+	writeOps = []types.WorkloadOperation{{Operation: "write", Weight: 1}}
+)
+
+// newPhasesWorkload returns a workload of 10 users with the given phases.
+func newPhasesWorkload(phases ...types.PhaseConf) *Workload {
+	w := newRateWorkload(0, 10)
+	w.Config.Workload.Operations = readOps
+	w.Config.Workload.Phases = phases
+	return w
+}
+
+func TestPhasesDefaults(t *testing.T) {
+	w := newRateWorkload(0, 10)
+	conf := &w.Config.Workload
+	conf.Duration = time.Minute
+	conf.Rate = types.RateConf{Target: 100}
+	conf.Operations = readOps
+	conf.WarmupDuration = time.Second
+	conf.WarmupOperations = writeOps
+
+	// Without phases, a single phase is created from the work type's configuration
+	require.Equal(t, []types.PhaseConf{{
+		Name: "benchmark", Duration: time.Minute, Users: 1, Rate: types.RateConf{Target: 100}, Operations: readOps,
+	}}, w.Phases(Benchmark))
+	require.Equal(t, []types.PhaseConf{{
+		Name: "warmup", Duration: time.Second, Users: 1, Operations: writeOps,
+	}}, w.Phases(Warmup))
+
+	// The configured phases are named by their index, and inherit the work type's operations
+	conf.Phases = []types.PhaseConf{
+		{Duration: time.Second, Users: 0.5},
+		{Name: "writes", Duration: time.Second, Users: 1, Operations: writeOps},
+	}
+	require.Equal(t, []types.PhaseConf{
+		{Name: "benchmark-0", Duration: time.Second, Users: 0.5, Operations: readOps},
+		{Name: "writes", Duration: time.Second, Users: 1, Operations: writeOps},
+	}, w.Phases(Benchmark))
+	require.Empty(t, conf.Phases[0].Name, "the configuration is not modified")
+}
+
+func TestCheckPhases(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		phase types.PhaseConf
+		err   string
+	}{
+		{name: "valid", phase: types.PhaseConf{Users: 0.5, Rate: types.RateConf{
+			Target: 10, Scope: types.ClusterRate, Arrival: types.PoissonArrival,
+		}}},
+		{name: "no users", phase: types.PhaseConf{Users: 0}},
+		// The rate is only checked for open-loop phases
+		{name: "closed loop", phase: types.PhaseConf{Users: 1, Rate: types.RateConf{Arrival: "burst"}}},
+		{
+			name:  "too many users",
+			phase: types.PhaseConf{Users: 1.5},
+			err:   "phase benchmark-0: users fraction must be between 0 and 1 (1.500000)",
+		},
+		{
+			name:  "negative users",
+			phase: types.PhaseConf{Users: -0.5},
+			err:   "phase benchmark-0: users fraction must be between 0 and 1 (-0.500000)",
+		},
+		{
+			name: "invalid arrival",
+			phase: types.PhaseConf{Users: 1, Rate: types.RateConf{
+				Target: 10, Scope: types.WorkerRate, Arrival: "burst",
+			}},
+			err: "phase benchmark-0: invalid arrival type: burst",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := newPhasesWorkload(tc.phase).CheckPhases(Benchmark)
+			if tc.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tc.err)
+			}
+		})
+	}
+}
+
+func TestPhasesRamp(t *testing.T) {
+	rate := func(target float64) types.RateConf {
+		return types.RateConf{Target: target, Scope: types.ClusterRate, Arrival: types.ConstantArrival}
+	}
+	w := newPhasesWorkload(
+		types.PhaseConf{Name: "steady", Duration: time.Minute, Users: 0.5, Rate: rate(100)},
+		types.PhaseConf{Name: "ramp-up", Duration: 2 * time.Minute, Users: 1, Ramp: true, Rate: rate(200)},
+		types.PhaseConf{Name: "closed-loop", Duration: time.Minute, Users: 0.2},
+		types.PhaseConf{Name: "ramp-open", Duration: time.Minute, Users: 0.6, Ramp: true, Rate: rate(50)},
+	)
+	// This worker has half of the users, so it gets half of the cluster's rate
+	phases := w.makePhases(Benchmark, 5)
+	require.Len(t, phases, 4)
+
+	start := time.Now()
+	end := startPhases(phases, start)
+	require.Equal(t, start.Add(5*time.Minute), end)
+	for i, p := range phases {
+		require.Equal(t, i, p.Index)
+		if i > 0 {
+			require.Equal(t, phases[i-1].End, p.Start)
+		}
+		require.Equal(t, p.Start.Add(p.Conf.Duration), p.End)
+	}
+
+	// A phase without a ramp is steady throughout
+	steady := phases[0]
+	require.True(t, steady.OpenLoop())
+	for _, at := range []time.Duration{-time.Second, 0, 30 * time.Second, time.Minute} {
+		require.Equal(t, 0.5, steady.Users(steady.Start.Add(at)))
+		require.Equal(t, 50., steady.Rate(steady.Start.Add(at)))
+	}
+
+	// A ramp changes the users and the rate linearly from the previous phase's values
+	rampUp := phases[1]
+	for _, tc := range []struct {
+		at    time.Duration
+		users float64
+		rate  float64
+	}{
+		{at: -time.Minute, users: 0.5, rate: 50},
+		{at: 0, users: 0.5, rate: 50},
+		{at: 30 * time.Second, users: 0.625, rate: 62.5},
+		{at: time.Minute, users: 0.75, rate: 75},
+		{at: 2 * time.Minute, users: 1, rate: 100},
+		{at: 3 * time.Minute, users: 1, rate: 100},
+	} {
+		require.InDelta(t, tc.users, rampUp.Users(rampUp.Start.Add(tc.at)), 1e-9, tc.at)
+		require.InDelta(t, tc.rate, rampUp.Rate(rampUp.Start.Add(tc.at)), 1e-9, tc.at)
+	}
+
+	// A closed-loop phase has no rate
+	closedLoop := phases[2]
+	require.False(t, closedLoop.OpenLoop())
+	require.Nil(t, closedLoop.schedule)
+	require.Zero(t, closedLoop.Rate(closedLoop.Start))
+
+	// A ramp after a closed-loop phase starts from no rate
+	rampOpen := phases[3]
+	require.True(t, rampOpen.OpenLoop())
+	mid := rampOpen.Start.Add(30 * time.Second)
+	require.InDelta(t, 0.4, rampOpen.Users(mid), 1e-9)
+	require.InDelta(t, 12.5, rampOpen.Rate(mid), 1e-9)
+	require.InDelta(t, 25, rampOpen.Rate(rampOpen.End), 1e-9)
+}
+
+func TestPhaseIsActive(t *testing.T) {
+	w := newPhasesWorkload(
+		types.PhaseConf{Duration: time.Minute, Users: 0.25},
+		types.PhaseConf{Duration: time.Minute, Users: 1, Ramp: true},
+		types.PhaseConf{Duration: time.Minute, Users: 0},
+	)
+	phases := w.makePhases(Benchmark, 10)
+	startPhases(phases, time.Now())
+	active := func(p *Phase, at time.Duration) int {
+		count := 0
+		for i := 0; i < 10; i++ {
+			if p.IsActive(i, 10, p.Start.Add(at)) {
+				require.Equal(t, i, count, "the active users are the first in order")
+				count++
+			}
+		}
+		return count
+	}
+
+	// The number of active users is rounded up
+	require.Equal(t, 3, active(phases[0], 0))
+	require.Equal(t, 3, active(phases[0], time.Minute))
+	require.Equal(t, 3, active(phases[1], 0))
+	require.Equal(t, 4, active(phases[1], 6*time.Second))
+	require.Equal(t, 7, active(phases[1], 30*time.Second))
+	require.Equal(t, 10, active(phases[1], time.Minute))
+	require.Equal(t, 0, active(phases[2], 0))
+}
+
+func TestDispatchArrivals(t *testing.T) {
+	w := newPhasesWorkload(types.PhaseConf{
+		Duration: 200 * time.Millisecond, Users: 1, Ramp: true,
+		Rate: types.RateConf{Target: 1000, Scope: types.WorkerRate, Arrival: types.ConstantArrival},
+	})
+	w.arrivals = make(chan time.Time, 1000)
+	p := w.makePhases(Benchmark, 10)[0]
+	startPhases([]*Phase{p}, time.Now())
+	w.dispatchArrivals(p, make(chan struct{}))
+	close(w.arrivals)
+
+	// The rate ramps from 0 to 1000/s: the arrivals are scheduled each 1ms, and the k-th is thinned to a fraction
+	// of k/200, so half of them are dispatched, increasingly denser towards the end of the phase
+	var arrivals []time.Time
+	for a := range w.arrivals {
+		arrivals = append(arrivals, a)
+	}
+	require.Len(t, arrivals, 99)
+	require.False(t, time.Now().Before(arrivals[len(arrivals)-1]), "the arrivals are dispatched on schedule")
+	for i, a := range arrivals {
+		require.True(t, a.After(p.Start) && a.Before(p.End))
+		if i > 0 {
+			require.True(t, a.After(arrivals[i-1]))
+		}
+	}
+	firstHalf := 0
+	for _, a := range arrivals {
+		if a.Before(p.Start.Add(100 * time.Millisecond)) {
+			firstHalf++
+		}
+	}
+	require.InDelta(t, 25, firstHalf, 1)
+
+	// A stopped dispatch returns immediately
+	stop := make(chan struct{})
+	close(stop)
+	w.arrivals = make(chan time.Time, 1000)
+	startPhases([]*Phase{p}, time.Now())
+	w.dispatchArrivals(p, stop)
+	require.Empty(t, w.arrivals)
+}
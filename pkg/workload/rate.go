@@ -0,0 +1,78 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package workload
+
+import (
+	"math/rand"
+	"time"
+
+	"orion-bench/pkg/types"
+
+	"github.com/pkg/errors"
+)
+
+// ArrivalSchedule draws the inter-arrival times of an open-loop workload.
+type ArrivalSchedule struct {
+	arrival types.ArrivalType
+	rand    *rand.Rand
+	credit  float64
+}
+
+func checkRate(conf *types.RateConf) error {
+	switch conf.Arrival {
+	case types.ConstantArrival, types.PoissonArrival:
+	default:
+		return errors.Errorf("invalid arrival type: %s", conf.Arrival)
+	}
+	switch conf.Scope {
+	case types.WorkerRate, types.ClusterRate:
+	default:
+		return errors.Errorf("invalid rate scope: %s", conf.Scope)
+	}
+	return nil
+}
+
+// NewArrivalSchedule creates a schedule with the configured arrival type (see checkRate).
+// The random source is seeded with the configured seed and the worker rank to keep runs reproducible.
+func (w *Workload) NewArrivalSchedule(conf *types.RateConf) *ArrivalSchedule {
+	return &ArrivalSchedule{
+		arrival: conf.Arrival,
+		rand:    rand.New(rand.NewSource(conf.Seed + int64(w.WorkerRank))),
+	}
+}
+
+// Next returns the time until the next arrival for the given rate (operations per second).
+func (s *ArrivalSchedule) Next(rate float64) time.Duration {
+	interval := float64(time.Second) / rate
+	if s.arrival == types.PoissonArrival {
+		return time.Duration(s.rand.ExpFloat64() * interval)
+	}
+	return time.Duration(interval)
+}
+
+// Accept thins the arrivals such that only the given fraction of them is accepted.
+// It is used to follow a changing rate: poisson arrivals are thinned randomly, and constant arrivals are
+// thinned deterministically to keep them evenly spaced.
+func (s *ArrivalSchedule) Accept(fraction float64) bool {
+	if fraction >= 1 {
+		return true
+	}
+	if s.arrival == types.PoissonArrival {
+		return s.rand.Float64() < fraction
+	}
+	s.credit += fraction
+	if s.credit >= 1 {
+		s.credit -= 1
+		return true
+	}
+	return false
+}
+
+// WorkerRate returns the target rate (operations per second) of this worker.
+// A cluster-wide rate is split between the workers according to their share of the users.
+func (w *Workload) WorkerRate(conf *types.RateConf, workerUsers int) float64 {
+	if conf.Scope == types.ClusterRate {
+		return conf.Target * float64(workerUsers) / float64(w.Config.Workload.UserCount)
+	}
+	return conf.Target
+}
@@ -0,0 +1,127 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package workload
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"orion-bench/pkg/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newRateWorkload returns a workload of a worker with the given rank, out of the given number of users.
+func newRateWorkload(rank uint64, userCount uint64) *Workload {
+	return &Workload{
+		Config:     &types.BenchmarkConf{Workload: types.WorkloadConf{UserCount: userCount}},
+		WorkerRank: rank,
+	}
+}
+
+func TestCheckRate(t *testing.T) {
+	require.NoError(t, checkRate(&types.RateConf{Scope: types.WorkerRate, Arrival: types.ConstantArrival}))
+	require.NoError(t, checkRate(&types.RateConf{Scope: types.ClusterRate, Arrival: types.PoissonArrival}))
+	require.EqualError(t, checkRate(&types.RateConf{Scope: types.WorkerRate, Arrival: "burst"}),
+		"invalid arrival type: burst")
+	require.EqualError(t, checkRate(&types.RateConf{Scope: "node", Arrival: types.ConstantArrival}),
+		"invalid rate scope: node")
+}
+
+func TestArrivalScheduleConstant(t *testing.T) {
+	s := newRateWorkload(0, 1).NewArrivalSchedule(&types.RateConf{Arrival: types.ConstantArrival})
+	for i := 0; i < 10; i++ {
+		require.Equal(t, 10*time.Millisecond, s.Next(100))
+	}
+	require.Equal(t, 2*time.Second, s.Next(0.5))
+}
+
+func TestArrivalSchedulePoisson(t *testing.T) {
+	const draws = 100000
+	conf := &types.RateConf{Arrival: types.PoissonArrival, Seed: 7}
+	s := newRateWorkload(0, 1).NewArrivalSchedule(conf)
+	var sum, sumSquares float64
+	for i := 0; i < draws; i++ {
+		next := s.Next(100)
+		require.GreaterOrEqual(t, next, time.Duration(0))
+		sum += float64(next)
+		sumSquares += float64(next) * float64(next)
+	}
+	// The inter-arrival times are exponential: their mean and their standard deviation are the interval
+	mean := sum / draws
+	std := math.Sqrt(sumSquares/draws - mean*mean)
+	require.InEpsilon(t, float64(10*time.Millisecond), mean, 0.02)
+	require.InEpsilon(t, float64(10*time.Millisecond), std, 0.05)
+
+	// The same seed and rank draw the same times, and each worker draws different times
+	sample := func(rank uint64) []time.Duration {
+		s := newRateWorkload(rank, 1).NewArrivalSchedule(conf)
+		times := make([]time.Duration, 10)
+		for i := range times {
+			times[i] = s.Next(100)
+		}
+		return times
+	}
+	require.Equal(t, sample(1), sample(1))
+	require.NotEqual(t, sample(1), sample(2))
+}
+
+func TestArrivalScheduleAcceptConstant(t *testing.T) {
+	s := newRateWorkload(0, 1).NewArrivalSchedule(&types.RateConf{Arrival: types.ConstantArrival})
+	for i := 1; i <= 12; i++ {
+		require.Equal(t, i%4 == 0, s.Accept(0.25), "arrival %d", i)
+	}
+
+	// The accepted arrivals are evenly spaced
+	s = newRateWorkload(0, 1).NewArrivalSchedule(&types.RateConf{Arrival: types.ConstantArrival})
+	var accepted []int
+	for i := 0; i < 100; i++ {
+		if s.Accept(0.4) {
+			accepted = append(accepted, i)
+		}
+	}
+	require.Len(t, accepted, 40)
+	for i := 1; i < len(accepted); i++ {
+		gap := accepted[i] - accepted[i-1]
+		require.True(t, gap == 2 || gap == 3, "gap %d", gap)
+	}
+
+	for i := 0; i < 10; i++ {
+		require.True(t, s.Accept(1))
+		require.True(t, s.Accept(1.5))
+	}
+}
+
+func TestArrivalScheduleAcceptPoisson(t *testing.T) {
+	const draws = 100000
+	s := newRateWorkload(0, 1).NewArrivalSchedule(&types.RateConf{Arrival: types.PoissonArrival, Seed: 7})
+	accepted := 0
+	for i := 0; i < draws; i++ {
+		if s.Accept(0.3) {
+			accepted++
+		}
+	}
+	require.InEpsilon(t, 0.3, float64(accepted)/draws, 0.02)
+
+	for i := 0; i < 10; i++ {
+		require.True(t, s.Accept(1))
+		require.False(t, s.Accept(0))
+	}
+}
+
+func TestWorkerRate(t *testing.T) {
+	w := newRateWorkload(0, 10)
+	workerConf := &types.RateConf{Target: 100, Scope: types.WorkerRate}
+	require.Equal(t, 100., w.WorkerRate(workerConf, 3))
+	require.Equal(t, 100., w.WorkerRate(workerConf, 10))
+
+	// The workers' shares of a cluster-wide rate add up to the target
+	clusterConf := &types.RateConf{Target: 100, Scope: types.ClusterRate}
+	require.Equal(t, 30., w.WorkerRate(clusterConf, 3))
+	total := 0.
+	for _, users := range []int{3, 3, 4} {
+		total += w.WorkerRate(clusterConf, users)
+	}
+	require.InDelta(t, 100., total, 1e-9)
+}
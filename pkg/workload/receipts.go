@@ -0,0 +1,150 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package workload
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"orion-bench/pkg/types"
+	"orion-bench/pkg/workload/common"
+
+	"github.com/hyperledger-labs/orion-sdk-go/pkg/bcdb"
+	"github.com/hyperledger-labs/orion-server/pkg/logger"
+	oriontypes "github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+)
+
+const unresolvedFlag = "UNRESOLVED"
+
+// TxTracker resolves the final validation status of the submitted TXs.
+// The TXs that were committed synchronously are resolved by their receipt, and the rest of the TXs are resolved by
+// fetching their receipts through the ledger API.
+// The latency of a TX is measured from its submission until its status was resolved, so the latency of the
+// asynchronous commits is accurate up to the poll interval.
+type TxTracker struct {
+	lg     *logger.SugarLogger
+	stats  *common.ClientStats
+	conf   *types.ReceiptConf
+	ledger bcdb.Ledger
+
+	lock    sync.Mutex
+	pending map[string]time.Time
+}
+
+// NewTxTracker creates a tracker. If ledger is nil, only the synchronous commits are resolved.
+func NewTxTracker(
+	lg *logger.SugarLogger, stats *common.ClientStats, conf *types.ReceiptConf, ledger bcdb.Ledger,
+) *TxTracker {
+	return &TxTracker{
+		lg:      lg,
+		stats:   stats,
+		conf:    conf,
+		ledger:  ledger,
+		pending: map[string]time.Time{},
+	}
+}
+
+// Committed records the outcome of a TX commit that was submitted at the given time.
+// A TX with a receipt is resolved immediately, and a TX that was accepted without a receipt is resolved later.
+// A TX that failed to be submitted is ignored.
+func (t *TxTracker) Committed(txID string, submitted time.Time, receiptEnv *oriontypes.TxReceiptResponseEnvelope, err error) {
+	var validationErr *bcdb.ErrorTxValidation
+	var serverTimeout *bcdb.ServerTimeout
+	receipt := receiptEnv.GetResponse().GetReceipt()
+	switch {
+	case receipt != nil && (err == nil || errors.As(err, &validationErr)):
+		t.resolve(submitted, receipt)
+	case err == nil, errors.As(err, &serverTimeout):
+		t.track(txID, submitted)
+	}
+}
+
+func (t *TxTracker) track(txID string, submitted time.Time) {
+	if t.ledger == nil || txID == "" {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.pending[txID] = submitted
+}
+
+func (t *TxTracker) resolve(submitted time.Time, receipt *oriontypes.TxReceipt) {
+	flag := oriontypes.Flag_VALID
+	validationInfo := receipt.GetHeader().GetValidationInfo()
+	if receipt.GetTxIndex() < uint64(len(validationInfo)) {
+		flag = validationInfo[receipt.GetTxIndex()].GetFlag()
+	}
+	t.stats.ObserveTxOutcome(flag.String(), common.ClassifyFlag(flag), time.Since(submitted))
+}
+
+// Pending returns the number of TXs whose status was not resolved yet.
+func (t *TxTracker) Pending() int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return len(t.pending)
+}
+
+func (t *TxTracker) snapshot() map[string]time.Time {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	snapshot := make(map[string]time.Time, len(t.pending))
+	for txID, submitted := range t.pending {
+		snapshot[txID] = submitted
+	}
+	return snapshot
+}
+
+func (t *TxTracker) remove(txID string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.pending, txID)
+}
+
+// poll fetches the receipts of the pending TXs once.
+// A TX with no receipt after the timeout is reported as unresolved.
+func (t *TxTracker) poll() {
+	for txID, submitted := range t.snapshot() {
+		receipt, err := t.ledger.GetTransactionReceipt(txID)
+		if err == nil {
+			t.remove(txID)
+			t.resolve(submitted, receipt)
+			continue
+		}
+
+		var notFound *bcdb.ErrorNotFound
+		if !errors.As(err, &notFound) {
+			t.lg.Debugf("Failed to fetch the receipt of TX %s: %s", txID, err)
+		}
+		if elapsed := time.Since(submitted); elapsed > t.conf.Timeout {
+			t.remove(txID)
+			t.stats.ObserveTxOutcome(unresolvedFlag, common.Unresolved, elapsed)
+		}
+	}
+}
+
+// Run polls the receipts of the pending TXs every poll interval until the context is cancelled.
+// Then, it keeps polling until all the pending TXs are resolved or timed out.
+func (t *TxTracker) Run(ctx context.Context) {
+	if t.ledger == nil {
+		return
+	}
+	ticker := time.NewTicker(t.conf.PollInterval)
+	defer ticker.Stop()
+	for ctx.Err() == nil {
+		select {
+		case <-ticker.C:
+			t.poll()
+		case <-ctx.Done():
+		}
+	}
+
+	if pending := t.Pending(); pending > 0 {
+		t.lg.Infof("Resolving the status of %d pending TXs.", pending)
+	}
+	for t.Pending() > 0 {
+		t.poll()
+		<-ticker.C
+	}
+}
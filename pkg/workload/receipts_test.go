@@ -0,0 +1,234 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package workload
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"orion-bench/pkg/types"
+	"orion-bench/pkg/workload/common"
+	"orion-bench/pkg/workload/fakedb"
+
+	"github.com/hyperledger-labs/orion-sdk-go/pkg/bcdb"
+	sdkconfig "github.com/hyperledger-labs/orion-sdk-go/pkg/config"
+	"github.com/hyperledger-labs/orion-server/pkg/logger"
+	oriontypes "github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	trackerDB   = "test-db"
+	trackerUser = "alice"
+)
+
+// trackerTest holds a fake BCDB with a DB that its user may write to.
+type trackerTest struct {
+	t     *testing.T
+	lg    *logger.SugarLogger
+	db    *fakedb.DB
+	stats *common.ClientStats
+}
+
+func newTrackerTest(t *testing.T) *trackerTest {
+	lg, err := logger.New(&logger.Config{
+		Level:         "info",
+		OutputPath:    []string{"stdout"},
+		ErrOutputPath: []string{"stderr"},
+		Encoding:      "console",
+		Name:          "orion-bench-test",
+	})
+	require.NoError(t, err)
+	tt := &trackerTest{t: t, lg: lg, db: fakedb.New("admin"), stats: common.RegisterClientStats(lg)}
+
+	s := tt.session("admin")
+	dbsTx, err := s.DBsTx()
+	require.NoError(t, err)
+	require.NoError(t, dbsTx.CreateDB(trackerDB, nil))
+	_, _, err = dbsTx.Commit(true)
+	require.NoError(t, err)
+	usersTx, err := s.UsersTx()
+	require.NoError(t, err)
+	require.NoError(t, usersTx.PutUser(&oriontypes.User{
+		Id: trackerUser,
+		Privilege: &oriontypes.Privilege{
+			DbPermission: map[string]oriontypes.Privilege_Access{trackerDB: oriontypes.Privilege_ReadWrite},
+		},
+	}, nil))
+	_, _, err = usersTx.Commit(true)
+	require.NoError(t, err)
+	return tt
+}
+
+func (tt *trackerTest) session(userID string) bcdb.DBSession {
+	s, err := tt.db.Session(&sdkconfig.SessionConfig{UserConfig: &sdkconfig.UserConfig{UserID: userID}})
+	require.NoError(tt.t, err)
+	return s
+}
+
+// tracker returns a tracker that resolves the asynchronous commits through the fake's ledger, if poll is true.
+func (tt *trackerTest) tracker(conf *types.ReceiptConf, poll bool) *TxTracker {
+	var ledger bcdb.Ledger
+	if poll {
+		var err error
+		ledger, err = tt.session("admin").Ledger()
+		require.NoError(tt.t, err)
+	}
+	return NewTxTracker(tt.lg, tt.stats, conf, ledger)
+}
+
+type commitResult struct {
+	txID       string
+	receiptEnv *oriontypes.TxReceiptResponseEnvelope
+	err        error
+}
+
+// commitConflicting commits two TXs that read and write the same key, so the second is invalidated by an MVCC
+// conflict.
+func (tt *trackerTest) commitConflicting(sync bool) []commitResult {
+	var txs []bcdb.DataTxContext
+	for i := 0; i < 2; i++ {
+		tx, err := tt.session(trackerUser).DataTx()
+		require.NoError(tt.t, err)
+		_, _, err = tx.Get(trackerDB, "key")
+		require.NoError(tt.t, err)
+		require.NoError(tt.t, tx.Put(trackerDB, "key", []byte("value"), nil))
+		txs = append(txs, tx)
+	}
+	var results []commitResult
+	for _, tx := range txs {
+		txID, receiptEnv, err := tx.Commit(sync)
+		results = append(results, commitResult{txID, receiptEnv, err})
+	}
+	return results
+}
+
+// outcomes returns the number of the resolved TXs by their status, and their maximal latency.
+func (tt *trackerTest) outcomes() (map[common.StatStatus]uint64, time.Duration) {
+	counts := map[common.StatStatus]uint64{}
+	var maxLatency time.Duration
+	now := time.Now()
+	for _, op := range tt.stats.Report("benchmark", 0, now.Add(-time.Minute), now).Operations {
+		if op.Operation != common.TxCommit {
+			continue
+		}
+		counts[op.Status] = op.Count
+		if op.Max > maxLatency {
+			maxLatency = op.Max
+		}
+	}
+	return counts, maxLatency
+}
+
+func TestTxTrackerSync(t *testing.T) {
+	tt := newTrackerTest(t)
+	tracker := tt.tracker(&types.ReceiptConf{PollInterval: time.Millisecond, Timeout: time.Minute}, false)
+	submitted := time.Now().Add(-time.Second)
+
+	results := tt.commitConflicting(true)
+	require.NoError(t, results[0].err)
+	require.Error(t, results[1].err)
+	for _, r := range results {
+		tracker.Committed(r.txID, submitted, r.receiptEnv, r.err)
+	}
+	// A TX that failed to be submitted is ignored
+	tracker.Committed("", submitted, nil, errors.New("connection refused"))
+	// Without a ledger, a TX that was accepted without a receipt is not tracked
+	tracker.Committed("async-tx", submitted, nil, nil)
+
+	require.Zero(t, tracker.Pending())
+	counts, maxLatency := tt.outcomes()
+	require.Equal(t, map[common.StatStatus]uint64{common.Success: 1, common.Conflict: 1}, counts)
+	require.GreaterOrEqual(t, maxLatency, time.Second, "the latency is measured from the submission")
+}
+
+func TestTxTrackerAsync(t *testing.T) {
+	tt := newTrackerTest(t)
+	tracker := tt.tracker(&types.ReceiptConf{PollInterval: time.Millisecond, Timeout: time.Minute}, true)
+	submitted := time.Now().Add(-time.Second)
+
+	// The asynchronous commits of both TXs succeed, and their status is resolved from their receipts
+	results := tt.commitConflicting(false)
+	for _, r := range results {
+		require.NoError(t, r.err)
+		require.Nil(t, r.receiptEnv)
+		tracker.Committed(r.txID, submitted, r.receiptEnv, r.err)
+	}
+	// A synchronous commit that timed out on the server side is resolved asynchronously
+	tx, err := tt.session(trackerUser).DataTx()
+	require.NoError(t, err)
+	require.NoError(t, tx.Put(trackerDB, "other-key", []byte("value"), nil))
+	txID, _, err := tx.Commit(false)
+	require.NoError(t, err)
+	tracker.Committed(txID, submitted, nil, &bcdb.ServerTimeout{TxID: txID})
+	// Other failures are not tracked
+	tracker.Committed("failed-tx", submitted, nil, errors.New("connection refused"))
+
+	require.Equal(t, 3, tracker.Pending())
+	counts, _ := tt.outcomes()
+	require.Empty(t, counts)
+
+	tracker.poll()
+	require.Zero(t, tracker.Pending())
+	counts, maxLatency := tt.outcomes()
+	require.Equal(t, map[common.StatStatus]uint64{common.Success: 2, common.Conflict: 1}, counts)
+	require.GreaterOrEqual(t, maxLatency, time.Second)
+}
+
+func TestTxTrackerUnresolved(t *testing.T) {
+	tt := newTrackerTest(t)
+	tracker := tt.tracker(&types.ReceiptConf{PollInterval: time.Millisecond, Timeout: time.Second}, true)
+
+	// The receipts of these TXs are never found
+	tracker.Committed("timed-out-tx", time.Now().Add(-2*time.Second), nil, nil)
+	tracker.Committed("recent-tx", time.Now(), nil, nil)
+	tracker.poll()
+	require.Equal(t, 1, tracker.Pending(), "the recent TX is still pending")
+	counts, maxLatency := tt.outcomes()
+	require.Equal(t, map[common.StatStatus]uint64{common.Unresolved: 1}, counts)
+	require.GreaterOrEqual(t, maxLatency, 2*time.Second)
+}
+
+func TestTxTrackerRun(t *testing.T) {
+	tt := newTrackerTest(t)
+	tracker := tt.tracker(&types.ReceiptConf{PollInterval: time.Millisecond, Timeout: 100 * time.Millisecond}, true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		tracker.Run(ctx)
+		close(done)
+	}()
+
+	results := tt.commitConflicting(false)
+	for _, r := range results {
+		tracker.Committed(r.txID, time.Now(), r.receiptEnv, r.err)
+	}
+	tracker.Committed("missing-tx", time.Now(), nil, nil)
+	require.Eventually(t, func() bool {
+		counts, _ := tt.outcomes()
+		return counts[common.Success]+counts[common.Conflict] == 2
+	}, time.Minute, time.Millisecond, "the committed TXs are resolved while running")
+
+	// After the context is cancelled, the tracker keeps polling until the pending TXs are resolved or timed out
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Minute):
+		require.Fail(t, "the tracker did not stop")
+	}
+	require.Zero(t, tracker.Pending())
+	counts, _ := tt.outcomes()
+	require.Equal(t, map[common.StatStatus]uint64{
+		common.Success: 1, common.Conflict: 1, common.Unresolved: 1,
+	}, counts)
+}
+
+func TestTxTrackerWithoutLedger(t *testing.T) {
+	tt := newTrackerTest(t)
+	tracker := tt.tracker(&types.ReceiptConf{PollInterval: time.Millisecond, Timeout: time.Minute}, false)
+	// Run returns immediately, since there is nothing to poll
+	tracker.Run(context.Background())
+}
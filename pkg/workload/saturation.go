@@ -0,0 +1,179 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+package workload
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"orion-bench/pkg/types"
+	"orion-bench/pkg/workload/common"
+
+	"github.com/pkg/errors"
+)
+
+// SaturationStep is the outcome of a single step of the saturation search.
+// The throughput only counts the work iterations that did not fail, while the work rate counts all of them.
+type SaturationStep struct {
+	Name       string
+	TargetRate float64
+	WorkerRate float64
+	WorkRate   float64
+	Throughput float64
+	P50        time.Duration
+	PSLO       time.Duration
+	ErrorRate  float64
+	DropRate   float64
+	Violation  string
+}
+
+func (w *Workload) checkSaturation() error {
+	conf := &w.Config.Workload.Saturation
+	if conf.InitialRate <= 0 {
+		return errors.Errorf("saturation initial rate must be positive (%f)", conf.InitialRate)
+	}
+	if conf.RateFactor*conf.InitialRate+conf.RateIncrement <= conf.InitialRate {
+		return errors.New("saturation rate must increase with each step")
+	}
+	// Each worker stops the search on its own evaluation (see config.CheckConfig)
+	if conf.Scope == types.ClusterRate && len(w.Config.Workload.Workers) > 1 {
+		return errors.New("saturation with a cluster scope requires a single worker")
+	}
+	return nil
+}
+
+// saturationSteps returns the phases of the saturation search, with an increasing rate.
+func (w *Workload) saturationSteps() []types.PhaseConf {
+	conf := &w.Config.Workload.Saturation
+	var steps []types.PhaseConf
+	rate := conf.InitialRate
+	for i := uint(0); i < conf.MaxSteps && (conf.MaxRate <= 0 || rate <= conf.MaxRate); i++ {
+		steps = append(steps, types.PhaseConf{
+			Name:     fmt.Sprintf("%s-%d", Saturation, i),
+			Duration: conf.StepDuration,
+			Users:    1,
+			Rate: types.RateConf{
+				Target:  rate,
+				Scope:   conf.Scope,
+				Arrival: conf.Arrival,
+				Seed:    conf.Seed,
+			},
+		})
+		rate = rate*conf.RateFactor + conf.RateIncrement
+	}
+	return steps
+}
+
+// evaluateStep summarizes the phase and checks it against the configured thresholds.
+func (w *Workload) evaluateStep(p *Phase) (*SaturationStep, error) {
+	conf := &w.Config.Workload.Saturation
+	summary, err := w.Stats.SummarizePhase(p.Conf.Name, common.StatOperation(conf.Operation))
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to evaluate step %s", p.Conf.Name)
+	}
+	step := &SaturationStep{
+		Name:       p.Conf.Name,
+		TargetRate: p.Conf.Rate.Target,
+		WorkerRate: p.rate,
+		WorkRate:   float64(summary.Work) / p.Conf.Duration.Seconds(),
+		Throughput: float64(summary.SuccessfulWork) / p.Conf.Duration.Seconds(),
+		P50:        summary.Quantile(0.5),
+		PSLO:       summary.Quantile(conf.SLOPercentile),
+		ErrorRate:  summary.ErrorRate(),
+		DropRate:   summary.DropRate(),
+	}
+
+	var violations []string
+	if summary.Successful == 0 {
+		violations = append(violations, "no successful operations")
+	} else if step.PSLO > conf.LatencySLO {
+		violations = append(violations, fmt.Sprintf("latency p%g > %s", conf.SLOPercentile*100, conf.LatencySLO))
+	}
+	// The failed work iterations are also checked, since the checked operation may succeed in a failed iteration
+	if step.ErrorRate > conf.MaxErrorRate || step.Throughput < step.WorkRate*(1-conf.MaxErrorRate) {
+		violations = append(violations, fmt.Sprintf("error rate > %g", conf.MaxErrorRate))
+	}
+	if step.DropRate > conf.MaxDropRate {
+		violations = append(violations, fmt.Sprintf("drop rate > %g", conf.MaxDropRate))
+	}
+	step.Violation = strings.Join(violations, ", ")
+	return step, nil
+}
+
+func formatDuration(d time.Duration) string {
+	if d < 0 {
+		return "-"
+	}
+	return d.Round(time.Microsecond).String()
+}
+
+// SaturationReport formats the steps of the saturation search as a table.
+func (w *Workload) SaturationReport(steps []*SaturationStep) string {
+	conf := &w.Config.Workload.Saturation
+	buf := &bytes.Buffer{}
+	tw := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tw,
+		"step\ttarget (TX/s)\tworker (TX/s)\twork (TX/s)\tthroughput (TX/s)\tp50\tp%g\terrors\tdrops\tresult\n",
+		conf.SLOPercentile*100)
+
+	var sustainable *SaturationStep
+	for _, s := range steps {
+		result := "ok"
+		if s.Violation != "" {
+			result = s.Violation
+		} else {
+			sustainable = s
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%.2f\t%.2f\t%.2f\t%.2f\t%s\t%s\t%.4f\t%.4f\t%s\n",
+			s.Name, s.TargetRate, s.WorkerRate, s.WorkRate, s.Throughput, formatDuration(s.P50), formatDuration(s.PSLO),
+			s.ErrorRate, s.DropRate, result)
+	}
+	_ = tw.Flush()
+
+	if sustainable == nil {
+		_, _ = fmt.Fprintf(buf, "No sustainable rate was found.\n")
+	} else {
+		_, _ = fmt.Fprintf(buf, "Highest sustainable rate: %.2f TX/s (%s scope), throughput: %.2f TX/s.\n",
+			sustainable.TargetRate, conf.Scope, sustainable.Throughput)
+	}
+	return buf.String()
+}
+
+// RunSaturation runs the workload with an increasing rate until the configured thresholds are violated.
+// The results table is printed and saved to the metrics path.
+// It fails if any user stopped due to failures, after the report is saved.
+func (w *Workload) RunSaturation(ctx context.Context) error {
+	var steps []*SaturationStep
+	runErr := w.RunAllUsers(ctx, Saturation, func(p *Phase) (bool, error) {
+		step, err := w.evaluateStep(p)
+		if err != nil {
+			return false, err
+		}
+		w.Lg.Infof("Saturation step %s: %.2f TX/s, work: %.2f TX/s, throughput: %.2f TX/s, p50: %s, violation: '%s'.",
+			step.Name, step.TargetRate, step.WorkRate, step.Throughput, formatDuration(step.P50), step.Violation)
+		steps = append(steps, step)
+		return step.Violation == "", nil
+	})
+	if runErr != nil && len(steps) == 0 {
+		return runErr
+	}
+
+	report := w.SaturationReport(steps)
+	fmt.Print(report)
+
+	if err := os.MkdirAll(w.Config.Path.Metrics, perm); err != nil {
+		return err
+	}
+	reportPath := filepath.Join(w.Config.Path.Metrics, fmt.Sprintf("saturation-%d.txt", w.WorkerRank))
+	if err := os.WriteFile(reportPath, []byte(report), perm); err != nil {
+		return err
+	}
+	w.Lg.Infof("Saturation report saved to: %s", reportPath)
+	return runErr
+}
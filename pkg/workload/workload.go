@@ -3,16 +3,20 @@
 package workload
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 	"unsafe"
 
+	"orion-bench/pkg/coordinator"
 	"orion-bench/pkg/material"
 	"orion-bench/pkg/types"
-	"orion-bench/pkg/utils"
 	"orion-bench/pkg/workload/common"
 
 	"github.com/cenkalti/backoff"
@@ -22,6 +26,7 @@ import (
 	"github.com/hyperledger-labs/orion-server/pkg/cryptoservice"
 	"github.com/hyperledger-labs/orion-server/pkg/logger"
 	oriontypes "github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
 )
 
 // WorkType is used to define if a worker should run the warmup procedure or the actual workload.
@@ -29,16 +34,20 @@ type WorkType string
 
 const Warmup WorkType = "warmup"
 const Benchmark WorkType = "benchmark"
+const Saturation WorkType = "saturation"
+
+const perm = 0766
 
 // Worker implements a workload generator.
 // It is responsible to initialize the experiment and creating the users' workers.
 type Worker interface {
 	// Init should initialize the experiment. It is called only once from a single thread.
 	// A common initialization is admin TXs such as creating the DB tables and adding all the users.
-	Init()
+	Init() error
 	// MakeWorker create a UserWorker instance for each user (userIndex) that is assigned to this worker.
 	// This worker should execute a single user operations on the basis of the workType parameter (warmup of benchmark).
-	MakeWorker(userIndex uint64, workType WorkType) UserWorker
+	// If it fails (e.g., due to invalid parameters), the work is not started.
+	MakeWorker(userIndex uint64, workType WorkType) (UserWorker, error)
 }
 
 // WorkStatus is returned after a worker executed a work iteration.
@@ -58,7 +67,20 @@ const Enough WorkStatus = 2
 type UserWorker interface {
 	// Work executes a single user operation drawn from the list of operations that were defined in the configuration.
 	// It should return a valid WorkStatus as described above.
-	Work() WorkStatus
+	// If the operation failed, it should also return the error. The error consumes the user's error budget,
+	// unless it is a fatal Failure, which stops the user immediately.
+	// The context is cancelled when the work is stopped (e.g., due to SIGINT/SIGTERM).
+	// The in-flight operation is allowed to complete, but failures after the cancellation are expected,
+	// and should not be returned.
+	Work(ctx context.Context) (WorkStatus, error)
+}
+
+// PhasedUserWorker is optionally implemented by a UserWorker that supports a different operation mix in each phase.
+type PhasedUserWorker interface {
+	UserWorker
+	// SetPhase is called before the first work iteration of each phase.
+	// The phase index corresponds to the list returned by Workload.Phases() for the worker's WorkType.
+	SetPhase(phase int)
 }
 
 // Workload orchestrates the workload generation. It is used to initialize the Worker implementation.
@@ -69,6 +91,8 @@ type Workload struct {
 	Material   *material.BenchMaterial
 	WorkerRank uint64
 	Worker     Worker
+	// Schema declares the Worker's parameters and their defaults
+	Schema *Schema
 
 	// Evaluated lazily
 	db        unsafe.Pointer
@@ -77,6 +101,12 @@ type Workload struct {
 	waitStart *sync.WaitGroup
 	waitEnd   *sync.WaitGroup
 	endTime   time.Time
+	arrivals  chan time.Time
+	phases    []*Phase
+	results   []*UserResult
+	tracker   *TxTracker
+	ctx       context.Context
+	cancel    context.CancelFunc
 }
 
 type UserParameters struct {
@@ -100,117 +130,161 @@ func New(
 	}
 }
 
-func (w *Workload) Check(err error) {
-	utils.Check(w.Lg, err)
-}
-
 func (w *Workload) Replicas() []*sdkconfig.Replica {
 	var replicas []*sdkconfig.Replica
 	for _, nodeData := range w.Material.AllNodes() {
-		//goland:noinspection HttpUrlsUsage
 		replicas = append(replicas, &sdkconfig.Replica{
 			ID:       nodeData.Crypto.Name(),
-			Endpoint: fmt.Sprintf("http://%s:%d", nodeData.Address, nodeData.NodePort),
+			Endpoint: fmt.Sprintf("%s://%s:%d", w.Material.Scheme(), nodeData.Address, nodeData.NodePort),
 		})
 	}
 	return replicas
 }
 
-func (w *Workload) DB() bcdb.BCDB {
+// SetDB replaces the cluster connection, e.g., with an in-memory fake BCDB (see fakedb) for unit testing workloads.
+// It must be called before any session is created.
+func (w *Workload) SetDB(db bcdb.BCDB) {
+	atomic.StorePointer(&w.db, unsafe.Pointer(&db))
+}
+
+// DB returns the cluster connection. Unless it was set via SetDB, it connects to the cluster on first use.
+func (w *Workload) DB() (bcdb.BCDB, error) {
 	dbPtr := atomic.LoadPointer(&w.db)
 	if dbPtr != nil {
-		return *(*bcdb.BCDB)(dbPtr)
+		return *(*bcdb.BCDB)(dbPtr), nil
 	}
 	db, err := bcdb.Create(&sdkconfig.ConnectionConfig{
 		ReplicaSet: w.Replicas(),
 		RootCAs:    []string{w.Material.RootUser().CertPath()},
 		Logger:     w.Lg,
-		//TLSConfig:  c.Material().ServerTLS(),
+		TLSConfig:  w.Material.ServerTLS(),
 	})
-	w.Check(err)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to the cluster")
+	}
 	swapped := atomic.CompareAndSwapPointer(&w.db, nil, unsafe.Pointer(&db))
 	if swapped {
-		return db
+		return db, nil
 	}
-	return *(*bcdb.BCDB)(atomic.LoadPointer(&w.db))
+	return *(*bcdb.BCDB)(atomic.LoadPointer(&w.db)), nil
 }
 
-func (w *Workload) Session(userCrypto *material.CryptoMaterial) bcdb.DBSession {
+func (w *Workload) Session(userCrypto *material.CryptoMaterial) (bcdb.DBSession, error) {
 	name := userCrypto.Name()
 	session, ok := w.sessions.Load(name)
 	if ok {
-		return session.(bcdb.DBSession)
+		return session.(bcdb.DBSession), nil
 	}
 
-	session, err := w.DB().Session(&sdkconfig.SessionConfig{
+	db, err := w.DB()
+	if err != nil {
+		return nil, err
+	}
+	session, err = db.Session(&sdkconfig.SessionConfig{
 		UserConfig:   userCrypto.Config(),
 		TxTimeout:    w.Config.Workload.Session.TxTimeout,
 		QueryTimeout: w.Config.Workload.Session.QueryTimeout,
-		//ClientTLS:    userCrypto.TLS(),
+		// The client's TLS certificate is only used if the cluster requires client authentication
+		ClientTLS: userCrypto.TLS(),
 	})
-	w.Check(err)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create a session for %s", name)
+	}
 
 	actualSession, _ := w.sessions.LoadOrStore(name, session)
-	return actualSession.(bcdb.DBSession)
+	return actualSession.(bcdb.DBSession), nil
 }
 
-func (w *Workload) AdminSession() bcdb.DBSession {
+func (w *Workload) AdminSession() (bcdb.DBSession, error) {
 	return w.Session(w.Material.AdminUser())
 }
 
-func (w *Workload) UserSession(i uint64) bcdb.DBSession {
+func (w *Workload) UserSession(i uint64) (bcdb.DBSession, error) {
 	return w.Session(w.Material.User(i))
 }
 
-func (w *Workload) CheckAbort(tx bcdb.TxContext) {
-	err := tx.Abort()
-	if err != nil && err != bcdb.ErrTxSpent {
-		w.Check(err)
+// CheckReady returns nil if the cluster serves the admin's requests.
+func (w *Workload) CheckReady() error {
+	session, err := w.AdminSession()
+	if err != nil {
+		return err
 	}
+	ledger, err := session.Ledger()
+	if err != nil {
+		return errors.Wrap(err, "failed to access the ledger")
+	}
+	_, err = ledger.GetLastBlockHeader()
+	return errors.Wrap(err, "failed to fetch the last block header")
 }
 
-func (w *Workload) CheckCommit(tx bcdb.TxContext) {
-	w.Check(w.CommitSync(tx, true))
+// AbortTx aborts a TX that was not committed. It is meant to be deferred, so it only logs a failure.
+func (w *Workload) AbortTx(tx bcdb.TxContext) {
+	err := tx.Abort()
+	if err != nil && err != bcdb.ErrTxSpent {
+		w.Lg.Warnf("Failed to abort TX: %s", err)
+	}
 }
 
+// CommitSync commits the TX. During the work, the final validation status of the TX is resolved by the TX tracker.
 func (w *Workload) CommitSync(tx bcdb.TxContext, sync bool) error {
+	submitted := time.Now()
 	txID, receiptEnv, err := tx.Commit(sync)
+	if w.tracker != nil {
+		w.tracker.Committed(txID, submitted, receiptEnv, err)
+	}
 	if err == nil {
 		w.Lg.Debugf("Commited txID: %s, receipt: %+v", txID, receiptEnv.GetResponse().GetReceipt())
 	}
 	return err
 }
 
-func (w *Workload) sign(s crypto.Signer, txEnv *oriontypes.DataTxEnvelope) {
+func (w *Workload) sign(s crypto.Signer, txEnv *oriontypes.DataTxEnvelope) error {
 	sig, err := cryptoservice.SignTx(s, txEnv.Payload)
-	w.Check(err)
+	if err != nil {
+		return errors.Wrapf(err, "failed to sign TX by %s", s.Identity())
+	}
 	txEnv.Signatures[s.Identity()] = sig
+	return nil
 }
 
-func (w *Workload) MultiSignDataTx(tx bcdb.DataTxContext, signers map[string]crypto.Signer) *oriontypes.DataTxEnvelope {
+func (w *Workload) MultiSignDataTx(
+	tx bcdb.DataTxContext, signers map[string]crypto.Signer,
+) (*oriontypes.DataTxEnvelope, error) {
 	msg, err := tx.SignConstructedTxEnvelopeAndCloseTx()
-	w.Check(err)
+	if err != nil {
+		return nil, err
+	}
 	txEnv := msg.(*oriontypes.DataTxEnvelope)
 	for _, s := range signers {
-		w.sign(s, txEnv)
+		if err = w.sign(s, txEnv); err != nil {
+			return nil, err
+		}
 	}
-	return txEnv
+	return txEnv, nil
 }
 
-func (w *Workload) CreateTable(tableName string, indices ...string) {
+func (w *Workload) CreateTable(tableName string, indices ...string) error {
 	index := make(map[string]oriontypes.IndexAttributeType)
 	for _, ind := range indices {
 		index[ind] = oriontypes.IndexAttributeType_STRING
 	}
 
-	tx, err := w.AdminSession().DBsTx()
-	w.Check(err)
-	defer w.CheckAbort(tx)
-	w.Check(tx.CreateDB(tableName, index))
-	w.CheckCommit(tx)
+	session, err := w.AdminSession()
+	if err != nil {
+		return err
+	}
+	tx, err := session.DBsTx()
+	if err != nil {
+		return err
+	}
+	defer w.AbortTx(tx)
+	if err = tx.CreateDB(tableName, index); err != nil {
+		return err
+	}
+	return errors.Wrapf(w.CommitSync(tx, true), "failed to create table %s", tableName)
 }
 
-func (w *Workload) AddUsers(dbName ...string) {
+func (w *Workload) AddUsers(dbName ...string) error {
 	commonPrivilege := &oriontypes.Privilege{
 		DbPermission: make(map[string]oriontypes.Privilege_Access),
 		Admin:        false,
@@ -219,39 +293,56 @@ func (w *Workload) AddUsers(dbName ...string) {
 		commonPrivilege.DbPermission[db] = oriontypes.Privilege_ReadWrite
 	}
 
-	tx, err := w.AdminSession().UsersTx()
-	w.Check(err)
-	defer w.CheckAbort(tx)
+	session, err := w.AdminSession()
+	if err != nil {
+		return err
+	}
+	tx, err := session.UsersTx()
+	if err != nil {
+		return err
+	}
+	defer w.AbortTx(tx)
 	for _, user := range w.Material.AllUsers() {
-		w.Check(tx.PutUser(&oriontypes.User{
+		cert, err := user.Cert()
+		if err != nil {
+			return err
+		}
+		err = tx.PutUser(&oriontypes.User{
 			Id:          user.Name(),
-			Certificate: user.Cert().Raw,
+			Certificate: cert.Raw,
 			Privilege:   commonPrivilege,
-		}, nil))
+		}, nil)
+		if err != nil {
+			return err
+		}
 	}
-	w.CheckCommit(tx)
+	return errors.Wrap(w.CommitSync(tx, true), "failed to add the users")
 }
 
+// GetConfString returns the parameter value, or its default in the schema if it is not configured.
 func (w *Workload) GetConfString(key string) string {
-	return w.Config.Workload.Parameters[key]
+	if value, ok := w.Config.Workload.Parameters[key]; ok {
+		return value
+	}
+	if p := w.Schema.Param(key); p != nil {
+		return p.Default
+	}
+	return ""
 }
 
-func (w *Workload) GetConfInt(key string) int {
+func (w *Workload) GetConfInt(key string) (int, error) {
 	intVar, err := strconv.Atoi(w.GetConfString(key))
-	w.Check(err)
-	return intVar
+	return intVar, errors.Wrapf(err, "invalid workload parameter %s", key)
 }
 
-func (w *Workload) GetConfFloat(key string) float64 {
-	intVar, err := strconv.ParseFloat(w.GetConfString(key), 64)
-	w.Check(err)
-	return intVar
+func (w *Workload) GetConfFloat(key string) (float64, error) {
+	floatVar, err := strconv.ParseFloat(w.GetConfString(key), 64)
+	return floatVar, errors.Wrapf(err, "invalid workload parameter %s", key)
 }
 
-func (w *Workload) GetConfBool(key string) bool {
+func (w *Workload) GetConfBool(key string) (bool, error) {
 	boolVar, err := strconv.ParseBool(w.GetConfString(key))
-	w.Check(err)
-	return boolVar
+	return boolVar, errors.Wrapf(err, "invalid workload parameter %s", key)
 }
 
 func (w *Workload) WorkerUsers() []uint64 {
@@ -268,49 +359,310 @@ func (w *Workload) ServePrometheus() {
 	w.Stats.ServePrometheus(w.Material.Worker(w.WorkerRank).PrometheusServeAddress())
 }
 
-func (w *Workload) Init() {
-	w.Worker.Init()
+func (w *Workload) Init() error {
+	return w.Worker.Init()
 }
 
-func (w *Workload) RunBenchmark() {
-	w.RunAllUsers(Benchmark, w.Config.Workload.Duration)
+func (w *Workload) RunBenchmark(ctx context.Context) error {
+	return w.RunAllUsers(ctx, Benchmark, nil)
 }
 
-func (w *Workload) RunWarmup() {
-	w.RunAllUsers(Warmup, w.Config.Workload.WarmupDuration)
+func (w *Workload) RunWarmup(ctx context.Context) error {
+	return w.RunAllUsers(ctx, Warmup, nil)
 }
 
-func (w *Workload) RunAllUsers(workType WorkType, duration time.Duration) {
+// RunAllUsers runs all the worker's users through the phases of the work type.
+// If onPhaseEnd is not nil, it is called at the end of each phase. If it returns false or fails, the work is stopped.
+// If the context is cancelled, the work is stopped after the in-flight operations complete, and the report
+// covers the work until then.
+// The work is not started if any of the users failed to initialize.
+// Otherwise, the report and the error summary are written, and it fails if any user stopped due to failures.
+func (w *Workload) RunAllUsers(ctx context.Context, workType WorkType, onPhaseEnd PhaseEndFunc) error {
+	if err := w.CheckPhases(workType); err != nil {
+		return err
+	}
 	go w.ServePrometheus()
 
 	w.Lg.Infof("Running %s (rank: %d).", workType, w.WorkerRank)
 
+	stopTracker, err := w.startTracker()
+	if err != nil {
+		return err
+	}
+	defer stopTracker()
+	stopListener, err := w.startBlockListener()
+	if err != nil {
+		return err
+	}
+	defer stopListener()
+
 	w.waitInit = &sync.WaitGroup{}
 	w.waitStart = &sync.WaitGroup{}
 	w.waitEnd = &sync.WaitGroup{}
+	w.arrivals = make(chan time.Time)
+	w.ctx, w.cancel = context.WithCancel(ctx)
+	defer w.Stop()
 
 	users := w.WorkerUsers()
+	w.phases = w.makePhases(workType, len(users))
+	w.results = make([]*UserResult, len(users))
 	w.waitInit.Add(len(users))
 	w.waitStart.Add(1)
+	w.waitEnd.Add(len(users))
 
 	w.Lg.Infof("Initiating workers (%d users).", len(users))
-	for _, userIndex := range users {
-		go w.RunUserWork(userIndex, workType)
+	initErrors := make([]error, len(users))
+	for position, userIndex := range users {
+		w.results[position] = &UserResult{Index: userIndex}
+		go w.RunUserWork(userIndex, position, len(users), workType, &initErrors[position])
 	}
 
 	w.waitInit.Wait()
+	if err := w.initError(initErrors); err != nil {
+		w.Stop()
+		w.waitStart.Done()
+		return err
+	}
 	w.Lg.Infof("Workers finished initialization.")
 
-	w.endTime = time.Now().Add(duration)
-	w.waitEnd.Add(len(users))
+	startTime, err := w.syncStart(workType)
+	if err != nil {
+		w.Stop()
+		w.waitStart.Done()
+		return err
+	}
+	w.endTime = startPhases(w.phases, startTime)
 
+	phasesDone := make(chan error, 1)
+	go func() {
+		phasesDone <- w.runPhases(onPhaseEnd)
+	}()
+
+	w.Stats.ResetHistograms()
 	w.waitStart.Done()
 	w.Lg.Infof("Work started.")
-	timeout := common.WaitTimeout(w.waitEnd, duration+time.Minute)
+	timeout := common.WaitTimeout(w.waitEnd, w.endTime.Sub(startTime)+time.Minute)
+	var phasesErr error
 	if timeout {
 		w.Lg.Warning("Workers timeout.")
+	} else {
+		phasesErr = <-phasesDone
+	}
+	if ctx.Err() != nil {
+		w.Lg.Infof("Work stopped.")
+	} else {
+		w.Lg.Infof("Work ended.")
+	}
+	stopTracker()
+	stopListener()
+	if err = w.WriteReport(workType, startTime, time.Now()); err != nil {
+		return err
+	}
+	if phasesErr != nil {
+		return phasesErr
 	}
-	w.Lg.Infof("Work ended.")
+
+	summary := NewErrorSummary(w.results)
+	fmt.Print(summary.Text())
+	return summary.Err()
+}
+
+// startTracker starts resolving the status of the submitted TXs.
+// The returned function stops the tracker after the pending TXs are resolved.
+func (w *Workload) startTracker() (func(), error) {
+	var ledger bcdb.Ledger
+	conf := &w.Config.Workload.Session.Receipts
+	if conf.PollInterval > 0 {
+		session, err := w.AdminSession()
+		if err != nil {
+			return nil, err
+		}
+		if ledger, err = session.Ledger(); err != nil {
+			return nil, errors.Wrap(err, "failed to access the ledger")
+		}
+	}
+	w.tracker = NewTxTracker(w.Lg, w.Stats, conf, ledger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.tracker.Run(ctx)
+		close(done)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}, nil
+}
+
+// startBlockListener starts following the new blocks, if the block listener is enabled.
+// The returned function stops the listener.
+func (w *Workload) startBlockListener() (func(), error) {
+	conf := &w.Config.Workload.Blocks
+	if !conf.Enabled {
+		return func() {}, nil
+	}
+	session, err := w.AdminSession()
+	if err != nil {
+		return nil, err
+	}
+	ledger, err := session.Ledger()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to access the ledger")
+	}
+	listener, err := NewBlockListener(w.Lg, w.Stats, conf, ledger)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		listener.Run(ctx)
+		close(done)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}, nil
+}
+
+// initError returns an error if any of the users failed to initialize.
+func (w *Workload) initError(initErrors []error) error {
+	var failed []error
+	for _, err := range initErrors {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return errors.Wrapf(failed[0], "%d out of %d users failed to initialize, the first error", len(failed), len(initErrors))
+}
+
+// ReportPath returns the path of a worker's report, without an extension.
+func (w *Workload) ReportPath(workType WorkType, rank uint64) string {
+	return filepath.Join(w.Config.Path.Metrics, fmt.Sprintf("%s-%d.report", workType, rank))
+}
+
+// WriteReport prints the end-of-run summary, and saves it as text and JSON to the metrics path.
+func (w *Workload) WriteReport(workType WorkType, start time.Time, end time.Time) error {
+	report := w.Stats.Report(string(workType), w.WorkerRank, start, end)
+	report.Crypto = w.Material.Crypto().String()
+	fmt.Print(report.Text())
+
+	if err := os.MkdirAll(w.Config.Path.Metrics, perm); err != nil {
+		return err
+	}
+	reportPath := w.ReportPath(workType, w.WorkerRank)
+	if err := report.Write(reportPath, perm); err != nil {
+		return errors.Wrap(err, "failed to save the report")
+	}
+	w.Lg.Infof("Report saved to: %s.{txt,json}", reportPath)
+	return nil
+}
+
+// MergeReports merges the reports of all the worker ranks into a cluster-wide report for each work type.
+// Ranks with no report are reported as missing.
+func (w *Workload) MergeReports() error {
+	for _, workType := range []WorkType{Warmup, Benchmark} {
+		var reports []*common.Report
+		var missing []uint64
+		for rank := range w.Config.Workload.Workers {
+			report, err := common.ReadReport(w.ReportPath(workType, uint64(rank)) + ".json")
+			if os.IsNotExist(err) {
+				missing = append(missing, uint64(rank))
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			reports = append(reports, report)
+		}
+		if len(reports) == 0 {
+			w.Lg.Infof("No %s reports were found.", workType)
+			continue
+		}
+		if len(missing) > 0 {
+			w.Lg.Warnf("Missing %s reports of ranks: %v", workType, missing)
+		}
+
+		clusterReport := common.NewClusterReport(string(workType), reports, missing)
+		fmt.Print(clusterReport.Text())
+		reportPath := filepath.Join(w.Config.Path.Metrics, fmt.Sprintf("%s-cluster.report", workType))
+		if err := clusterReport.Write(reportPath, perm); err != nil {
+			return errors.Wrap(err, "failed to save the cluster report")
+		}
+		w.Lg.Infof("Cluster report saved to: %s.{txt,json}", reportPath)
+	}
+	return nil
+}
+
+// CompareReports compares a candidate report to a baseline report (worker or cluster reports).
+// The comparison is printed and saved next to the candidate report.
+// It fails if the candidate regressed beyond the configured tolerance thresholds.
+func (w *Workload) CompareReports(baselinePath string, candidatePath string) error {
+	baseline, err := common.ReadAnyReport(baselinePath)
+	if err != nil {
+		return err
+	}
+	candidate, err := common.ReadAnyReport(candidatePath)
+	if err != nil {
+		return err
+	}
+
+	comparison := common.Compare(&w.Config.Comparison, baselinePath, baseline, candidatePath, candidate)
+	fmt.Print(comparison.Text())
+	comparisonPath := strings.TrimSuffix(candidatePath, filepath.Ext(candidatePath)) + ".compare"
+	if err = comparison.Write(comparisonPath, perm); err != nil {
+		return errors.Wrap(err, "failed to save the comparison")
+	}
+	w.Lg.Infof("Comparison saved to: %s.{txt,json}", comparisonPath)
+
+	if !comparison.Passed {
+		return errors.New("candidate regressed beyond the tolerance thresholds")
+	}
+	return nil
+}
+
+// syncStart returns the start time of the work.
+// If a coordinator is configured, it waits until all the worker ranks finished their initialization.
+func (w *Workload) syncStart(workType WorkType) (time.Time, error) {
+	conf := &w.Config.Workload.Coordinator
+	if conf.Address == "" {
+		return time.Now(), nil
+	}
+
+	var duration time.Duration
+	for _, p := range w.phases {
+		duration += p.Conf.Duration
+	}
+	address := coordinator.TargetAddress(conf)
+	w.Lg.Infof("Waiting for all the workers at the coordinator: %s", address)
+	release, err := coordinator.Wait(w.ctx, address, &coordinator.Registration{
+		Rank:     w.WorkerRank,
+		WorkType: string(workType),
+		Duration: duration,
+	})
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "failed to register at the coordinator")
+	}
+
+	if release.Late {
+		w.Lg.Warnf("Worker registered late. Joining the work that started at %s.", release.Start)
+	}
+	if len(release.Missing) > 0 {
+		w.Lg.Warnf("Missing workers: %v", release.Missing)
+	}
+	w.Lg.Infof("Work starts at %s and ends at %s.", release.Start, release.End)
+	sleepUntil(release.Start, w.ctx.Done())
+	return release.Start, nil
+}
+
+// Stop signals the users to stop working.
+func (w *Workload) Stop() {
+	w.cancel()
 }
 
 func NewExponentialBackOff(conf *types.BackoffConf) *backoff.ExponentialBackOff {
@@ -326,26 +678,94 @@ func NewExponentialBackOff(conf *types.BackoffConf) *backoff.ExponentialBackOff
 	return b
 }
 
-func (w *Workload) RunUserWork(userIndex uint64, workType WorkType) {
-	worker := w.Worker.MakeWorker(userIndex, workType)
-	expBackoff := NewExponentialBackOff(&w.Config.Workload.Session.Backoff)
+// RunUserWork executes the user's operations until the end of the last phase, or until the user stops due to
+// failures. The failures are recorded in the user's result.
+// The user at the given position (out of count users) only works when it is active in the current phase.
+// In open-loop phases, the user waits for a dispatched operation before each work iteration.
+// If the user fails to initialize, the error is set to initErr.
+func (w *Workload) RunUserWork(userIndex uint64, position int, count int, workType WorkType, initErr *error) {
+	defer w.waitEnd.Done()
+	worker, err := w.Worker.MakeWorker(userIndex, workType)
 	w.waitInit.Done()
+	if err != nil {
+		*initErr = errors.Wrapf(err, "user %d", userIndex)
+		return
+	}
+	phasedWorker, isPhased := worker.(PhasedUserWorker)
+	expBackoff := NewExponentialBackOff(&w.Config.Workload.Session.Backoff)
+	result := w.results[position]
 
 	w.waitStart.Wait()
-	for w.endTime.After(time.Now()) {
-		status := worker.Work()
-		if status == Ok {
-			expBackoff.Reset()
-		} else if status == NeedBackoff {
-			duration := expBackoff.NextBackOff()
-			if duration == backoff.Stop {
-				w.Lg.Fatalf("Exponential backoff process stopped")
+	if w.ctx.Err() != nil {
+		return
+	}
+	curPhase := -1
+	for {
+		now := time.Now()
+		p := w.phaseAt(now)
+		if p == nil {
+			return
+		}
+		if p.Index != curPhase {
+			curPhase = p.Index
+			if isPhased {
+				phasedWorker.SetPhase(curPhase)
 			}
-			w.Stats.ObserveBackoff(duration)
-			time.Sleep(duration)
-		} else if status == Enough {
-			break
 		}
+
+		if !p.IsActive(position, count, now) {
+			wakeup := p.End
+			if p.Conf.Ramp {
+				wakeup = now.Add(rampPoll)
+			}
+			sleepUntil(wakeup, w.ctx.Done())
+			continue
+		}
+
+		scheduled := now
+		if p.OpenLoop() {
+			select {
+			case scheduled = <-w.arrivals:
+			case <-time.After(time.Until(p.End)):
+				continue
+			case <-w.ctx.Done():
+				return
+			}
+		}
+
+		start := time.Now()
+		status, err := worker.Work(w.ctx)
+		w.Stats.ObserveWorkLatency(scheduled, start, err)
+		if err != nil {
+			if !result.fail(err, &w.Config.Workload.Session.ErrorBudget) {
+				w.Lg.Errorf("User %d stopped: %s: %s", userIndex, result.StopReason, err)
+				return
+			}
+		} else {
+			result.succeed()
+		}
+		if !w.handleStatus(status, expBackoff, result) {
+			return
+		}
+	}
+}
+
+// handleStatus applies the backoff policy and returns false if the user should stop working.
+func (w *Workload) handleStatus(status WorkStatus, expBackoff *backoff.ExponentialBackOff, result *UserResult) bool {
+	switch status {
+	case Ok:
+		expBackoff.Reset()
+	case NeedBackoff:
+		duration := expBackoff.NextBackOff()
+		if duration == backoff.Stop {
+			result.stop("exponential backoff process stopped")
+			w.Lg.Errorf("User %d stopped: %s.", result.Index, result.StopReason)
+			return false
+		}
+		w.Stats.ObserveBackoff(duration)
+		sleepUntil(time.Now().Add(duration), w.ctx.Done())
+	case Enough:
+		return false
 	}
-	w.waitEnd.Done()
+	return true
 }
@@ -0,0 +1,108 @@
+// Author: Liran Funaro <liran.funaro@ibm.com>
+
+// Package workloadtest runs workloads in unit tests against the in-memory fake BCDB (see fakedb).
+// The users' work iterations are executed directly, one user at a time, so the tests are fast and deterministic.
+package workloadtest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"orion-bench/pkg/material"
+	"orion-bench/pkg/types"
+	"orion-bench/pkg/workload"
+	"orion-bench/pkg/workload/fakedb"
+
+	"github.com/creasty/defaults"
+	"github.com/hyperledger-labs/orion-server/pkg/logger"
+	oriontypes "github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	perm = 0766
+	// prometheusConf is the default prometheus configuration, which is required to generate the material
+	prometheusConf = "scrape_configs: []\n"
+)
+
+// Config returns a default configuration of a single worker with the given number of users and no nodes.
+// Its paths are in a temporary directory of the test.
+func Config(t testing.TB, userCount uint64) *types.BenchmarkConf {
+	conf := &types.BenchmarkConf{}
+	require.NoError(t, defaults.Set(conf))
+	dir := t.TempDir()
+	conf.LogLevel = "info"
+	conf.Path.Material = filepath.Join(dir, "material")
+	conf.Path.Data = filepath.Join(dir, "data")
+	conf.Path.Metrics = filepath.Join(dir, "metrics")
+	conf.Path.DefaultPrometheusConf = filepath.Join(dir, "prometheus.yaml")
+	require.NoError(t, os.WriteFile(conf.Path.DefaultPrometheusConf, []byte(prometheusConf), perm))
+	conf.Workload.UserCount = userCount
+	conf.Workload.Workers = []string{"127.0.0.1"}
+	conf.Workload.Parameters = map[string]string{}
+	return conf
+}
+
+// New generates the material of the configuration, and returns the workload of worker rank 0, whose DB is a
+// fake BCDB, and whose Worker is created by the builder. The workload is initialized (e.g., its tables are created).
+func New(
+	t testing.TB, conf *types.BenchmarkConf, builder func(w *workload.Workload) workload.Worker,
+) (*workload.Workload, *fakedb.DB) {
+	lg, err := logger.New(&logger.Config{
+		Level:         conf.LogLevel,
+		OutputPath:    []string{"stdout"},
+		ErrOutputPath: []string{"stderr"},
+		Encoding:      "console",
+		Name:          "orion-bench-test",
+	})
+	require.NoError(t, err)
+	benchMaterial := material.New(conf, lg)
+	require.NoError(t, benchMaterial.Generate())
+
+	w := workload.New(0, conf, benchMaterial, lg)
+	db := fakedb.New(benchMaterial.AdminUser().Name())
+	w.SetDB(db)
+	w.Worker = builder(w)
+	require.NoError(t, w.Init())
+	return w, db
+}
+
+// Warmup runs the warmup of each user until it has enough.
+// It fails the test if a work iteration fails, or if a user did not finish after the max iterations.
+func Warmup(t testing.TB, w *workload.Workload, maxIterations int) {
+	for _, userIndex := range w.WorkerUsers() {
+		worker, err := w.Worker.MakeWorker(userIndex, workload.Warmup)
+		require.NoError(t, err)
+		done := false
+		for i := 0; i < maxIterations && !done; i++ {
+			status, err := worker.Work(context.Background())
+			require.NoError(t, err, "user %d, iteration %d", userIndex, i)
+			require.NotEqual(t, workload.NeedBackoff, status, "user %d, iteration %d", userIndex, i)
+			done = status == workload.Enough
+		}
+		require.True(t, done, "user %d did not finish the warmup after %d iterations", userIndex, maxIterations)
+	}
+}
+
+// Benchmark runs the given number of benchmark work iterations of each user.
+// It fails the test if a work iteration fails, or does not return Ok.
+func Benchmark(t testing.TB, w *workload.Workload, iterations int) {
+	for _, userIndex := range w.WorkerUsers() {
+		worker, err := w.Worker.MakeWorker(userIndex, workload.Benchmark)
+		require.NoError(t, err)
+		for i := 0; i < iterations; i++ {
+			status, err := worker.Work(context.Background())
+			require.NoError(t, err, "user %d, iteration %d", userIndex, i)
+			require.Equal(t, workload.Ok, status, "user %d, iteration %d", userIndex, i)
+		}
+	}
+}
+
+// RequireValid fails the test if any of the committed TXs is invalid.
+func RequireValid(t testing.TB, db *fakedb.DB) {
+	for flag, count := range db.Flags() {
+		require.Equal(t, oriontypes.Flag_VALID, flag, "%d TXs are %s", count, flag)
+	}
+}